@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// binaryPolicies lists the values accepted by -binary.
+var binaryPolicies = []string{"wrap", "skip", "pass", "error"}
+
+// binaryReason returns why the first block of an input, head, looks like
+// binary data rather than text, or "" if it does not. NUL bytes are allowed
+// when they separate records. A character cut off at the end of head is not
+// counted as invalid unless the input ends there.
+func binaryReason(head []byte, eof, nulSeparated bool) string {
+	if !nulSeparated && bytes.IndexByte(head, 0) >= 0 {
+		return "it contains NUL bytes"
+	}
+	for b := head; len(b) > 0; {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 && (eof || utf8.FullRune(b)) {
+			return "it is not valid UTF-8"
+		}
+		b = b[size:]
+	}
+	return ""
+}
+
+// rawSource is implemented by readers whose records may be input to copy to
+// the output untouched, rather than records to wrap.
+type rawSource interface {
+	Raw() bool
+}
+
+// passReader returns an input in chunks to be copied to the output as is,
+// for -binary pass.
+type passReader struct {
+	reader *bufio.Reader
+}
+
+func (r *passReader) Next() ([]byte, error) {
+	chunk := make([]byte, r.reader.Size())
+	n, err := r.reader.Read(chunk)
+	if n > 0 {
+		return chunk[:n], nil
+	}
+	return nil, err
+}
+
+// Raw reports that every chunk is to be copied untouched.
+func (r *passReader) Raw() bool {
+	return true
+}
+
+// emptyReader is an input with no records, for one skipped by -binary skip
+// or -keep-going. It is its own io.Closer.
+type emptyReader struct{}
+
+func (emptyReader) Next() ([]byte, error) {
+	return nil, io.EOF
+}
+
+func (emptyReader) Close() error {
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// reportFlagCheck writes the result of a -check-flags dry run to w: flags
+// that will have no effect, and options that hold records back in memory.
+// Incompatible combinations never get this far, since they fail validation.
+func reportFlagCheck(w io.Writer, ineffective, buffering []string) {
+	fmt.Fprintf(w, "%s: options are compatible\n", pgmName)
+	for _, name := range ineffective {
+		fmt.Fprintf(w, "  ineffective: -%s has no effect with the other options given\n", name)
+	}
+	for _, note := range buffering {
+		fmt.Fprintf(w, "  buffering:   %s\n", note)
+	}
+}
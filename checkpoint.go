@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// checkpointPrint is the number of bytes at the start of an input whose hash
+// identifies it, so that a replaced or rotated file is noticed.
+const checkpointPrint = 4096
+
+// checkpoint records how far each input has been processed, for
+// -since-checkpoint.
+type checkpoint struct {
+	Inputs map[string]checkpointEntry `json:"inputs"`
+}
+
+// checkpointEntry is the position reached in one input.
+type checkpointEntry struct {
+	Offset      int64  `json:"offset"`
+	Fingerprint string `json:"fingerprint"` // SHA-256 of the first bytes, up to checkpointPrint
+}
+
+// loadCheckpoint reads a checkpoint file. A missing file means no input has
+// been processed yet and returns an empty checkpoint.
+func loadCheckpoint(filename string) (*checkpoint, error) {
+	cp := &checkpoint{Inputs: make(map[string]checkpointEntry)}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file '%s': %w", filename, err)
+	}
+	if cp.Inputs == nil {
+		cp.Inputs = make(map[string]checkpointEntry)
+	}
+	for name, entry := range cp.Inputs {
+		if entry.Offset < 0 {
+			return nil, fmt.Errorf("invalid checkpoint file '%s': negative offset for '%s'", filename, name)
+		}
+	}
+	return cp, nil
+}
+
+// save writes the checkpoint to filename, replacing it only once the new
+// contents are completely written.
+func (cp *checkpoint) save(filename string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// fingerprint returns the hex SHA-256 of the first n bytes of file, or of
+// the first checkpointPrint bytes if n is larger.
+func fingerprint(file *os.File, n int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, min(n, checkpointPrint))); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lastRecordEnd returns the offset just past the last delim in file between
+// start and size, or start if there is none, so that a record still being
+// appended is left for the next run.
+func lastRecordEnd(file *os.File, start, size int64, delim byte) (int64, error) {
+	buf := make([]byte, 64*1024)
+	for end := size; end > start; {
+		n := min(end-start, int64(len(buf)))
+		if _, err := file.ReadAt(buf[:n], end-n); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], delim); i >= 0 {
+			return end - n + int64(i) + 1, nil
+		}
+		end -= n
+	}
+	return start, nil
+}
+
+// openSinceCheckpoint returns a reader for the complete records appended to
+// file since the position recorded for name in cp, and the entry to record
+// once they are processed. If the file is shorter than before, or its first
+// bytes differ, it was truncated or replaced and is read from the start.
+func openSinceCheckpoint(file *os.File, name string, cp *checkpoint, delim byte) (io.Reader, checkpointEntry, error) {
+	var next checkpointEntry
+	info, err := file.Stat()
+	if err != nil {
+		return nil, next, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, next, fmt.Errorf("-since-checkpoint requires a regular file, and '%s' is not one", name)
+	}
+	size := info.Size()
+
+	var start int64
+	if prev, ok := cp.Inputs[name]; ok {
+		current, err := fingerprint(file, prev.Offset)
+		if err != nil {
+			return nil, next, err
+		}
+		switch {
+		case size < prev.Offset:
+			fmt.Fprintf(os.Stderr, "%s: '%s' is shorter than at the checkpoint; reading it from the start\n", pgmName, name)
+		case current != prev.Fingerprint:
+			fmt.Fprintf(os.Stderr, "%s: '%s' was replaced since the checkpoint; reading it from the start\n", pgmName, name)
+		default:
+			start = prev.Offset
+		}
+	}
+
+	end, err := lastRecordEnd(file, start, size, delim)
+	if err != nil {
+		return nil, next, err
+	}
+	next.Offset = end
+	if next.Fingerprint, err = fingerprint(file, end); err != nil {
+		return nil, next, err
+	}
+	return io.NewSectionReader(file, start, end-start), next, nil
+}
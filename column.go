@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// rowSource is implemented by readers of tabular input, to give the whole
+// row that the last record returned, one of its columns, came from.
+type rowSource interface {
+	Row() []string
+}
+
+// csvRowColumnReader reads CSV rows and returns one column of each as a
+// record, for -csv-in.
+type csvRowColumnReader struct {
+	reader *csv.Reader
+	col    int // 1-based
+	row    []string
+	rowNum int
+}
+
+// newCSVRowColumnReader returns a reader for column col, counted from 1, of
+// the CSV rows in input.
+func newCSVRowColumnReader(input *bufio.Reader, col int) *csvRowColumnReader {
+	r := csv.NewReader(input)
+	r.FieldsPerRecord = -1
+	return &csvRowColumnReader{reader: r, col: col}
+}
+
+func (r *csvRowColumnReader) Next() ([]byte, error) {
+	fields, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.rowNum++
+	if len(fields) < r.col {
+		return nil, fmt.Errorf("CSV row %d has %d fields, fewer than -col %d", r.rowNum, len(fields), r.col)
+	}
+	r.row = fields
+	return []byte(fields[r.col-1]), nil
+}
+
+// Row returns the fields of the row read last.
+func (r *csvRowColumnReader) Row() []string {
+	return r.row
+}
+
+// tsvRowColumnReader reads tab-separated rows, one per line, and returns one
+// column of each as a record, for -tsv-in. Fields are split on every tab;
+// there is no quoting.
+type tsvRowColumnReader struct {
+	lines  recordReader
+	col    int // 1-based
+	row    []string
+	rowNum int
+}
+
+// newTSVRowColumnReader returns a reader for column col, counted from 1, of
+// the rows read from lines.
+func newTSVRowColumnReader(lines recordReader, col int) *tsvRowColumnReader {
+	return &tsvRowColumnReader{lines: lines, col: col}
+}
+
+func (r *tsvRowColumnReader) Next() ([]byte, error) {
+	line, err := r.lines.Next()
+	if err != nil {
+		return nil, err
+	}
+	r.rowNum++
+	fields := strings.Split(string(line), "\t")
+	if len(fields) < r.col {
+		return nil, fmt.Errorf("TSV row %d has %d fields, fewer than -col %d", r.rowNum, len(fields), r.col)
+	}
+	r.row = fields
+	return []byte(fields[r.col-1]), nil
+}
+
+// Row returns the fields of the row read last.
+func (r *tsvRowColumnReader) Row() []string {
+	return r.row
+}
+
+// columnFormatter writes each record's row back out as CSV or TSV, with the
+// column the record came from replaced by the record as inner renders it.
+type columnFormatter struct {
+	inner   formatter
+	col     int
+	tsv     bool
+	useCRLF bool
+	writer  *csv.Writer
+	buf     bytes.Buffer
+	scratch *bufio.Writer
+}
+
+// newColumnFormatter returns a formatter for -csv-in, or -tsv-in when tsv is
+// set, that renders column col with inner. When useCRLF is set, rows end
+// with \r\n.
+func newColumnFormatter(inner formatter, col int, tsv, useCRLF bool) *columnFormatter {
+	f := &columnFormatter{inner: inner, col: col, tsv: tsv, useCRLF: useCRLF}
+	f.scratch = bufio.NewWriter(&f.buf)
+	return f
+}
+
+func (f *columnFormatter) Begin(w *bufio.Writer) error {
+	// As with -csv, the CSV writer shares w's buffer
+	f.writer = csv.NewWriter(w)
+	f.writer.UseCRLF = f.useCRLF
+	return nil
+}
+
+func (f *columnFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.buf.Reset()
+	if err := f.inner.Record(f.scratch, line, meta); err != nil {
+		return err
+	}
+	if err := f.scratch.Flush(); err != nil {
+		return err
+	}
+	row := slices.Clone(meta.row)
+	row[f.col-1] = f.buf.String()
+	if f.tsv {
+		terminator := "\n"
+		if f.useCRLF {
+			terminator = "\r\n"
+		}
+		_, err := w.WriteString(strings.Join(row, "\t") + terminator)
+		return err
+	}
+	return f.writer.Write(row)
+}
+
+func (f *columnFormatter) End(w *bufio.Writer) error {
+	f.writer.Flush()
+	return f.writer.Error()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// convertSources lists the input formats the "convert" subcommand reads.
+var convertSources = []string{"lines", "wrapped", "csv", "tsv", "json"}
+
+// parseConvertArgs handles the "convert" subcommand, given the full command
+// line. It returns the input format from a leading -from NAME, and the
+// command line with "convert" removed and a leading -to NAME replaced by
+// -format NAME, to be parsed as usual. -to wrapped, the default, selects the
+// delimiter-wrapped output.
+func parseConvertArgs(args []string) (string, []string) {
+	rest := args[2:]
+	var from, to string
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		name, value, hasValue := strings.Cut(rest[0][1:], "=")
+		if name != "from" && name != "-from" && name != "to" && name != "-to" {
+			break
+		}
+		if !hasValue {
+			if len(rest) < 2 {
+				fmt.Fprintf(os.Stderr, "Error: convert: %s requires a format name\n", rest[0])
+				os.Exit(1)
+			}
+			value, rest = rest[1], rest[1:]
+		}
+		rest = rest[1:]
+		if strings.TrimPrefix(name, "-") == "from" {
+			from = value
+		} else {
+			to = value
+		}
+	}
+
+	if !slices.Contains(convertSources, from) {
+		fmt.Fprintf(os.Stderr, "Error: convert: -from must be one of: %s\n", strings.Join(convertSources, ", "))
+		os.Exit(1)
+	}
+	converted := []string{args[0]}
+	if to != "" && to != "wrapped" {
+		converted = append(converted, "-format", to)
+	}
+	return from, append(converted, rest...)
+}
+
+// newConvertReader returns a reader for records stored in input in the
+// named format. Wrapped lines are enclosed in delimiter, as wrapline writes
+// them; wrapped and TSV lines, and plain ones, are read from lines, which
+// splits input.
+func newConvertReader(from string, input *bufio.Reader, lines recordReader, delimiter string, escapeDelim bool) recordReader {
+	switch from {
+	case "wrapped":
+		return &unwrapReader{lines: lines, delimiter: delimiter, escapeDelim: escapeDelim}
+	case "tsv":
+		return &unwrapReader{lines: lines, tsv: true}
+	case "csv":
+		r := csv.NewReader(input)
+		r.FieldsPerRecord = -1
+		return &csvRowReader{reader: r}
+	case "json":
+		return &jsonArrayReader{decoder: json.NewDecoder(input)}
+	}
+	return lines
+}
+
+// unwrapReader reverses the delimiter-wrapped output, or the escaping of a
+// TSV column, one record per line.
+type unwrapReader struct {
+	lines       recordReader
+	delimiter   string
+	escapeDelim bool
+	tsv         bool
+	line        int
+}
+
+func (r *unwrapReader) Next() ([]byte, error) {
+	line, err := r.lines.Next()
+	if err != nil {
+		return nil, err
+	}
+	r.line++
+	inner, err := unwrapLine(line, r.delimiter, r.escapeDelim)
+	if err == nil && r.tsv {
+		inner, err = unescapeTSV(inner)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", r.line, err)
+	}
+	return inner, nil
+}
+
+// unescapeTSV reverses the backslash escapes written by -tsv.
+func unescapeTSV(s []byte) ([]byte, error) {
+	if bytes.IndexByte(s, '\\') < 0 {
+		return s, nil
+	}
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return nil, errors.New("line ends with an unfinished escape")
+		}
+		switch s[i] {
+		case '\\':
+			out = append(out, '\\')
+		case 't':
+			out = append(out, '\t')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		default:
+			return nil, fmt.Errorf("unknown escape '\\%c'", s[i])
+		}
+	}
+	return out, nil
+}
+
+// csvRowReader reads a CSV list, one value per row.
+type csvRowReader struct {
+	reader *csv.Reader
+	row    int
+}
+
+func (r *csvRowReader) Next() ([]byte, error) {
+	fields, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.row++
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("CSV row %d has %d fields, not 1; use -from-csv-column to read one column of a table", r.row, len(fields))
+	}
+	return []byte(fields[0]), nil
+}
+
+// jsonArrayReader reads the strings of a JSON array, one at a time, so the
+// whole array is never held in memory.
+type jsonArrayReader struct {
+	decoder *json.Decoder
+	started bool
+	count   int
+}
+
+func (r *jsonArrayReader) Next() ([]byte, error) {
+	if !r.started {
+		r.started = true
+		if tok, err := r.decoder.Token(); err != nil || tok != json.Delim('[') {
+			return nil, errors.New("JSON input must be an array of strings")
+		}
+	}
+	if !r.decoder.More() {
+		if _, err := r.decoder.Token(); err != nil {
+			return nil, fmt.Errorf("invalid JSON after element %d: %w", r.count, err)
+		}
+		if _, err := r.decoder.Token(); err != io.EOF {
+			return nil, errors.New("unexpected data after the JSON array")
+		}
+		return nil, io.EOF
+	}
+	var s string
+	if err := r.decoder.Decode(&s); err != nil {
+		return nil, fmt.Errorf("JSON element %d is not a string: %w", r.count+1, err)
+	}
+	r.count++
+	return []byte(s), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+)
+
+// decompressMethods lists the values accepted by -decompress.
+var decompressMethods = []string{"auto", "gzip", "bzip2", "none"}
+
+// compressionMagic identifies compressed input by its first bytes, for
+// -decompress auto. zstd and xz are recognized only to report that they
+// cannot be read, as the standard library has no decoder for them.
+var compressionMagic = []struct {
+	method string
+	magic  []byte
+}{
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"bzip2", []byte("BZh")}, // checked further by isBzip2
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// openDecompressed returns a reader for the decompressed contents of r, and
+// the compression method used: method itself, or with "auto" the one the
+// first bytes of r identify, or "none" if they identify none.
+func openDecompressed(r *bufio.Reader, method string) (*bufio.Reader, string, error) {
+	if method == "auto" {
+		method = "none"
+		for _, c := range compressionMagic {
+			if head, _ := r.Peek(len(c.magic)); bytes.Equal(head, c.magic) {
+				if c.method == "bzip2" && !isBzip2(r) {
+					continue
+				}
+				method = c.method
+				break
+			}
+		}
+	}
+	switch method {
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, method, fmt.Errorf("invalid gzip input: %w", err)
+		}
+		return bufio.NewReader(gz), method, nil
+	case "bzip2":
+		return bufio.NewReader(bzip2.NewReader(r)), method, nil
+	case "zstd", "xz":
+		return nil, method, fmt.Errorf("%s-compressed input is not supported; decompress it first, e.g. with '%s -dc'", method, method)
+	}
+	return r, method, nil
+}
+
+// isBzip2 reports whether r starts with a bzip2 stream header: "BZh", the
+// block size digit, then the magic of the first block or of the end of an
+// empty stream. Plain text can start with "BZh", but not with all of these.
+func isBzip2(r *bufio.Reader) bool {
+	head, _ := r.Peek(10)
+	if len(head) < 10 || head[3] < '1' || head[3] > '9' {
+		return false
+	}
+	magic := head[4:]
+	return bytes.Equal(magic, []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}) ||
+		bytes.Equal(magic, []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// inputEncodings lists the values accepted by -encoding.
+var inputEncodings = []string{"utf-8", "utf-16", "utf-16le", "utf-16be", "latin-1", "shift-jis"}
+
+// newDecoder returns the decoder for an -encoding. "utf-16" uses the byte
+// order mark at the start of the input, if any, and little-endian otherwise.
+// Invalid sequences become U+FFFD. A decoder keeps state, so each input
+// needs its own.
+func newDecoder(name string) (*encoding.Decoder, error) {
+	var enc encoding.Encoding
+	switch strings.ToLower(name) {
+	case "utf-16le":
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case "utf-16be":
+		enc = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case "utf-16":
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case "latin-1", "latin1", "iso-8859-1":
+		enc = charmap.ISO8859_1
+	case "shift-jis", "shift_jis", "sjis":
+		enc = japanese.ShiftJIS
+	default:
+		return nil, fmt.Errorf("unknown encoding '%s' (supported: %s)", name, strings.Join(inputEncodings, ", "))
+	}
+	return enc.NewDecoder(), nil
+}
+
+// newDecodingReader returns a reader of src converted to UTF-8 by decoder,
+// dropping a byte order mark at the start.
+func newDecodingReader(src io.Reader, decoder *encoding.Decoder) *bufio.Reader {
+	reader := bufio.NewReader(transform.NewReader(src, decoder))
+	bom := []byte("\ufeff")
+	if head, _ := reader.Peek(len(bom)); bytes.Equal(head, bom) {
+		reader.Discard(len(bom))
+	}
+	return reader
+}
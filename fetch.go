@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fetchConfig holds the settings for reading input from HTTP URLs.
+type fetchConfig struct {
+	retries int
+	backoff time.Duration
+	timeout time.Duration
+}
+
+// isURL reports whether an input name is an HTTP or HTTPS URL rather than a
+// file.
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// newFetchClient returns a client whose timeout applies to connecting and
+// waiting for the response headers, but not to reading the body, which may
+// stream for as long as the server keeps sending.
+func newFetchClient(cfg fetchConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: cfg.timeout}).DialContext
+	transport.TLSHandshakeTimeout = cfg.timeout
+	transport.ResponseHeaderTimeout = cfg.timeout
+	return &http.Client{Transport: transport}
+}
+
+// openURL GETs url and returns the response body. Network errors, 429, and
+// 5xx responses are retried with exponential backoff; once the body starts
+// arriving, it is read as is.
+func openURL(client *http.Client, url string, cfg fetchConfig) (io.ReadCloser, error) {
+	delay := cfg.backoff
+	var err error
+	for attempt := 0; attempt <= cfg.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		var body io.ReadCloser
+		var retryAfter time.Duration
+		body, retryAfter, err = fetch(client, url)
+		if err == nil {
+			return body, nil
+		}
+		if errors.Is(err, errPermanent) {
+			break
+		}
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+	}
+	return nil, fmt.Errorf("failed to fetch '%s': %w", url, err)
+}
+
+// fetch makes a single GET request. It returns the server's Retry-After
+// hint, if any, along with the error.
+func fetch(client *http.Client, url string) (io.ReadCloser, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.Body, 0, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		var retryAfter time.Duration
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, retryAfter, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return nil, 0, fmt.Errorf("%w: server returned %s", errPermanent, resp.Status)
+}
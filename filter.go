@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// recordFilter reports whether a record should be kept.
+type recordFilter func(line []byte) bool
+
+// lineSet matches records against exact strings and regular expressions.
+type lineSet struct {
+	exact   map[string]struct{}
+	regexps []*regexp.Regexp
+}
+
+// loadLineSet reads a list file with one entry per line. Entries prefixed
+// with "re:" are regular expressions; all others must match a record exactly.
+// Blank lines are ignored and a trailing carriage return is removed.
+func loadLineSet(filename string) (*lineSet, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open list file: %w", err)
+	}
+	defer file.Close()
+
+	set := &lineSet{exact: make(map[string]struct{})}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		entry := strings.TrimSuffix(scanner.Text(), "\r")
+		if entry == "" {
+			continue
+		}
+		if pattern, ok := strings.CutPrefix(entry, "re:"); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("list file %s:%d: invalid regular expression: %w", filename, lineNum, err)
+			}
+			set.regexps = append(set.regexps, re)
+			continue
+		}
+		set.exact[entry] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read list file %s: %w", filename, err)
+	}
+	return set, nil
+}
+
+// contains reports whether line matches any entry in the set.
+func (s *lineSet) contains(line []byte) bool {
+	if _, ok := s.exact[string(line)]; ok {
+		return true
+	}
+	for _, re := range s.regexps {
+		if re.Match(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// followPoll is how often -follow-name checks a file that has no new data.
+const followPoll = 250 * time.Millisecond
+
+// followReader reads a file by name as it grows, like 'tail -F'. At the end of
+// the data it waits for more instead of returning io.EOF. When the name is
+// given to a new file, as log rotation does, it reopens it once the old file
+// has been read to its end; when the file shrinks, it reads again from the
+// start. A missing file is waited for.
+type followReader struct {
+	name   string
+	file   *os.File
+	offset int64
+	notes  io.Writer // where reopening is reported; nil for nowhere
+}
+
+// newFollowReader opens name to be read as it grows. Reopening is reported
+// to notes, if not nil.
+func newFollowReader(name string, notes io.Writer) (*followReader, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file '%s': %w", name, err)
+	}
+	return &followReader{name: name, file: file, notes: notes}, nil
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if err := r.check(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// check is called at the end of the data. It reopens or rewinds the file if
+// it was rotated or truncated, and otherwise waits before the next read.
+func (r *followReader) check() error {
+	current, err := r.file.Stat()
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(r.name)
+	switch {
+	case err != nil:
+		// Rotated away and not yet recreated
+	case !os.SameFile(info, current):
+		file, err := os.Open(r.name)
+		if err != nil {
+			break
+		}
+		r.note("was replaced; reopening")
+		r.file.Close()
+		r.file, r.offset = file, 0
+		return nil
+	case current.Size() < r.offset:
+		r.note("was truncated; reading from the start")
+		if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r.offset = 0
+		return nil
+	}
+	time.Sleep(followPoll)
+	return nil
+}
+
+func (r *followReader) note(what string) {
+	if r.notes != nil {
+		fmt.Fprintf(r.notes, "%s: '%s' %s\n", pgmName, r.name, what)
+	}
+}
+
+func (r *followReader) Close() error {
+	return r.file.Close()
+}
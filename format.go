@@ -0,0 +1,1438 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+// recordMeta describes where a record came from.
+type recordMeta struct {
+	num    int      // 1-based position of the record in the input
+	source string   // input filename, or "-" for STDIN
+	row    []string // with -csv-in or -tsv-in, the fields of the row the record came from
+}
+
+// formatter renders records to the output. Begin is called once before the
+// first record and End once after the last, even when there are no records.
+// A formatter may be restarted with Begin after End, as -split-lines does
+// for each output file.
+type formatter interface {
+	Begin(w *bufio.Writer) error
+	Record(w *bufio.Writer, line []byte, meta recordMeta) error
+	End(w *bufio.Writer) error
+}
+
+// delimiterFormatter wraps each record with a delimiter, one record per line.
+type delimiterFormatter struct {
+	delimiter   string
+	terminator  string
+	escapeDelim bool
+	outputBuf   []byte
+}
+
+// newDelimiterFormatter returns the default formatter, which ends each
+// record with terminator.
+func newDelimiterFormatter(delimiter, terminator string, escapeDelim bool) *delimiterFormatter {
+	// Create reusable output buffer to avoid allocations per line
+	return &delimiterFormatter{delimiter: delimiter, terminator: terminator, escapeDelim: escapeDelim, outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *delimiterFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *delimiterFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	return processLine(w, line, f.delimiter, f.terminator, f.escapeDelim, &f.outputBuf)
+}
+
+func (f *delimiterFormatter) End(w *bufio.Writer) error { return nil }
+
+// kvFormatter emits records as numbered key=value lines, such as the
+// entries of an environment or properties file, optionally under an INI
+// section header. Values are wrapped like the default output.
+type kvFormatter struct {
+	prefix      string
+	numFormat   string
+	section     string
+	delimiter   string
+	escapeDelim bool
+	count       int
+	outputBuf   []byte
+}
+
+// newKVFormatter returns a formatter for -kv. numFormat is a printf format
+// for the key's number, such as "%d" or "_%03d".
+func newKVFormatter(prefix, numFormat, section, delimiter string, escapeDelim bool) (*kvFormatter, error) {
+	if strings.ContainsAny(prefix, "=[]\n\r") {
+		return nil, fmt.Errorf("invalid key prefix '%s': must not contain '=', brackets, or line breaks", prefix)
+	}
+	if strings.ContainsAny(section, "[]\n\r") {
+		return nil, fmt.Errorf("invalid INI section name '%s': must not contain brackets or line breaks", section)
+	}
+	one, two := fmt.Sprintf(numFormat, 1), fmt.Sprintf(numFormat, 2)
+	if strings.Contains(one, "%!") || one == two || strings.ContainsAny(one, "=\n\r") {
+		return nil, fmt.Errorf("invalid number format '%s': must contain one integer verb such as %%d", numFormat)
+	}
+	return &kvFormatter{
+		prefix:      prefix,
+		numFormat:   numFormat,
+		section:     section,
+		delimiter:   delimiter,
+		escapeDelim: escapeDelim,
+		outputBuf:   make([]byte, 0, 1024),
+	}, nil
+}
+
+func (f *kvFormatter) Begin(w *bufio.Writer) error {
+	if f.section == "" {
+		return nil
+	}
+	_, err := w.WriteString("[" + f.section + "]\n")
+	return err
+}
+
+func (f *kvFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.count++
+	f.outputBuf = append(f.outputBuf[:0], f.prefix...)
+	f.outputBuf = fmt.Appendf(f.outputBuf, f.numFormat, f.count)
+	f.outputBuf = append(f.outputBuf, '=')
+	if _, err := w.Write(f.outputBuf); err != nil {
+		return err
+	}
+	return processLine(w, line, f.delimiter, "\n", f.escapeDelim, &f.outputBuf)
+}
+
+func (f *kvFormatter) End(w *bufio.Writer) error { return nil }
+
+// envName matches a variable name accepted by shells and dotenv parsers.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// dotenvFormatter emits records as KEY=value lines for dotenv files, with
+// keys made from a template containing {n}. Values are single-quoted, which
+// every dotenv parser reads literally; values containing a single quote or a
+// line break are double-quoted with backslash escapes instead, including for
+// $ and backticks so that they are not expanded. For docker --env-file,
+// which does not remove quotes, values are written raw.
+type dotenvFormatter struct {
+	keyBefore string
+	keyAfter  string
+	docker    bool
+	count     int
+	outputBuf []byte
+}
+
+// newDotenvFormatter returns a formatter for -dotenv.
+func newDotenvFormatter(template string, docker bool) (*dotenvFormatter, error) {
+	before, after, ok := strings.Cut(template, "{n}")
+	if !ok || strings.Contains(after, "{n}") || !envName.MatchString(before+"1"+after) {
+		return nil, fmt.Errorf("invalid -dotenv key template '%s': must contain {n} once and otherwise only letters, digits, and underscores, not starting with a digit", template)
+	}
+	return &dotenvFormatter{keyBefore: before, keyAfter: after, docker: docker, outputBuf: make([]byte, 0, 1024)}, nil
+}
+
+func (f *dotenvFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *dotenvFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	if bytes.IndexByte(line, 0) >= 0 {
+		return fmt.Errorf("record %d contains a NUL byte, which environment variables cannot hold", meta.num)
+	}
+	f.count++
+	f.outputBuf = append(f.outputBuf[:0], f.keyBefore...)
+	f.outputBuf = strconv.AppendInt(f.outputBuf, int64(f.count), 10)
+	f.outputBuf = append(f.outputBuf, f.keyAfter...)
+	f.outputBuf = append(f.outputBuf, '=')
+
+	switch {
+	case f.docker:
+		if bytes.ContainsAny(line, "\r\n") {
+			return fmt.Errorf("record %d contains a line break, which docker --env-file cannot represent", meta.num)
+		}
+		f.outputBuf = append(f.outputBuf, line...)
+	case !bytes.ContainsAny(line, "'\r\n"):
+		f.outputBuf = append(f.outputBuf, '\'')
+		f.outputBuf = append(f.outputBuf, line...)
+		f.outputBuf = append(f.outputBuf, '\'')
+	default:
+		f.outputBuf = append(f.outputBuf, '"')
+		for _, c := range line {
+			switch c {
+			case '\\', '"', '$', '`':
+				f.outputBuf = append(f.outputBuf, '\\', c)
+			case '\n':
+				f.outputBuf = append(f.outputBuf, "\\n"...)
+			case '\r':
+				f.outputBuf = append(f.outputBuf, "\\r"...)
+			default:
+				f.outputBuf = append(f.outputBuf, c)
+			}
+		}
+		f.outputBuf = append(f.outputBuf, '"')
+	}
+	f.outputBuf = append(f.outputBuf, '\n')
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *dotenvFormatter) End(w *bufio.Writer) error { return nil }
+
+// httpToken matches an HTTP header name.
+var httpToken = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// curlFormatter emits records as curl command-line arguments, one option
+// and its shell-quoted value per line, for use with xargs or $(...). With
+// headers, each record must be a "Name: value" header.
+type curlFormatter struct {
+	option    string
+	headers   bool
+	outputBuf []byte
+}
+
+// newCurlFormatter returns a formatter for -curl-h (headers) or -curl-d.
+func newCurlFormatter(headers bool) *curlFormatter {
+	option := "-d"
+	if headers {
+		option = "-H"
+	}
+	return &curlFormatter{option: option, headers: headers, outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *curlFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *curlFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	if bytes.ContainsAny(line, "\x00\r\n") {
+		return fmt.Errorf("record %d contains a NUL byte or line break, which cannot be passed through xargs", meta.num)
+	}
+	if f.headers {
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		name = bytes.TrimSpace(name)
+		if !ok || !httpToken.Match(name) {
+			return fmt.Errorf("record %d is not a header: expected 'Name: value'", meta.num)
+		}
+		line = fmt.Appendf(nil, "%s: %s", name, bytes.TrimSpace(value))
+	}
+
+	f.outputBuf = append(f.outputBuf[:0], f.option...)
+	f.outputBuf = append(f.outputBuf, ' ')
+	f.outputBuf = appendShellQuoted(f.outputBuf, line)
+	f.outputBuf = append(f.outputBuf, '\n')
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *curlFormatter) End(w *bufio.Writer) error { return nil }
+
+// appendShellQuoted appends s to buf as a single-quoted POSIX shell word,
+// writing embedded single quotes as '\”. xargs reads the same quoting.
+func appendShellQuoted(buf []byte, s []byte) []byte {
+	buf = append(buf, '\'')
+	for _, c := range s {
+		if c == '\'' {
+			buf = append(buf, `'\''`...)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, '\'')
+}
+
+// joinFormatter emits all records wrapped on a single line, separated by
+// sep, like paste -s. A header and footer may open and close the line.
+// Records are written as they arrive.
+type joinFormatter struct {
+	delimiter   string
+	escapeDelim bool
+	sep         string
+	header      string
+	footer      string
+	count       int
+	outputBuf   []byte
+}
+
+// newJoinFormatter returns a formatter for -join.
+func newJoinFormatter(delimiter string, escapeDelim bool, sep, header, footer string) *joinFormatter {
+	return &joinFormatter{
+		delimiter:   delimiter,
+		escapeDelim: escapeDelim,
+		sep:         sep,
+		header:      header,
+		footer:      footer,
+		outputBuf:   make([]byte, 0, 1024),
+	}
+}
+
+func (f *joinFormatter) Begin(w *bufio.Writer) error {
+	f.count = 0
+	_, err := w.WriteString(f.header)
+	return err
+}
+
+func (f *joinFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = f.outputBuf[:0]
+	if f.count > 0 {
+		f.outputBuf = append(f.outputBuf, f.sep...)
+	}
+	f.outputBuf = appendWrapped(f.outputBuf, line, f.delimiter, f.escapeDelim)
+	f.count++
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+// End closes the line. Empty input produces no output unless there is a
+// header or footer.
+func (f *joinFormatter) End(w *bufio.Writer) error {
+	if f.count == 0 && f.header == "" && f.footer == "" {
+		return nil
+	}
+	_, err := w.WriteString(f.footer + "\n")
+	return err
+}
+
+// columnsFormatter packs n wrapped records per output line, separated by
+// sep. Rows are written as they fill, unless align is set: then every
+// record is held until the end so that each column can be padded to its
+// widest value. With trailing, every row but the last ends with the
+// separator (trailing whitespace trimmed), as initializer lists expect.
+type columnsFormatter struct {
+	delimiter   string
+	escapeDelim bool
+	n           int
+	sep         string
+	align       bool
+	trailing    bool
+	inRow       int
+	cells       [][]byte
+	outputBuf   []byte
+}
+
+// newColumnsFormatter returns a formatter for -columns.
+func newColumnsFormatter(delimiter string, escapeDelim bool, n int, sep string, align, trailing bool) *columnsFormatter {
+	return &columnsFormatter{
+		delimiter:   delimiter,
+		escapeDelim: escapeDelim,
+		n:           n,
+		sep:         sep,
+		align:       align,
+		trailing:    trailing,
+		outputBuf:   make([]byte, 0, 1024),
+	}
+}
+
+func (f *columnsFormatter) Begin(w *bufio.Writer) error {
+	f.inRow = 0
+	f.cells = f.cells[:0]
+	return nil
+}
+
+func (f *columnsFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	if f.align {
+		f.cells = append(f.cells, appendWrapped(nil, line, f.delimiter, f.escapeDelim))
+		return nil
+	}
+	f.outputBuf = f.appendSep(f.outputBuf[:0])
+	f.outputBuf = appendWrapped(f.outputBuf, line, f.delimiter, f.escapeDelim)
+	f.inRow++
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+// appendSep appends what goes before the next cell: the separator within a
+// row, or the end of the previous row.
+func (f *columnsFormatter) appendSep(buf []byte) []byte {
+	switch {
+	case f.inRow == f.n:
+		if f.trailing {
+			buf = append(buf, strings.TrimRight(f.sep, " \t")...)
+		}
+		buf = append(buf, '\n')
+		f.inRow = 0
+	case f.inRow > 0:
+		buf = append(buf, f.sep...)
+	}
+	return buf
+}
+
+func (f *columnsFormatter) End(w *bufio.Writer) error {
+	if f.align {
+		widths := make([]int, f.n)
+		for i, cell := range f.cells {
+			widths[i%f.n] = max(widths[i%f.n], displayWidth(cell))
+		}
+		for i, cell := range f.cells {
+			// Pad after the separator so that this cell lines up
+			f.outputBuf = f.appendSep(f.outputBuf[:0])
+			if f.inRow > 0 {
+				pad := widths[f.inRow-1] - displayWidth(f.cells[i-1])
+				f.outputBuf = append(f.outputBuf, strings.Repeat(" ", pad)...)
+			}
+			f.outputBuf = append(f.outputBuf, cell...)
+			f.inRow++
+			if _, err := w.Write(f.outputBuf); err != nil {
+				return err
+			}
+		}
+	}
+	if f.inRow == 0 {
+		return nil
+	}
+	return w.WriteByte('\n')
+}
+
+// framedFormatter writes a header line before, and a footer line after, the
+// output of another formatter. An empty header or footer is omitted.
+type framedFormatter struct {
+	inner  formatter
+	header string
+	footer string
+}
+
+// newFramedFormatter returns a formatter for -header and -footer.
+func newFramedFormatter(inner formatter, header, footer string) *framedFormatter {
+	return &framedFormatter{inner: inner, header: header, footer: footer}
+}
+
+func (f *framedFormatter) Begin(w *bufio.Writer) error {
+	if f.header != "" {
+		if _, err := w.WriteString(f.header + "\n"); err != nil {
+			return err
+		}
+	}
+	return f.inner.Begin(w)
+}
+
+func (f *framedFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	return f.inner.Record(w, line, meta)
+}
+
+func (f *framedFormatter) End(w *bufio.Writer) error {
+	if err := f.inner.End(w); err != nil {
+		return err
+	}
+	if f.footer == "" {
+		return nil
+	}
+	_, err := w.WriteString(f.footer + "\n")
+	return err
+}
+
+// unterminatedFormatter drops the terminator that ends the output of
+// another formatter. The last bytes written are held back until more output
+// follows, since until End it is not known which terminator is the last.
+type unterminatedFormatter struct {
+	inner      formatter
+	terminator []byte
+	held       []byte
+	buf        bytes.Buffer
+	scratch    *bufio.Writer
+}
+
+// newUnterminatedFormatter returns a formatter for -no-final-newline, where
+// inner ends its output with terminator.
+func newUnterminatedFormatter(inner formatter, terminator string) *unterminatedFormatter {
+	f := &unterminatedFormatter{inner: inner, terminator: []byte(terminator)}
+	f.scratch = bufio.NewWriter(&f.buf)
+	return f
+}
+
+// render writes what fn writes to w, except for the final bytes that could
+// be the terminator.
+func (f *unterminatedFormatter) render(w *bufio.Writer, fn func(*bufio.Writer) error) error {
+	f.buf.Reset()
+	f.buf.Write(f.held)
+	if err := fn(f.scratch); err != nil {
+		return err
+	}
+	if err := f.scratch.Flush(); err != nil {
+		return err
+	}
+	data := f.buf.Bytes()
+	keep := len(data) - min(len(f.terminator), len(data))
+	f.held = append(f.held[:0], data[keep:]...)
+	_, err := w.Write(data[:keep])
+	return err
+}
+
+func (f *unterminatedFormatter) Begin(w *bufio.Writer) error {
+	f.held = f.held[:0]
+	return f.render(w, f.inner.Begin)
+}
+
+func (f *unterminatedFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	return f.render(w, func(w *bufio.Writer) error { return f.inner.Record(w, line, meta) })
+}
+
+func (f *unterminatedFormatter) End(w *bufio.Writer) error {
+	if err := f.render(w, f.inner.End); err != nil {
+		return err
+	}
+	if bytes.Equal(f.held, f.terminator) {
+		return nil
+	}
+	_, err := w.Write(f.held)
+	return err
+}
+
+// crlfFormatter ends the lines written by another formatter with \r\n
+// instead of \n, as unix2dos does. Line breaks that already have a \r are
+// left alone.
+type crlfFormatter struct {
+	inner     formatter
+	cr        bool // the last byte written was \r
+	buf       bytes.Buffer
+	scratch   *bufio.Writer
+	outputBuf []byte
+}
+
+// newCRLFFormatter returns a formatter for -crlf.
+func newCRLFFormatter(inner formatter) *crlfFormatter {
+	f := &crlfFormatter{inner: inner, outputBuf: make([]byte, 0, 1024)}
+	f.scratch = bufio.NewWriter(&f.buf)
+	return f
+}
+
+// render writes what fn writes to w, with \n replaced by \r\n.
+func (f *crlfFormatter) render(w *bufio.Writer, fn func(*bufio.Writer) error) error {
+	f.buf.Reset()
+	if err := fn(f.scratch); err != nil {
+		return err
+	}
+	if err := f.scratch.Flush(); err != nil {
+		return err
+	}
+	f.outputBuf = f.outputBuf[:0]
+	for _, c := range f.buf.Bytes() {
+		if c == '\n' && !f.cr {
+			f.outputBuf = append(f.outputBuf, '\r')
+		}
+		f.outputBuf = append(f.outputBuf, c)
+		f.cr = c == '\r'
+	}
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *crlfFormatter) Begin(w *bufio.Writer) error {
+	f.cr = false
+	return f.render(w, f.inner.Begin)
+}
+
+func (f *crlfFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	return f.render(w, func(w *bufio.Writer) error { return f.inner.Record(w, line, meta) })
+}
+
+func (f *crlfFormatter) End(w *bufio.Writer) error {
+	return f.render(w, f.inner.End)
+}
+
+// paddedFormatter pads each line rendered by a one-line-per-record inner
+// formatter to a fixed number of bytes, not counting the terminator.
+type paddedFormatter struct {
+	inner      formatter
+	width      int
+	pad        byte
+	terminator string
+	buf        bytes.Buffer
+	scratch    *bufio.Writer
+	outputBuf  []byte
+}
+
+// newPaddedFormatter returns a formatter for -record-width. The inner
+// formatter ends each line with terminator.
+func newPaddedFormatter(inner formatter, width int, pad byte, terminator string) *paddedFormatter {
+	f := &paddedFormatter{inner: inner, width: width, pad: pad, terminator: terminator, outputBuf: make([]byte, 0, width+len(terminator))}
+	f.scratch = bufio.NewWriter(&f.buf)
+	return f
+}
+
+func (f *paddedFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *paddedFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.buf.Reset()
+	if err := f.inner.Record(f.scratch, line, meta); err != nil {
+		return err
+	}
+	if err := f.scratch.Flush(); err != nil {
+		return err
+	}
+
+	rendered := bytes.TrimSuffix(f.buf.Bytes(), []byte(f.terminator))
+	if len(rendered) > f.width {
+		return fmt.Errorf("record %d is %d bytes when wrapped, longer than the record width %d", meta.num, len(rendered), f.width)
+	}
+	f.outputBuf = append(f.outputBuf[:0], rendered...)
+	for len(f.outputBuf) < f.width {
+		f.outputBuf = append(f.outputBuf, f.pad)
+	}
+	f.outputBuf = append(f.outputBuf, f.terminator...)
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *paddedFormatter) End(w *bufio.Writer) error { return nil }
+
+// jsonFormatter emits records as a JSON array of strings, one element per
+// line. Elements are written as they arrive, so output is fully streamed.
+type jsonFormatter struct {
+	count     int
+	outputBuf []byte
+}
+
+// newJSONFormatter returns a formatter for -json.
+func newJSONFormatter() *jsonFormatter {
+	return &jsonFormatter{outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *jsonFormatter) Begin(w *bufio.Writer) error {
+	f.count = 0
+	_, err := w.WriteString("[")
+	return err
+}
+
+func (f *jsonFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = f.outputBuf[:0]
+	if f.count > 0 {
+		f.outputBuf = append(f.outputBuf, ',')
+	}
+	f.outputBuf = append(f.outputBuf, "\n  "...)
+	f.outputBuf = appendJSONString(f.outputBuf, line)
+	f.count++
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *jsonFormatter) End(w *bufio.Writer) error {
+	if f.count == 0 {
+		_, err := w.WriteString("]\n")
+		return err
+	}
+	_, err := w.WriteString("\n]\n")
+	return err
+}
+
+// appendJSONString appends s to buf as a quoted JSON string.
+func appendJSONString(buf []byte, s []byte) []byte {
+	buf = append(buf, '"')
+	buf = appendJSONEscaped(buf, s)
+	return append(buf, '"')
+}
+
+// appendJSONEscaped appends the contents of a JSON string holding s to buf,
+// without the surrounding quotes.
+func appendJSONEscaped(buf []byte, s []byte) []byte {
+	return appendJSEscaped(buf, s, '"')
+}
+
+// appendJSEscaped appends the contents of a string literal quoted with quote
+// to buf, without the surrounding quotes. Control characters, the quote
+// character, and backslashes are escaped, as are U+2028 and U+2029 so the
+// output is also valid JavaScript. Invalid UTF-8 is replaced with U+FFFD,
+// since JSON text must be valid UTF-8.
+func appendJSEscaped(buf []byte, s []byte, quote byte) []byte {
+	const hexDigits = "0123456789abcdef"
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == quote || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c == '\b':
+				buf = append(buf, '\\', 'b')
+			case c == '\f':
+				buf = append(buf, '\\', 'f')
+			case c < 0x20 || c == 0x7F:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf = append(buf, "\ufffd"...)
+		case r == '\u2028':
+			buf = append(buf, `\u2028`...)
+		case r == '\u2029':
+			buf = append(buf, `\u2029`...)
+		default:
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return buf
+}
+
+// jsFormatter emits records as a JavaScript (or JSON5) array literal of
+// strings, with a choice of quote character and an optional trailing comma.
+type jsFormatter struct {
+	quote         byte
+	trailingComma bool
+	count         int
+	outputBuf     []byte
+}
+
+// newJSFormatter returns a formatter for -js.
+func newJSFormatter(quote byte, trailingComma bool) *jsFormatter {
+	return &jsFormatter{quote: quote, trailingComma: trailingComma, outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *jsFormatter) Begin(w *bufio.Writer) error {
+	f.count = 0
+	_, err := w.WriteString("[")
+	return err
+}
+
+func (f *jsFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = f.outputBuf[:0]
+	if f.count > 0 {
+		f.outputBuf = append(f.outputBuf, ',')
+	}
+	f.outputBuf = append(f.outputBuf, "\n  "...)
+	f.outputBuf = append(f.outputBuf, f.quote)
+	f.outputBuf = appendJSEscaped(f.outputBuf, line, f.quote)
+	f.outputBuf = append(f.outputBuf, f.quote)
+	f.count++
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *jsFormatter) End(w *bufio.Writer) error {
+	switch {
+	case f.count == 0:
+		_, err := w.WriteString("]\n")
+		return err
+	case f.trailingComma:
+		_, err := w.WriteString(",\n]\n")
+		return err
+	}
+	_, err := w.WriteString("\n]\n")
+	return err
+}
+
+// jsonStringFormatter emits the whole input as a single JSON string, with
+// each record followed by its terminator. The string is streamed as records
+// arrive.
+type jsonStringFormatter struct {
+	terminator []byte
+	outputBuf  []byte
+}
+
+// newJSONStringFormatter returns a formatter for -format json-string.
+func newJSONStringFormatter(terminator string) *jsonStringFormatter {
+	return &jsonStringFormatter{terminator: []byte(terminator), outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *jsonStringFormatter) Begin(w *bufio.Writer) error {
+	return w.WriteByte('"')
+}
+
+func (f *jsonStringFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = appendJSONEscaped(f.outputBuf[:0], line)
+	f.outputBuf = appendJSONEscaped(f.outputBuf, f.terminator)
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *jsonStringFormatter) End(w *bufio.Writer) error {
+	_, err := w.WriteString("\"\n")
+	return err
+}
+
+// csvColumns lists the columns that -csv-cols accepts.
+var csvColumnNames = []string{"num", "file", "line"}
+
+// parseCSVColumns validates a comma-separated list of CSV column names.
+func parseCSVColumns(arg string) ([]string, error) {
+	var cols []string
+	seen := make(map[string]bool)
+	for _, col := range strings.Split(arg, ",") {
+		col = strings.TrimSpace(col)
+		if !slices.Contains(csvColumnNames, col) {
+			return nil, fmt.Errorf("unknown CSV column '%s' (supported: %s)", col, strings.Join(csvColumnNames, ", "))
+		}
+		if seen[col] {
+			return nil, fmt.Errorf("duplicate CSV column '%s'", col)
+		}
+		seen[col] = true
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// csvFormatter emits records as an RFC 4180 CSV file. Fields are quoted only
+// when needed, with embedded quotes doubled. By default the only column is
+// the line itself; metadata columns can be added with -csv-cols.
+type csvFormatter struct {
+	columns []string
+	useCRLF bool
+	writer  *csv.Writer
+	fields  []string
+}
+
+// newCSVFormatter returns a formatter for -csv that writes the given columns.
+// When useCRLF is set, records are terminated with \r\n as RFC 4180 specifies.
+func newCSVFormatter(columns []string, useCRLF bool) *csvFormatter {
+	return &csvFormatter{columns: columns, useCRLF: useCRLF, fields: make([]string, len(columns))}
+}
+
+func (f *csvFormatter) Begin(w *bufio.Writer) error {
+	// csv.NewWriter reuses w directly since it is already a bufio.Writer,
+	// so records written through either writer stay in order
+	f.writer = csv.NewWriter(w)
+	f.writer.UseCRLF = f.useCRLF
+	return nil
+}
+
+func (f *csvFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	if len(f.columns) == 1 && f.columns[0] == "line" && len(line) == 0 {
+		// An unquoted empty field would be a blank line, which CSV readers skip
+		terminator := "\n"
+		if f.useCRLF {
+			terminator = "\r\n"
+		}
+		_, err := w.WriteString(`""` + terminator)
+		return err
+	}
+
+	for i, col := range f.columns {
+		switch col {
+		case "num":
+			f.fields[i] = strconv.Itoa(meta.num)
+		case "file":
+			f.fields[i] = meta.source
+		case "line":
+			f.fields[i] = string(line)
+		}
+	}
+	return f.writer.Write(f.fields)
+}
+
+func (f *csvFormatter) End(w *bufio.Writer) error {
+	f.writer.Flush()
+	return f.writer.Error()
+}
+
+// tsvFormatter emits one wrapped value per line with content escaped in the
+// text format used by PostgreSQL COPY and BigQuery TSV loads: backslash, tab,
+// newline, and carriage return become \\, \t, \n, and \r.
+type tsvFormatter struct {
+	delimiter string
+	outputBuf []byte
+}
+
+// newTSVFormatter returns a formatter for -tsv. An empty delimiter writes
+// the escaped values as they are.
+func newTSVFormatter(delimiter string) *tsvFormatter {
+	return &tsvFormatter{delimiter: delimiter, outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *tsvFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *tsvFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = append(f.outputBuf[:0], f.delimiter...)
+	for _, c := range line {
+		switch c {
+		case '\\':
+			f.outputBuf = append(f.outputBuf, '\\', '\\')
+		case '\t':
+			f.outputBuf = append(f.outputBuf, '\\', 't')
+		case '\n':
+			f.outputBuf = append(f.outputBuf, '\\', 'n')
+		case '\r':
+			f.outputBuf = append(f.outputBuf, '\\', 'r')
+		default:
+			f.outputBuf = append(f.outputBuf, c)
+		}
+	}
+	f.outputBuf = append(f.outputBuf, f.delimiter...)
+	f.outputBuf = append(f.outputBuf, '\n')
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *tsvFormatter) End(w *bufio.Writer) error { return nil }
+
+// tomlBareKey matches keys that TOML allows without quoting.
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlFormatter emits records as a TOML array assigned to a key, one element
+// per line. Strings use the same escapes as JSON, all of which are valid in
+// TOML basic strings.
+type tomlFormatter struct {
+	key       string
+	count     int
+	outputBuf []byte
+}
+
+// newTOMLFormatter returns a formatter for -toml.
+func newTOMLFormatter(key string) *tomlFormatter {
+	if !tomlBareKey.MatchString(key) {
+		key = string(appendJSONString(nil, []byte(key)))
+	}
+	return &tomlFormatter{key: key, outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *tomlFormatter) Begin(w *bufio.Writer) error {
+	f.count = 0
+	_, err := w.WriteString(f.key + " = [")
+	return err
+}
+
+func (f *tomlFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = append(f.outputBuf[:0], "\n  "...)
+	f.outputBuf = appendJSONString(f.outputBuf, line)
+	f.outputBuf = append(f.outputBuf, ',')
+	f.count++
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *tomlFormatter) End(w *bufio.Writer) error {
+	if f.count == 0 {
+		_, err := w.WriteString("]\n")
+		return err
+	}
+	_, err := w.WriteString("\n]\n")
+	return err
+}
+
+// sqlDialects maps each -sql-dialect name to whether its string literals
+// treat backslashes as escapes. Standard SQL (PostgreSQL, SQLite, SQL Server,
+// Oracle) only gives meaning to single quotes; MySQL and MariaDB, in their
+// default mode, also read backslash escapes.
+var sqlDialects = map[string]bool{"standard": false, "mysql": true}
+
+// appendSQLString appends s to buf as a single-quoted SQL string literal,
+// doubling embedded single quotes and, if backslashes is set, backslashes.
+func appendSQLString(buf []byte, s []byte, backslashes bool) []byte {
+	buf = append(buf, '\'')
+	for _, c := range s {
+		if c == '\'' || (c == '\\' && backslashes) {
+			buf = append(buf, c)
+		}
+		buf = append(buf, c)
+	}
+	return append(buf, '\'')
+}
+
+// checkSQLRecord rejects records that no SQL string literal can hold.
+func checkSQLRecord(line []byte, meta recordMeta) error {
+	if bytes.IndexByte(line, 0) >= 0 {
+		return fmt.Errorf("record %d contains a NUL byte, which a SQL string cannot hold", meta.num)
+	}
+	return nil
+}
+
+// sqlInFormatter emits records as a parenthesized SQL IN list of quoted
+// strings. With a chunk size, a new list is started on its own line every
+// chunk elements, to respect database limits on list length.
+type sqlInFormatter struct {
+	chunk       int
+	inChunk     int
+	backslashes bool
+	outputBuf   []byte
+}
+
+// newSQLInFormatter returns a formatter for -sql-in. A chunk of 0 puts all
+// elements in a single list. backslashes selects MySQL-style escaping.
+func newSQLInFormatter(chunk int, backslashes bool) *sqlInFormatter {
+	return &sqlInFormatter{chunk: chunk, backslashes: backslashes, outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *sqlInFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *sqlInFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	if err := checkSQLRecord(line, meta); err != nil {
+		return err
+	}
+	f.outputBuf = f.outputBuf[:0]
+	if f.inChunk == 0 {
+		f.outputBuf = append(f.outputBuf, '(')
+	} else {
+		f.outputBuf = append(f.outputBuf, ',')
+	}
+	f.outputBuf = appendSQLString(f.outputBuf, line, f.backslashes)
+	f.inChunk++
+	if f.chunk > 0 && f.inChunk == f.chunk {
+		f.outputBuf = append(f.outputBuf, ")\n"...)
+		f.inChunk = 0
+	}
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *sqlInFormatter) End(w *bufio.Writer) error {
+	if f.inChunk == 0 {
+		return nil
+	}
+	f.inChunk = 0
+	_, err := w.WriteString(")\n")
+	return err
+}
+
+// sqlName matches a plain or schema-qualified SQL name that is safe to emit
+// unquoted in any dialect.
+var sqlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// sqlInsertFormatter emits records as SQL INSERT statements into a single
+// column. With a batch size above 1, rows are grouped into multi-row VALUES
+// statements.
+type sqlInsertFormatter struct {
+	prefix      string
+	batchSize   int
+	inBatch     int
+	backslashes bool
+	outputBuf   []byte
+}
+
+// newSQLInsertFormatter returns a formatter for -sql-insert. table and column
+// must be valid SQL names; they are not quoted. backslashes selects
+// MySQL-style escaping.
+func newSQLInsertFormatter(table, column string, batchSize int, backslashes bool) (*sqlInsertFormatter, error) {
+	for _, name := range []string{table, column} {
+		if !sqlName.MatchString(name) {
+			return nil, fmt.Errorf("invalid SQL name '%s': use letters, digits, and underscores, optionally schema-qualified", name)
+		}
+	}
+	return &sqlInsertFormatter{
+		prefix:      fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table, column),
+		batchSize:   batchSize,
+		backslashes: backslashes,
+		outputBuf:   make([]byte, 0, 1024),
+	}, nil
+}
+
+func (f *sqlInsertFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *sqlInsertFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	if err := checkSQLRecord(line, meta); err != nil {
+		return err
+	}
+	f.outputBuf = f.outputBuf[:0]
+	if f.inBatch == 0 {
+		f.outputBuf = append(f.outputBuf, f.prefix...)
+	} else {
+		f.outputBuf = append(f.outputBuf, ", "...)
+	}
+	f.outputBuf = append(f.outputBuf, '(')
+	f.outputBuf = appendSQLString(f.outputBuf, line, f.backslashes)
+	f.outputBuf = append(f.outputBuf, ')')
+	f.inBatch++
+	if f.inBatch == f.batchSize {
+		f.outputBuf = append(f.outputBuf, ";\n"...)
+		f.inBatch = 0
+	}
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *sqlInsertFormatter) End(w *bufio.Writer) error {
+	if f.inBatch == 0 {
+		return nil
+	}
+	f.inBatch = 0
+	_, err := w.WriteString(";\n")
+	return err
+}
+
+// heredocTag matches terminator tags that need no quoting in the shell.
+var heredocTag = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// heredocFormatter emits the whole input as the body of a shell here
+// document fed to a command. The tag is quoted so that the shell performs no
+// expansion in the body. Records are held until the end of input so that a
+// tag that never appears as a line can be chosen or verified.
+type heredocFormatter struct {
+	command string
+	tag     string
+	autoTag bool
+	body    []byte
+	taken   map[string]struct{}
+}
+
+// newHeredocFormatter returns a formatter for -format heredoc. An empty tag
+// selects EOF, or EOF_1, EOF_2, ... if the input contains that line.
+func newHeredocFormatter(command, tag string) (*heredocFormatter, error) {
+	f := &heredocFormatter{command: command, tag: tag, taken: make(map[string]struct{})}
+	if tag == "" {
+		f.tag, f.autoTag = "EOF", true
+	}
+	if !heredocTag.MatchString(f.tag) {
+		return nil, fmt.Errorf("invalid heredoc tag '%s': use letters, digits, and underscores", tag)
+	}
+	return f, nil
+}
+
+func (f *heredocFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *heredocFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	if bytes.IndexByte(line, 0) >= 0 {
+		return fmt.Errorf("record %d contains a NUL byte, which a heredoc cannot hold", meta.num)
+	}
+	if bytes.IndexByte(line, '\n') >= 0 {
+		return fmt.Errorf("record %d contains a newline, which would split it in the heredoc", meta.num)
+	}
+	if bytes.HasPrefix(line, []byte(f.tag)) {
+		f.taken[string(line)] = struct{}{}
+	}
+	f.body = append(f.body, line...)
+	f.body = append(f.body, '\n')
+	return nil
+}
+
+func (f *heredocFormatter) End(w *bufio.Writer) error {
+	tag := f.tag
+	if _, found := f.taken[tag]; found {
+		if !f.autoTag {
+			return fmt.Errorf("heredoc tag '%s' appears as a line in the input; choose another -tag", tag)
+		}
+		for n := 1; found; n++ {
+			tag = fmt.Sprintf("%s_%d", f.tag, n)
+			_, found = f.taken[tag]
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "%s <<'%s'\n", f.command, tag); err != nil {
+		return err
+	}
+	if _, err := w.Write(f.body); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s\n", tag)
+	return err
+}
+
+// mdTableFormatter emits records as a Markdown table with a single line
+// column, optionally preceded by a line-number column.
+type mdTableFormatter struct {
+	withNum   bool
+	outputBuf []byte
+}
+
+// newMDTableFormatter returns a formatter for -md-table.
+func newMDTableFormatter(withNum bool) *mdTableFormatter {
+	return &mdTableFormatter{withNum: withNum, outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *mdTableFormatter) Begin(w *bufio.Writer) error {
+	header := "| line |\n| --- |\n"
+	if f.withNum {
+		header = "| # | line |\n| --: | --- |\n"
+	}
+	_, err := w.WriteString(header)
+	return err
+}
+
+func (f *mdTableFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = append(f.outputBuf[:0], "| "...)
+	if f.withNum {
+		f.outputBuf = strconv.AppendInt(f.outputBuf, int64(meta.num), 10)
+		f.outputBuf = append(f.outputBuf, " | "...)
+	}
+	f.outputBuf = appendMDCell(f.outputBuf, line)
+	f.outputBuf = append(f.outputBuf, " |\n"...)
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *mdTableFormatter) End(w *bufio.Writer) error { return nil }
+
+// appendMDCell appends s to buf as the content of a Markdown table cell.
+// Pipes and backslashes are escaped so they cannot end the cell or consume
+// the escape, and line breaks, which would end the row, become <br>.
+func appendMDCell(buf []byte, s []byte) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '|', '\\':
+			buf = append(buf, '\\', c)
+		case '\r':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+			buf = append(buf, "<br>"...)
+		case '\n':
+			buf = append(buf, "<br>"...)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// htmlListFormatter emits records as the items of an HTML unordered list.
+type htmlListFormatter struct {
+	outputBuf []byte
+}
+
+// newHTMLListFormatter returns a formatter for -html-list.
+func newHTMLListFormatter() *htmlListFormatter {
+	return &htmlListFormatter{outputBuf: make([]byte, 0, 1024)}
+}
+
+func (f *htmlListFormatter) Begin(w *bufio.Writer) error {
+	_, err := w.WriteString("<ul>\n")
+	return err
+}
+
+func (f *htmlListFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = append(f.outputBuf[:0], "  <li>"...)
+	f.outputBuf = appendHTMLEscaped(f.outputBuf, line)
+	f.outputBuf = append(f.outputBuf, "</li>\n"...)
+
+	_, err := w.Write(f.outputBuf)
+	return err
+}
+
+func (f *htmlListFormatter) End(w *bufio.Writer) error {
+	_, err := w.WriteString("</ul>\n")
+	return err
+}
+
+// appendHTMLEscaped appends s to buf with the five characters that are
+// special in HTML and XML text and attribute values replaced by entities.
+func appendHTMLEscaped(buf []byte, s []byte) []byte {
+	for _, c := range s {
+		switch c {
+		case '&':
+			buf = append(buf, "&amp;"...)
+		case '<':
+			buf = append(buf, "&lt;"...)
+		case '>':
+			buf = append(buf, "&gt;"...)
+		case '"':
+			buf = append(buf, "&#34;"...)
+		case '\'':
+			buf = append(buf, "&#39;"...)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// xmlName matches an element name that is safe to emit, optionally with a
+// namespace prefix.
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*(:[A-Za-z_][A-Za-z0-9_.-]*)?$`)
+
+// xmlAttrNames lists the attributes that -xml-attrs accepts.
+var xmlAttrNames = []string{"n", "file"}
+
+// xmlFormatter emits each record as an XML element, optionally with
+// attributes giving the record number and source filename.
+type xmlFormatter struct {
+	tag       string
+	attrs     []string
+	outputBuf []byte
+}
+
+// newXMLFormatter returns a formatter for -xml. attrs is a comma-separated
+// list from xmlAttrNames, or empty.
+func newXMLFormatter(tag, attrs string) (*xmlFormatter, error) {
+	if !xmlName.MatchString(tag) || strings.HasPrefix(strings.ToLower(tag), "xml") {
+		return nil, fmt.Errorf("invalid XML element name '%s'", tag)
+	}
+	f := &xmlFormatter{tag: tag, outputBuf: make([]byte, 0, 1024)}
+	if attrs != "" {
+		for _, attr := range strings.Split(attrs, ",") {
+			attr = strings.TrimSpace(attr)
+			if !slices.Contains(xmlAttrNames, attr) {
+				return nil, fmt.Errorf("unknown XML attribute '%s' (supported: %s)", attr, strings.Join(xmlAttrNames, ", "))
+			}
+			if slices.Contains(f.attrs, attr) {
+				return nil, fmt.Errorf("duplicate XML attribute '%s'", attr)
+			}
+			f.attrs = append(f.attrs, attr)
+		}
+	}
+	return f, nil
+}
+
+func (f *xmlFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *xmlFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = append(f.outputBuf[:0], '<')
+	f.outputBuf = append(f.outputBuf, f.tag...)
+	for _, attr := range f.attrs {
+		f.outputBuf = append(f.outputBuf, ' ')
+		f.outputBuf = append(f.outputBuf, attr...)
+		f.outputBuf = append(f.outputBuf, `="`...)
+		switch attr {
+		case "n":
+			f.outputBuf = strconv.AppendInt(f.outputBuf, int64(meta.num), 10)
+		case "file":
+			var err error
+			if f.outputBuf, err = appendXMLEscaped(f.outputBuf, []byte(meta.source)); err != nil {
+				return fmt.Errorf("source filename: %w", err)
+			}
+		}
+		f.outputBuf = append(f.outputBuf, '"')
+	}
+	f.outputBuf = append(f.outputBuf, '>')
+
+	var err error
+	if f.outputBuf, err = appendXMLEscaped(f.outputBuf, line); err != nil {
+		return fmt.Errorf("record %d %w", meta.num, err)
+	}
+	f.outputBuf = append(f.outputBuf, "</"...)
+	f.outputBuf = append(f.outputBuf, f.tag...)
+	f.outputBuf = append(f.outputBuf, ">\n"...)
+
+	_, err = w.Write(f.outputBuf)
+	return err
+}
+
+func (f *xmlFormatter) End(w *bufio.Writer) error { return nil }
+
+// templateRecord is the data a -template is executed with for each record.
+type templateRecord struct {
+	Line  string // the record, after transforms
+	Num   int    // 1-based position of the record in the input
+	File  string // input filename, or "-" for STDIN
+	Bytes int    // length of the record in bytes
+}
+
+// templateFormatter emits each record as the output of a Go text/template,
+// one line per record.
+type templateFormatter struct {
+	tmpl *template.Template
+}
+
+// newTemplateFormatter returns a formatter for -template.
+func newTemplateFormatter(text string) (*templateFormatter, error) {
+	tmpl, err := template.New("template").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	// Catch misspelled fields now rather than at the first record. Other
+	// errors, such as slicing past the end of .Line, depend on the record.
+	for _, t := range tmpl.Templates() {
+		if err := checkTemplateFields(t.Tree.Root); err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+	}
+	return &templateFormatter{tmpl: tmpl}, nil
+}
+
+// templateFields lists the fields of templateRecord.
+var templateFields = []string{"Line", "Num", "File", "Bytes"}
+
+// checkTemplateFields returns an error for a field in the parse tree of a
+// -template that templateRecord does not have.
+func checkTemplateFields(node parse.Node) error {
+	var nodes []parse.Node
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			nodes = n.Nodes
+		}
+	case *parse.PipeNode:
+		if n != nil {
+			for _, cmd := range n.Cmds {
+				nodes = append(nodes, cmd)
+			}
+		}
+	case *parse.CommandNode:
+		nodes = n.Args
+	case *parse.ActionNode:
+		nodes = []parse.Node{n.Pipe}
+	case *parse.ChainNode:
+		nodes = []parse.Node{n.Node}
+	case *parse.IfNode:
+		nodes = []parse.Node{n.Pipe, n.List, n.ElseList}
+	case *parse.RangeNode:
+		nodes = []parse.Node{n.Pipe, n.List, n.ElseList}
+	case *parse.WithNode:
+		nodes = []parse.Node{n.Pipe, n.List, n.ElseList}
+	case *parse.TemplateNode:
+		nodes = []parse.Node{n.Pipe}
+	case *parse.FieldNode:
+		return checkTemplateField(n.Ident[0])
+	case *parse.VariableNode:
+		// $ is the record wherever the template is
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			return checkTemplateField(n.Ident[1])
+		}
+	}
+	for _, child := range nodes {
+		if err := checkTemplateFields(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkTemplateField(name string) error {
+	if !slices.Contains(templateFields, name) {
+		return fmt.Errorf("unknown field .%s (supported: .%s)", name, strings.Join(templateFields, ", ."))
+	}
+	return nil
+}
+
+func (f *templateFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *templateFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	data := templateRecord{Line: string(line), Num: meta.num, File: meta.source, Bytes: len(line)}
+	if err := f.tmpl.Execute(w, data); err != nil {
+		return fmt.Errorf("record %d: %w", meta.num, err)
+	}
+	return w.WriteByte('\n')
+}
+
+func (f *templateFormatter) End(w *bufio.Writer) error { return nil }
+
+// appendXMLEscaped appends s to buf as XML character data that is also safe
+// inside a quoted attribute value. Markup characters become entities, and
+// tab and carriage return become character references so that parsers do
+// not normalize them away. It fails on invalid UTF-8 and on characters that
+// XML 1.0 cannot represent at all, such as NUL and other control characters.
+func appendXMLEscaped(buf []byte, s []byte) ([]byte, error) {
+	for len(s) > 0 {
+		r, size := utf8.DecodeRune(s)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			return buf, fmt.Errorf("contains invalid UTF-8")
+		case r == '\t':
+			buf = append(buf, "&#x9;"...)
+		case r == '\n':
+			buf = append(buf, "&#xA;"...)
+		case r == '\r':
+			buf = append(buf, "&#xD;"...)
+		case r < 0x20 || r == 0xFFFE || r == 0xFFFF:
+			return buf, fmt.Errorf("contains %U, which XML cannot represent", r)
+		case size == 1:
+			buf = appendHTMLEscaped(buf, s[:1])
+		default:
+			buf = append(buf, s[:size]...)
+		}
+		s = s[size:]
+	}
+	return buf, nil
+}
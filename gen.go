@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+)
+
+// genProfiles lists the supported fixture profiles in display order.
+var genProfiles = []string{"ascii", "unicode", "pathological"}
+
+// unicodeSamples holds multi-byte text covering several scripts, wide
+// characters, combining marks, and right-to-left text.
+var unicodeSamples = []string{
+	"café", "naïve", "Straße", "Ærøskøbing", "Ελληνικά", "Кириллица",
+	"日本語", "中文字符", "한국어", "ไทย", "עברית", "العربية",
+	"é", "ñ", "👍", "🎉", "👩\u200d💻", "🇺🇸", "ｆｕｌｌｗｉｄｔｈ",
+}
+
+// pathologicalSamples holds content designed to break naive parsers of
+// wrapped output: delimiters, escapes, control characters, and invalid UTF-8.
+var pathologicalSamples = []string{
+	"\"", "\"\"", "'", "\\", "\\\"", "\\\\\"", "`", "$(echo hi)", "${HOME}",
+	"\t", "\r", "\x00", "\x1b[31m", "\u00a0", "\u200b", "\ufeff",
+	"\xff", "\xc3", "\xed\xa0\x80", "\xf4\x90\x80\x80", ",", ";", "|", "<tag>", "&amp;",
+}
+
+// generator produces synthetic lines of test data for a given profile.
+// It is deterministic for a given seed.
+type generator struct {
+	profile    string
+	rng        *rand.Rand
+	terminator byte
+}
+
+// newGenerator returns a generator for profile seeded with seed.
+func newGenerator(profile string, seed uint64) (*generator, error) {
+	for _, p := range genProfiles {
+		if p == profile {
+			return &generator{profile: profile, rng: rand.New(rand.NewPCG(seed, seed)), terminator: '\n'}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown profile '%s' (supported: %s)", profile, strings.Join(genProfiles, ", "))
+}
+
+// asciiWord returns a random lowercase word of 1-10 letters.
+func (g *generator) asciiWord() string {
+	var sb strings.Builder
+	n := 1 + g.rng.IntN(10)
+	for range n {
+		sb.WriteByte(byte('a' + g.rng.IntN(26)))
+	}
+	return sb.String()
+}
+
+// line returns the next generated line, without a terminator.
+func (g *generator) line() string {
+	var parts []string
+	n := 1 + g.rng.IntN(8)
+
+	switch g.profile {
+	case "ascii":
+		for range n {
+			parts = append(parts, g.asciiWord())
+		}
+	case "unicode":
+		for range n {
+			if g.rng.IntN(2) == 0 {
+				parts = append(parts, g.asciiWord())
+			} else {
+				parts = append(parts, unicodeSamples[g.rng.IntN(len(unicodeSamples))])
+			}
+		}
+	case "pathological":
+		switch g.rng.IntN(10) {
+		case 0:
+			return ""
+		case 1:
+			return strings.Repeat(" ", 1+g.rng.IntN(5))
+		case 2:
+			return strings.Repeat("\"", 1+g.rng.IntN(5))
+		case 3:
+			return strings.Repeat(g.asciiWord(), 100+g.rng.IntN(1000))
+		}
+		for range n {
+			switch g.rng.IntN(3) {
+			case 0:
+				parts = append(parts, g.asciiWord())
+			case 1:
+				parts = append(parts, unicodeSamples[g.rng.IntN(len(unicodeSamples))])
+			default:
+				// A sample holding the terminator would split the record in two
+				sample := pathologicalSamples[g.rng.IntN(len(pathologicalSamples))]
+				for strings.IndexByte(sample, g.terminator) >= 0 {
+					sample = pathologicalSamples[g.rng.IntN(len(pathologicalSamples))]
+				}
+				parts = append(parts, sample)
+			}
+		}
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts, " ")
+}
+
+// writeLines writes count generated lines to w, each followed by terminator.
+// Generated lines never contain terminator.
+func (g *generator) writeLines(w io.Writer, count int, terminator byte) error {
+	g.terminator = terminator
+	writer := bufio.NewWriter(w)
+	for range count {
+		if _, err := writer.WriteString(g.line()); err != nil {
+			return err
+		}
+		if err := writer.WriteByte(terminator); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// runGen implements the "gen" subcommand, which writes synthetic test data.
+func runGen(args []string) {
+	fs := flag.NewFlagSet(pgmName+" gen", flag.ExitOnError)
+	lines := fs.Int("lines", 1000, "number of lines to generate")
+	profile := fs.String("profile", "ascii", "kind of data to generate: "+strings.Join(genProfiles, ", "))
+	seed := fs.Uint64("seed", 1, "random seed; the same seed always produces the same output")
+	outputFile := fs.String("o", "", "output file (default: STDOUT)")
+	nullTerminated := fs.Bool("0", false, "terminate lines with NUL instead of newline")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s gen [options]\n\nGenerate synthetic line data for testing.\n\n", pgmName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument '%s'\n", fs.Arg(0))
+		os.Exit(1)
+	}
+	if *lines < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid line count %d: must not be negative\n", *lines)
+		os.Exit(1)
+	}
+
+	gen, err := newGenerator(*profile, *seed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var output io.Writer = os.Stdout
+	if *outputFile != "" {
+		outFile, err := os.Create(*outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create output file '%s': %v\n", *outputFile, err)
+			os.Exit(1)
+		}
+		defer outFile.Close()
+		output = outFile
+	}
+
+	var terminator byte = '\n'
+	if *nullTerminated {
+		terminator = 0
+	}
+	if err := gen.writeLines(output, *lines, terminator); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -2,6 +2,9 @@ module github.com/jftuga/wrapline
 
 go 1.25.3
 
-require golang.org/x/term v0.36.0
+require (
+	golang.org/x/term v0.36.0
+	golang.org/x/text v0.30.0
+)
 
 require golang.org/x/sys v0.37.0 // indirect
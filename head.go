@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// headDefault is the number of records the "head" subcommand writes when
+// -n is not given.
+const headDefault = 10
+
+// parseHeadArgs handles the "head" subcommand, given the full command line.
+// It returns the record limit from a leading -n N, -n=N, or -nN, and the
+// command line with "head" and -n removed, to be parsed as usual. Everything
+// else, including the input filename, is a regular option.
+func parseHeadArgs(args []string) (int, []string) {
+	rest := args[2:]
+	value := strconv.Itoa(headDefault)
+	if len(rest) > 0 {
+		switch arg := rest[0]; {
+		case arg == "-n" || arg == "--n":
+			if len(rest) < 2 {
+				fmt.Fprintln(os.Stderr, "Error: head: -n requires a record count")
+				os.Exit(1)
+			}
+			value, rest = rest[1], rest[2:]
+		case strings.HasPrefix(arg, "-n="):
+			value, rest = strings.TrimPrefix(arg, "-n="), rest[1:]
+		case len(arg) > 2 && strings.HasPrefix(arg, "-n") && arg[2] >= '0' && arg[2] <= '9':
+			// -nN, but not another option such as -none
+			value, rest = arg[2:], rest[1:]
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		fmt.Fprintf(os.Stderr, "Error: head: invalid record count '%s': must be a positive number\n", value)
+		os.Exit(1)
+	}
+	return n, append([]string{args[0]}, rest...)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// inspectQuotes lists the quote characters that inspect looks for around
+// records.
+var inspectQuotes = []byte{'"', '\'', '`'}
+
+// inspectReport describes a sample of unfamiliar data.
+type inspectReport struct {
+	sampled   int  // bytes examined
+	truncated bool // whether the input continues past the sample
+
+	separator string // human-readable record separator
+	sepFlags  string // wrapline flags that read that separator
+	records   [][]byte
+	encoding  string
+	lengths   []int // sorted record lengths in bytes
+	quote     byte  // probable wrapping quote, or 0
+	quoted    int   // records enclosed in quote
+	nonEmpty  int
+	escaped   int // quotes inside quoted records preceded by a backslash
+	doubled   int // quotes inside quoted records written twice, CSV style
+	bare      int // other quotes inside quoted records
+}
+
+// inspectSample analyzes data, the first bytes of an input. When truncated
+// is set, a final record without a separator is incomplete and ignored.
+func inspectSample(data []byte, truncated bool) inspectReport {
+	r := inspectReport{sampled: len(data), truncated: truncated}
+
+	// Record separator: NUL wins if it is at least as common as newline
+	newlines := bytes.Count(data, []byte("\n"))
+	crlf := bytes.Count(data, []byte("\r\n"))
+	nuls := bytes.Count(data, []byte{0})
+	var sep []byte
+	switch {
+	case nuls > 0 && nuls >= newlines:
+		sep, r.separator, r.sepFlags = []byte{0}, "NUL", "-0"
+	case newlines > 0 && crlf == newlines:
+		sep, r.separator = []byte("\r\n"), "CRLF"
+	case newlines > 0 && crlf > 0:
+		sep, r.separator = []byte("\n"), fmt.Sprintf("LF, %d of %d lines ending in CRLF", crlf, newlines)
+	case newlines > 0:
+		sep, r.separator = []byte("\n"), "LF"
+	default:
+		r.separator = "none found"
+	}
+
+	if sep == nil {
+		if len(data) > 0 && !truncated {
+			r.records = [][]byte{data}
+		}
+	} else {
+		r.records = bytes.Split(data, sep)
+		// The piece after the last separator is empty, or incomplete when
+		// the sample stops early
+		last := r.records[len(r.records)-1]
+		if len(last) == 0 || truncated {
+			r.records = r.records[:len(r.records)-1]
+		}
+	}
+
+	// Encoding
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		r.encoding = "UTF-16LE (byte order mark); convert to UTF-8 first"
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		r.encoding = "UTF-16BE (byte order mark); convert to UTF-8 first"
+	case nuls > 0 && r.separator != "NUL":
+		r.encoding = fmt.Sprintf("binary (%d NUL bytes)", nuls)
+	default:
+		invalid := countInvalidUTF8(data, truncated)
+		ascii := !slices.ContainsFunc(data, func(c byte) bool { return c >= 0x80 })
+		switch {
+		case invalid > 0:
+			r.encoding = fmt.Sprintf("not UTF-8 (%d invalid sequences); possibly Latin-1 or Windows-1252", invalid)
+		case ascii:
+			r.encoding = "ASCII"
+		case bytes.HasPrefix(data, []byte("\xEF\xBB\xBF")):
+			r.encoding = "UTF-8 (byte order mark)"
+		default:
+			r.encoding = "UTF-8"
+		}
+	}
+
+	// Lengths and quoting
+	counts := make(map[byte]int)
+	for _, rec := range r.records {
+		r.lengths = append(r.lengths, len(rec))
+		if len(rec) == 0 {
+			continue
+		}
+		r.nonEmpty++
+		if len(rec) >= 2 && rec[0] == rec[len(rec)-1] && slices.Contains(inspectQuotes, rec[0]) {
+			counts[rec[0]]++
+		}
+	}
+	slices.Sort(r.lengths)
+	for _, q := range inspectQuotes {
+		if counts[q] > r.quoted {
+			r.quote, r.quoted = q, counts[q]
+		}
+	}
+
+	// Escaping of the quote inside quoted records
+	if r.quote != 0 {
+		for _, rec := range r.records {
+			if len(rec) < 2 || rec[0] != r.quote || rec[len(rec)-1] != r.quote {
+				continue
+			}
+			inner := rec[1 : len(rec)-1]
+			for i := 0; i < len(inner); i++ {
+				switch {
+				case inner[i] == '\\' && i+1 < len(inner):
+					if inner[i+1] == r.quote {
+						r.escaped++
+					}
+					i++
+				case inner[i] == r.quote && i+1 < len(inner) && inner[i+1] == r.quote:
+					r.doubled++
+					i++
+				case inner[i] == r.quote:
+					r.bare++
+				}
+			}
+		}
+	}
+	return r
+}
+
+// countInvalidUTF8 returns the number of invalid UTF-8 sequences in data,
+// ignoring a character cut off at the end of a truncated sample.
+func countInvalidUTF8(data []byte, truncated bool) int {
+	invalid := 0
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			if truncated && len(data) < utf8.UTFMax && !utf8.FullRune(data) {
+				break
+			}
+			invalid++
+		}
+		data = data[size:]
+	}
+	return invalid
+}
+
+// percentile returns the p'th percentile of sorted values.
+func percentile(sorted []int, p int) int {
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+// writeInspectReport prints r for the named source.
+func writeInspectReport(w io.Writer, source string, r inspectReport) {
+	sampled := "all of"
+	if r.truncated {
+		sampled = "the first " + formatBytes(uint64(r.sampled)) + " of"
+	}
+	fmt.Fprintf(w, "%s: examined %s the input, %d records\n", source, sampled, len(r.records))
+	fmt.Fprintf(w, "  separator: %s\n", r.separator)
+	fmt.Fprintf(w, "  encoding:  %s\n", r.encoding)
+	if len(r.lengths) > 0 {
+		fmt.Fprintf(w, "  lengths:   min %d, median %d, p95 %d, max %d bytes\n",
+			r.lengths[0], percentile(r.lengths, 50), percentile(r.lengths, 95), r.lengths[len(r.lengths)-1])
+	}
+
+	// Quoting counts only when most non-empty records agree
+	quoted := r.quote != 0 && r.quoted*10 >= r.nonEmpty*9
+	switch {
+	case quoted:
+		fmt.Fprintf(w, "  quoting:   %c (%d of %d non-empty records)\n", r.quote, r.quoted, r.nonEmpty)
+	case r.quote != 0:
+		fmt.Fprintf(w, "  quoting:   none consistent (%c around %d of %d non-empty records)\n", r.quote, r.quoted, r.nonEmpty)
+	default:
+		fmt.Fprintln(w, "  quoting:   none")
+	}
+
+	escapeFlag := ""
+	if quoted {
+		switch {
+		case r.escaped+r.doubled+r.bare == 0:
+			fmt.Fprintln(w, "  escaping:  none needed (no embedded quotes)")
+		case r.bare == 0 && r.doubled == 0:
+			fmt.Fprintf(w, "  escaping:  consistent, backslash (%d embedded quotes)\n", r.escaped)
+			escapeFlag = " -escape"
+		case r.bare == 0 && r.escaped == 0:
+			fmt.Fprintf(w, "  escaping:  consistent, doubled as in CSV (%d embedded quotes); not a wrapline -escape format\n", r.doubled)
+		default:
+			fmt.Fprintf(w, "  escaping:  inconsistent (%d backslash-escaped, %d doubled, %d bare embedded quotes)\n", r.escaped, r.doubled, r.bare)
+		}
+	}
+
+	// Suggest the flags that read and write records in this shape
+	var flags []string
+	if r.sepFlags != "" {
+		flags = append(flags, r.sepFlags)
+	}
+	if quoted {
+		flags = append(flags, "-d "+string(appendShellQuoted(nil, []byte{r.quote}))+escapeFlag)
+	} else {
+		flags = append(flags, "-none")
+	}
+	fmt.Fprintf(w, "  flags:     %s\n", strings.Join(flags, " "))
+}
+
+// runInspect implements the "inspect" subcommand, which samples unfamiliar
+// data and reports its shape, to help choose flags for it.
+func runInspect(args []string) {
+	fs := flag.NewFlagSet(pgmName+" inspect", flag.ExitOnError)
+	sampleArg := fs.String("sample", "1m", "number of bytes to examine from the start of the input (k, m, g suffixes accepted)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s inspect [options] [file]\n\n", pgmName)
+		fmt.Fprintf(fs.Output(), "Sample file ('-' or none for STDIN) and report its record separator, encoding,\nrecord lengths, quoting, and escaping.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	sample, err := parseSize(*sampleArg)
+	if err != nil || sample == 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -sample '%s': must be a positive size\n", *sampleArg)
+		os.Exit(1)
+	}
+
+	source := "-"
+	if fs.NArg() == 1 {
+		source = fs.Arg(0)
+	}
+	in, err := openInput(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to open file '%s': %v\n", source, err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	// Read one byte past the sample to learn whether the input continues
+	data, err := io.ReadAll(io.LimitReader(in, sample+1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to read input: %v\n", err)
+		os.Exit(1)
+	}
+	truncated := int64(len(data)) > sample
+	if truncated {
+		data = data[:sample]
+	}
+
+	writeInspectReport(os.Stdout, source, inspectSample(data, truncated))
+}
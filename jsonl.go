@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep is one step of a -path: an object key, or an array index when
+// key is empty.
+type pathStep struct {
+	key   string
+	index int
+}
+
+// parsePath parses a -path such as ".user.email" or "$.items[0].name". A
+// leading "$" is optional, and "." alone selects the whole value.
+func parsePath(path string) ([]pathStep, error) {
+	rest := strings.TrimPrefix(path, "$")
+	if rest == "." || rest == "" {
+		return nil, nil
+	}
+	var steps []pathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("invalid path '%s': empty key", path)
+			}
+			steps = append(steps, pathStep{key: rest[1:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path '%s': unclosed '['", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid path '%s': '%s' is not an array index", path, rest[1:end])
+			}
+			steps = append(steps, pathStep{index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path '%s': expected '.' or '[' before '%s'", path, rest)
+		}
+	}
+	return steps, nil
+}
+
+// lookupPath returns the value at path within v, and whether it exists.
+func lookupPath(v any, path []pathStep) (any, bool) {
+	for _, step := range path {
+		if step.key != "" {
+			object, ok := v.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = object[step.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		array, ok := v.([]any)
+		if !ok || step.index >= len(array) {
+			return nil, false
+		}
+		v = array[step.index]
+	}
+	return v, true
+}
+
+// scalarText returns the text of a decoded JSON value to wrap: strings
+// unquoted, numbers as written, null as an empty string, and objects and
+// arrays as compact JSON.
+func scalarText(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(v), nil
+	case json.Number:
+		return []byte(v), nil
+	case bool:
+		return strconv.AppendBool(nil, v), nil
+	}
+	return json.Marshal(v)
+}
+
+// jsonlReader reads one JSON value per line and returns the value at a path
+// within each as a record, for -jsonl-in. A missing or null value gives an
+// empty record. Blank lines are skipped.
+type jsonlReader struct {
+	lines recordReader
+	path  []pathStep
+	line  int
+}
+
+// newJSONLReader returns a reader for the value at path in each JSON line
+// read from lines.
+func newJSONLReader(lines recordReader, path []pathStep) *jsonlReader {
+	return &jsonlReader{lines: lines, path: path}
+}
+
+func (r *jsonlReader) Next() ([]byte, error) {
+	for {
+		line, err := r.lines.Next()
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var v any
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err != nil {
+			return nil, fmt.Errorf("line %d: invalid JSON: %w", r.line, err)
+		}
+		if decoder.More() {
+			return nil, fmt.Errorf("line %d: unexpected data after the JSON value", r.line)
+		}
+		value, _ := lookupPath(v, r.path)
+		return scalarText(value)
+	}
+}
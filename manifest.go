@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"os"
+)
+
+// manifestEntry describes one input processed into one output, in the form
+// written by -manifest.
+type manifestEntry struct {
+	Input          string `json:"input"`
+	Output         string `json:"output"`
+	RecordsRead    int    `json:"records_read"`
+	RecordsWritten int    `json:"records_written"`
+	InputSHA256    string `json:"input_sha256,omitempty"`
+	OutputSHA256   string `json:"output_sha256"`
+}
+
+// newManifestEntry builds an entry from the run's statistics and the hashes
+// fed with its input and output bytes. A nil inputHash leaves the input hash
+// out, for sources that are not read as a byte stream.
+func newManifestEntry(input, output string, stats *runStats, inputHash, outputHash hash.Hash) manifestEntry {
+	entry := manifestEntry{
+		Input:          input,
+		Output:         output,
+		RecordsRead:    stats.read,
+		RecordsWritten: stats.written,
+		OutputSHA256:   hex.EncodeToString(outputHash.Sum(nil)),
+	}
+	if inputHash != nil {
+		entry.InputSHA256 = hex.EncodeToString(inputHash.Sum(nil))
+	}
+	return entry
+}
+
+// writeManifest writes entries to filename as an indented JSON array.
+func writeManifest(filename string, entries []manifestEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// mergeModes lists the values accepted by -merge.
+var mergeModes = []string{"sorted", "roundrobin"}
+
+// mergeInput is one input of a mergeReader, with the record read from it
+// next, and that record's row with -csv-in or -tsv-in.
+type mergeInput struct {
+	name    string
+	records recordReader
+	closer  io.Closer
+	line    []byte
+	row     []string
+	num     int
+}
+
+// mergeReader interleaves the records of several inputs instead of reading
+// them in turn. In "roundrobin" mode it takes one record from each input in
+// turn; in "sorted" mode, a k-way merge, it takes the lowest record of any
+// input, comparing bytes as 'LC_ALL=C sort -m' does, so inputs that are each
+// sorted give sorted output. Every input is open at once.
+type mergeReader struct {
+	mode   string
+	inputs []*mergeInput
+	next   int // with roundrobin, the input to take from next
+	source string
+	row    []string
+}
+
+// newMergeReader opens the named inputs with open and returns a reader that
+// merges their records in mode.
+func newMergeReader(names []string, mode string, open func(name string) (recordReader, io.Closer, error)) (*mergeReader, error) {
+	mr := &mergeReader{mode: mode}
+	for _, name := range names {
+		records, closer, err := open(name)
+		if err != nil {
+			mr.Close()
+			return nil, err
+		}
+		input := &mergeInput{name: name, records: records, closer: closer}
+		mr.inputs = append(mr.inputs, input)
+		if err := mr.advance(input); err != nil {
+			mr.Close()
+			return nil, err
+		}
+	}
+	return mr, nil
+}
+
+// advance reads the next record of input, closing it and removing it from
+// the merge at its end. In sorted mode, a record lower than the one before
+// it is an error, as the merge would silently be out of order.
+func (mr *mergeReader) advance(input *mergeInput) error {
+	line, err := input.records.Next()
+	if err == io.EOF {
+		for i, in := range mr.inputs {
+			if in == input {
+				mr.inputs = append(mr.inputs[:i], mr.inputs[i+1:]...)
+				if mr.next > i {
+					mr.next--
+				}
+				break
+			}
+		}
+		return input.closer.Close()
+	}
+	if err != nil {
+		return err
+	}
+	input.num++
+	if mr.mode == "sorted" && input.num > 1 && bytes.Compare(line, input.line) < 0 {
+		return fmt.Errorf("input '%s' is not sorted: record %d is lower than the one before it", input.name, input.num)
+	}
+	// Kept while other inputs are read, so it must not share a buffer
+	input.line = bytes.Clone(line)
+	input.row = nil
+	if rows, ok := input.records.(rowSource); ok {
+		input.row = rows.Row()
+	}
+	return nil
+}
+
+// Next returns the next record in merge order.
+func (mr *mergeReader) Next() ([]byte, error) {
+	if len(mr.inputs) == 0 {
+		return nil, io.EOF
+	}
+	var input *mergeInput
+	if mr.mode == "roundrobin" {
+		mr.next %= len(mr.inputs)
+		input = mr.inputs[mr.next]
+		mr.next++
+	} else {
+		// Ties go to the input listed first
+		input = mr.inputs[0]
+		for _, in := range mr.inputs[1:] {
+			if bytes.Compare(in.line, input.line) < 0 {
+				input = in
+			}
+		}
+	}
+	line, row := input.line, input.row
+	mr.source, mr.row = input.name, row
+	if err := mr.advance(input); err != nil {
+		return nil, err
+	}
+	return line, nil
+}
+
+// Source returns the name of the input the last record came from.
+func (mr *mergeReader) Source() string {
+	return mr.source
+}
+
+// Row returns the row of the last record, with -csv-in or -tsv-in.
+func (mr *mergeReader) Row() []string {
+	return mr.row
+}
+
+// Close closes the inputs still open, after an error.
+func (mr *mergeReader) Close() error {
+	for _, input := range mr.inputs {
+		input.closer.Close()
+	}
+	return nil
+}
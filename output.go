@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// openOutput opens an output destination for writing. "-" is STDOUT and
+// /dev/fd/N names an already open file descriptor, as passed by shell
+// process substitution; anything else is created or truncated as a file.
+func openOutput(name string) (*os.File, error) {
+	if name == "-" {
+		return os.Stdout, nil
+	}
+	if fdArg, ok := strings.CutPrefix(name, "/dev/fd/"); ok {
+		fd, err := strconv.Atoi(fdArg)
+		if err == nil && fd >= 0 {
+			f := os.NewFile(uintptr(fd), name)
+			if _, err := f.Stat(); err != nil {
+				return nil, fmt.Errorf("file descriptor %d is not open", fd)
+			}
+			return f, nil
+		}
+	}
+	return os.Create(name)
+}
+
+// compressMethods lists the values accepted by -compress.
+var compressMethods = []string{"gzip", "none"}
+
+// outputCompression returns the compression for the named output: method
+// if one was given, otherwise gzip for names ending in .gz.
+func outputCompression(name, method string) string {
+	if method == "" && strings.HasSuffix(name, ".gz") {
+		return "gzip"
+	}
+	return method
+}
+
+// compressedOutput gzip-compresses everything written to an output.
+type compressedOutput struct {
+	*gzip.Writer
+	file *os.File
+}
+
+// Close finishes the compressed stream and closes the underlying file,
+// unless it is STDOUT.
+func (c *compressedOutput) Close() error {
+	err := c.Writer.Close()
+	if c.file != os.Stdout {
+		if cerr := c.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// openCompressedOutput opens an output destination like openOutput,
+// compressing what is written to it as outputCompression says.
+func openCompressedOutput(name, method string) (io.WriteCloser, error) {
+	file, err := openOutput(name)
+	if err != nil || outputCompression(name, method) != "gzip" {
+		return file, err
+	}
+	return &compressedOutput{Writer: gzip.NewWriter(file), file: file}, nil
+}
+
+// fanoutWriter writes identical output to several destinations. Each
+// destination is written by its own goroutine, so a slow pipe does not hold
+// up the others until its queue fills. A destination that fails is reported
+// once and dropped; the rest carry on.
+type fanoutWriter struct {
+	targets []*fanoutTarget
+	wg      sync.WaitGroup
+}
+
+// fanoutTarget is one destination of a fanoutWriter.
+type fanoutTarget struct {
+	name   string
+	file   io.WriteCloser
+	chunks chan []byte
+	failed chan struct{}
+	err    error
+}
+
+// fanoutQueue is the number of pending writes buffered per destination.
+const fanoutQueue = 64
+
+// newFanoutWriter opens every named destination, compressed as
+// outputCompression says, and starts its writer.
+func newFanoutWriter(names []string, compress string) (*fanoutWriter, error) {
+	fw := &fanoutWriter{}
+	for _, name := range names {
+		file, err := openCompressedOutput(name, compress)
+		if err != nil {
+			fw.Close()
+			return nil, fmt.Errorf("failed to create output file '%s': %w", name, err)
+		}
+		t := &fanoutTarget{name: name, file: file, chunks: make(chan []byte, fanoutQueue), failed: make(chan struct{})}
+		fw.targets = append(fw.targets, t)
+		fw.wg.Add(1)
+		go fw.run(t)
+	}
+	return fw, nil
+}
+
+// run writes queued chunks to t until the queue is closed or a write fails.
+func (fw *fanoutWriter) run(t *fanoutTarget) {
+	defer fw.wg.Done()
+	for chunk := range t.chunks {
+		if _, err := t.file.Write(chunk); err != nil {
+			t.err = err
+			fmt.Fprintf(os.Stderr, "Error: output '%s': %v\n", t.name, err)
+			close(t.failed)
+			return
+		}
+	}
+}
+
+// Write queues a copy of p for every destination that has not failed. It
+// returns an error only once all destinations have failed.
+func (fw *fanoutWriter) Write(p []byte) (int, error) {
+	chunk := append([]byte(nil), p...)
+	live := 0
+	for _, t := range fw.targets {
+		select {
+		case t.chunks <- chunk:
+			live++
+		case <-t.failed:
+		}
+	}
+	if live == 0 {
+		return 0, errors.New("all outputs failed")
+	}
+	return len(p), nil
+}
+
+// Close waits for all queued output to be written and closes every
+// destination other than STDOUT. It returns an error if any destination
+// failed, each of which has already been reported.
+func (fw *fanoutWriter) Close() error {
+	for _, t := range fw.targets {
+		close(t.chunks)
+	}
+	fw.wg.Wait()
+
+	failed := 0
+	for _, t := range fw.targets {
+		if t.file != os.Stdout {
+			if err := t.file.Close(); err != nil && t.err == nil {
+				t.err = err
+				fmt.Fprintf(os.Stderr, "Error: output '%s': %v\n", t.name, err)
+			}
+		}
+		if t.err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d outputs failed", failed, len(fw.targets))
+	}
+	return nil
+}
+
+// splitFormatter writes the output of another formatter to a series of
+// files named after a template, PREFIX.0001, PREFIX.0002, and so on. A new
+// file is started when the current one holds maxRecords records, or when the
+// next record would take it past maxBytes; records are never split. The
+// inner formatter is restarted for every file, so each is a complete
+// document. Its output is rendered into a scratch buffer first so that its
+// size is known. The writer passed in by the caller is not used.
+type splitFormatter struct {
+	inner      formatter
+	template   string
+	maxRecords int
+	maxBytes   int64
+	count      int
+	size       int64
+	index      int
+	file       *os.File
+	writer     *bufio.Writer
+	buf        bytes.Buffer
+	scratch    *bufio.Writer
+}
+
+// newSplitFormatter returns a formatter for -split-lines and -split-bytes.
+// A limit of 0 does not apply.
+func newSplitFormatter(inner formatter, template string, maxRecords int, maxBytes int64) *splitFormatter {
+	f := &splitFormatter{inner: inner, template: template, maxRecords: maxRecords, maxBytes: maxBytes}
+	f.scratch = bufio.NewWriter(&f.buf)
+	return f
+}
+
+// splitName returns the name of the index'th output file.
+func splitName(template string, index int) string {
+	return fmt.Sprintf("%s.%04d", template, index)
+}
+
+// render runs fn against the scratch writer and returns what it wrote. The
+// result is only valid until the next call.
+func (f *splitFormatter) render(fn func(w *bufio.Writer) error) ([]byte, error) {
+	f.buf.Reset()
+	if err := fn(f.scratch); err != nil {
+		return nil, err
+	}
+	if err := f.scratch.Flush(); err != nil {
+		return nil, err
+	}
+	return f.buf.Bytes(), nil
+}
+
+// write appends rendered output to the current file.
+func (f *splitFormatter) write(b []byte) error {
+	if _, err := f.writer.Write(b); err != nil {
+		return fmt.Errorf("failed to write output file '%s': %w", splitName(f.template, f.index), err)
+	}
+	f.size += int64(len(b))
+	return nil
+}
+
+// next finishes the current file, if any, and starts the next one.
+func (f *splitFormatter) next() error {
+	if err := f.finish(); err != nil {
+		return err
+	}
+	f.index++
+	name := splitName(f.template, f.index)
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create output file '%s': %w", name, err)
+	}
+	f.file = file
+	f.writer = bufio.NewWriter(file)
+	f.count, f.size = 0, 0
+
+	header, err := f.render(f.inner.Begin)
+	if err != nil {
+		return err
+	}
+	return f.write(header)
+}
+
+// finish ends the inner formatter's document and closes the current file.
+func (f *splitFormatter) finish() error {
+	if f.file == nil {
+		return nil
+	}
+	trailer, err := f.render(f.inner.End)
+	if err == nil {
+		err = f.write(trailer)
+	}
+	if err == nil {
+		err = f.writer.Flush()
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	f.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to write output file '%s': %w", splitName(f.template, f.index), err)
+	}
+	return nil
+}
+
+func (f *splitFormatter) Begin(w *bufio.Writer) error { return f.next() }
+
+func (f *splitFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	if f.maxRecords > 0 && f.count == f.maxRecords {
+		if err := f.next(); err != nil {
+			return err
+		}
+	}
+	rendered, err := f.render(func(w *bufio.Writer) error { return f.inner.Record(w, line, meta) })
+	if err != nil {
+		return err
+	}
+
+	if f.maxBytes > 0 && f.size+int64(len(rendered)) > f.maxBytes {
+		if f.count > 0 {
+			// Starting the next file reuses the scratch buffer
+			rendered = bytes.Clone(rendered)
+			if err := f.next(); err != nil {
+				return err
+			}
+		}
+		if f.size+int64(len(rendered)) > f.maxBytes {
+			return fmt.Errorf("record %d is %d bytes as written, too large for a file of at most %s", meta.num, len(rendered), formatBytes(uint64(f.maxBytes)))
+		}
+	}
+
+	f.count++
+	return f.write(rendered)
+}
+
+func (f *splitFormatter) End(w *bufio.Writer) error { return f.finish() }
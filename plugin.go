@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// execPlugin is a transformer backed by an external process.
+//
+// The protocol is line in / line out over stdio: for every record, wrapline
+// writes the record followed by a newline to the plugin's STDIN and then
+// reads exactly one newline-terminated line from its STDOUT as the
+// replacement. Plugins must therefore flush their output after every line;
+// one that holds its output back would never reply, so a reply that takes
+// longer than the timeout is an error rather than a hang. The plugin's
+// STDERR is passed through to wrapline's STDERR.
+type execPlugin struct {
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	replies chan pluginReply
+	timeout time.Duration // 0 for none
+}
+
+// pluginReply is a line read from a plugin's STDOUT, or the error that
+// ended reading it along with any unterminated data read before it.
+type pluginReply struct {
+	line []byte
+	err  error
+}
+
+// startPlugin launches command (split on whitespace; no shell quoting is
+// interpreted) and returns a transformer that communicates with it, waiting
+// up to timeout for each reply.
+func startPlugin(command string, timeout time.Duration) (*execPlugin, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("empty plugin command")
+	}
+
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin '%s': %w", command, err)
+	}
+
+	// Replies are read in the background so that waiting for one can time out
+	replies := make(chan pluginReply, 1)
+	go func() {
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				replies <- pluginReply{line: line, err: err}
+				return
+			}
+			replies <- pluginReply{line: line}
+		}
+	}()
+
+	return &execPlugin{
+		command: command,
+		cmd:     cmd,
+		stdin:   stdin,
+		replies: replies,
+		timeout: timeout,
+	}, nil
+}
+
+// Transform sends line to the plugin and returns its reply.
+func (p *execPlugin) Transform(line []byte) ([]byte, error) {
+	if bytes.IndexByte(line, '\n') >= 0 {
+		return nil, fmt.Errorf("plugin '%s': record contains a newline and cannot be sent", p.command)
+	}
+
+	msg := make([]byte, 0, len(line)+1)
+	msg = append(msg, line...)
+	msg = append(msg, '\n')
+	if _, err := p.stdin.Write(msg); err != nil {
+		return nil, fmt.Errorf("plugin '%s': failed to write: %w", p.command, err)
+	}
+
+	var expired <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case reply := <-p.replies:
+		if reply.err == io.EOF && len(reply.line) > 0 {
+			return nil, fmt.Errorf("plugin '%s': exited after a reply that was not newline-terminated", p.command)
+		}
+		if reply.err == io.EOF {
+			return nil, fmt.Errorf("plugin '%s': exited before replying", p.command)
+		}
+		if reply.err != nil {
+			return nil, fmt.Errorf("plugin '%s': failed to read: %w", p.command, reply.err)
+		}
+		return reply.line[:len(reply.line)-1], nil
+	case <-expired:
+		return nil, fmt.Errorf("plugin '%s': no reply within %v; a plugin must flush its output after every line", p.command, p.timeout)
+	}
+}
+
+// Close signals end of input to the plugin and waits for it to exit.
+func (p *execPlugin) Close() error {
+	p.stdin.Close()
+	if err := p.cmd.Wait(); err != nil {
+		return fmt.Errorf("plugin '%s': %w", p.command, err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stringList is a flag.Value that collects every occurrence of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// postConfig holds the settings for delivering records over HTTP.
+type postConfig struct {
+	url         string
+	headers     http.Header
+	batchSize   int
+	concurrency int
+	retries     int
+	backoff     time.Duration
+	timeout     time.Duration
+	rejectFile  string
+}
+
+// parseHeaders converts "Name: value" strings to an http.Header.
+func parseHeaders(list []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, h := range list {
+		name, value, ok := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header '%s': expected 'Name: value'", h)
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+	if headers.Get("Content-Type") == "" {
+		headers.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	return headers, nil
+}
+
+// postBatch is a group of rendered records sent in one request.
+type postBatch struct {
+	records [][]byte
+}
+
+// postSink delivers rendered records to an HTTP endpoint using a pool of
+// workers. Failed batches are retried with exponential backoff; batches that
+// still fail are appended to the reject file, if any.
+type postSink struct {
+	cfg     postConfig
+	client  *http.Client
+	batches chan postBatch
+	pending postBatch
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	reject  *os.File
+	sent    int
+	failed  int
+	lastErr error
+}
+
+// newPostSink starts the delivery workers.
+func newPostSink(cfg postConfig) (*postSink, error) {
+	s := &postSink{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.timeout},
+		batches: make(chan postBatch, cfg.concurrency),
+	}
+	if cfg.rejectFile != "" {
+		f, err := os.Create(cfg.rejectFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create reject file '%s': %w", cfg.rejectFile, err)
+		}
+		s.reject = f
+	}
+
+	for range cfg.concurrency {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	return s, nil
+}
+
+// add queues one rendered record, sending a batch once it is full.
+func (s *postSink) add(record []byte) {
+	s.pending.records = append(s.pending.records, record)
+	if len(s.pending.records) >= s.cfg.batchSize {
+		s.batches <- s.pending
+		s.pending = postBatch{}
+	}
+}
+
+// Close sends any partial batch, waits for all deliveries to finish, and
+// returns an error summarizing failed records.
+func (s *postSink) Close() error {
+	if len(s.pending.records) > 0 {
+		s.batches <- s.pending
+		s.pending = postBatch{}
+	}
+	close(s.batches)
+	s.wg.Wait()
+
+	if s.reject != nil {
+		if err := s.reject.Close(); err != nil {
+			return fmt.Errorf("failed to write reject file: %w", err)
+		}
+	}
+	if s.failed > 0 {
+		return fmt.Errorf("%d of %d records failed to post (last error: %v)", s.failed, s.sent+s.failed, s.lastErr)
+	}
+	return nil
+}
+
+// worker delivers batches until the channel is closed.
+func (s *postSink) worker() {
+	defer s.wg.Done()
+	for batch := range s.batches {
+		err := s.deliver(bytes.Join(batch.records, nil))
+
+		s.mu.Lock()
+		if err == nil {
+			s.sent += len(batch.records)
+		} else {
+			s.failed += len(batch.records)
+			s.lastErr = err
+			if s.reject != nil {
+				for _, r := range batch.records {
+					s.reject.Write(r)
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// errPermanent marks a delivery failure that retrying cannot fix.
+var errPermanent = errors.New("permanent failure")
+
+// deliver POSTs body, retrying network errors, 429, and 5xx responses.
+func (s *postSink) deliver(body []byte) error {
+	delay := s.cfg.backoff
+	var err error
+	for attempt := 0; attempt <= s.cfg.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		var retryAfter time.Duration
+		retryAfter, err = s.send(body)
+		if err == nil || errors.Is(err, errPermanent) {
+			return err
+		}
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+	}
+	return err
+}
+
+// send makes a single POST request. It returns the server's Retry-After
+// hint, if any, along with the error.
+func (s *postSink) send(body []byte) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, s.cfg.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header = s.cfg.headers.Clone()
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var retryAfter time.Duration
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return retryAfter, fmt.Errorf("server returned %s", resp.Status)
+	default:
+		return 0, fmt.Errorf("%w: server returned %s", errPermanent, resp.Status)
+	}
+}
+
+// postFormatter renders each record with an inner formatter and hands the
+// result to a postSink instead of the output writer.
+type postFormatter struct {
+	inner   formatter
+	sink    *postSink
+	buf     bytes.Buffer
+	scratch *bufio.Writer
+}
+
+// newPostFormatter returns a formatter that posts records rendered by inner.
+func newPostFormatter(inner formatter, sink *postSink) *postFormatter {
+	f := &postFormatter{inner: inner, sink: sink}
+	f.scratch = bufio.NewWriter(&f.buf)
+	return f
+}
+
+func (f *postFormatter) Begin(w *bufio.Writer) error { return nil }
+
+func (f *postFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.buf.Reset()
+	if err := f.inner.Record(f.scratch, line, meta); err != nil {
+		return err
+	}
+	if err := f.scratch.Flush(); err != nil {
+		return err
+	}
+	f.sink.add(bytes.Clone(f.buf.Bytes()))
+	return nil
+}
+
+func (f *postFormatter) End(w *bufio.Writer) error { return nil }
@@ -0,0 +1,714 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"regexp/syntax"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// recordReader yields input records one at a time with their terminators removed.
+// Next returns io.EOF once the input is exhausted.
+type recordReader interface {
+	Next() ([]byte, error)
+}
+
+// sourceNamer is implemented by readers of several inputs, to tell which
+// input the last record returned came from.
+type sourceNamer interface {
+	Source() string
+}
+
+// multiReader reads the records of several inputs in turn, opening each
+// only once the previous one is exhausted.
+type multiReader struct {
+	names   []string
+	open    func(name string) (recordReader, io.Closer, error)
+	current recordReader
+	closer  io.Closer
+	source  string
+}
+
+// newMultiReader returns a recordReader for the named inputs, each opened
+// with open.
+func newMultiReader(names []string, open func(name string) (recordReader, io.Closer, error)) *multiReader {
+	return &multiReader{names: names, open: open}
+}
+
+// Next returns the next record of the current input, moving on to the next
+// input at the end of each one.
+func (mr *multiReader) Next() ([]byte, error) {
+	for {
+		if mr.current == nil {
+			if len(mr.names) == 0 {
+				return nil, io.EOF
+			}
+			name := mr.names[0]
+			mr.names = mr.names[1:]
+			records, closer, err := mr.open(name)
+			if err != nil {
+				return nil, err
+			}
+			mr.current, mr.closer, mr.source = records, closer, name
+		}
+		line, err := mr.current.Next()
+		if err != io.EOF {
+			return line, err
+		}
+		if err := mr.closer.Close(); err != nil {
+			return nil, err
+		}
+		mr.current = nil
+	}
+}
+
+// Source returns the name of the input the last record came from.
+func (mr *multiReader) Source() string {
+	return mr.source
+}
+
+// readFileList returns the input names listed in the file listName, or
+// STDIN for "-", one per terminator-separated record. Empty records are
+// skipped.
+func readFileList(listName string, terminator byte) ([]string, error) {
+	list, err := openInput(listName)
+	if err != nil {
+		return nil, err
+	}
+	defer list.Close()
+	var names []string
+	err = forEachRecord(list, terminator, func(line []byte) error {
+		names = append(names, string(line))
+		return nil
+	})
+	return names, err
+}
+
+// Row returns the row of the last record, when the current input is read
+// by a rowSource.
+func (mr *multiReader) Row() []string {
+	if rows, ok := mr.current.(rowSource); ok {
+		return rows.Row()
+	}
+	return nil
+}
+
+// Raw reports whether the last record is input to copy untouched, when the
+// current input is read by a rawSource.
+func (mr *multiReader) Raw() bool {
+	raw, ok := mr.current.(rawSource)
+	return ok && raw.Raw()
+}
+
+// failSoftReader ends an input at its first read error, passing the error to
+// failed instead of returning it, for -keep-going. The records read before
+// the error are kept.
+type failSoftReader struct {
+	records recordReader
+	name    string
+	failed  func(error)
+	done    bool
+}
+
+func (r *failSoftReader) Next() ([]byte, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	line, err := r.records.Next()
+	if err != nil && err != io.EOF {
+		r.failed(fmt.Errorf("input '%s': %w", r.name, err))
+		r.done = true
+		return nil, io.EOF
+	}
+	return line, err
+}
+
+// Row returns the row of the last record, when the input is read by a
+// rowSource.
+func (r *failSoftReader) Row() []string {
+	if rows, ok := r.records.(rowSource); ok {
+		return rows.Row()
+	}
+	return nil
+}
+
+// skipReader discards the first records of an input, for -skip, counting
+// them in stats when it is set.
+type skipReader struct {
+	records recordReader
+	n       int
+	stats   *runStats
+}
+
+func (r *skipReader) Next() ([]byte, error) {
+	for ; r.n > 0; r.n-- {
+		if _, err := r.records.Next(); err != nil {
+			return nil, err
+		}
+		if r.stats != nil {
+			r.stats.read++
+			r.stats.skipped++
+		}
+	}
+	return r.records.Next()
+}
+
+// Row returns the row of the last record, when the input is read by a
+// rowSource.
+func (r *skipReader) Row() []string {
+	if rows, ok := r.records.(rowSource); ok {
+		return rows.Row()
+	}
+	return nil
+}
+
+// lineReader splits input into records on a single terminator byte.
+type lineReader struct {
+	reader *bufio.Reader
+	delim  byte
+}
+
+// newLineReader returns a recordReader that splits r on delim.
+func newLineReader(r *bufio.Reader, delim byte) *lineReader {
+	return &lineReader{reader: r, delim: delim}
+}
+
+// Next returns the next record. A final record without a trailing
+// terminator is returned as-is; a trailing terminator does not produce
+// an extra empty record.
+func (lr *lineReader) Next() ([]byte, error) {
+	line, err := lr.reader.ReadBytes(lr.delim)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.EOF
+	}
+
+	// Remove the delimiter from the end
+	if len(line) > 0 && line[len(line)-1] == lr.delim {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// separatorReader splits input into records on a multi-byte separator.
+type separatorReader struct {
+	reader *bufio.Reader
+	sep    []byte
+}
+
+// newSeparatorReader returns a recordReader that splits r on sep, using a
+// lineReader when sep is a single byte.
+func newSeparatorReader(r *bufio.Reader, sep string) recordReader {
+	if len(sep) == 1 {
+		return newLineReader(r, sep[0])
+	}
+	return &separatorReader{reader: r, sep: []byte(sep)}
+}
+
+// Next returns the next record, with the same handling of the end of input
+// as lineReader.
+func (sr *separatorReader) Next() ([]byte, error) {
+	var record []byte
+	for {
+		chunk, err := sr.reader.ReadBytes(sr.sep[len(sr.sep)-1])
+		record = append(record, chunk...)
+		if err == io.EOF {
+			if len(record) == 0 {
+				return nil, io.EOF
+			}
+			return record, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasSuffix(record, sr.sep) {
+			return record[:len(record)-len(sr.sep)], nil
+		}
+	}
+}
+
+// fixedReader splits input into records of a fixed number of bytes, with no
+// separator, for -record-len. The last record is shorter if the input ends
+// partway through one.
+type fixedReader struct {
+	reader *bufio.Reader
+	size   int
+}
+
+// newFixedReader returns a recordReader for the size-byte records of r.
+func newFixedReader(r *bufio.Reader, size int) *fixedReader {
+	return &fixedReader{reader: r, size: size}
+}
+
+func (fr *fixedReader) Next() ([]byte, error) {
+	record := make([]byte, fr.size)
+	n, err := io.ReadFull(fr.reader, record)
+	if err == io.ErrUnexpectedEOF {
+		return record[:n], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// regexReader splits input into records wherever a regular expression
+// matches. The text of the pattern's first capturing group, if any, is kept
+// at the start of the next record, so that a separator such as a timestamp
+// at the start of a line can stay with the record it begins.
+type regexReader struct {
+	reader  io.Reader
+	re      *regexp.Regexp
+	span    regexSpan
+	buf     []byte
+	from    int // where in buf the next search starts
+	prefix  []byte
+	eof     bool
+	started bool
+}
+
+// newRegexReader returns a recordReader that splits r wherever re matches.
+// re must not match the empty string.
+func newRegexReader(r io.Reader, re *regexp.Regexp) *regexReader {
+	return &regexReader{reader: r, re: re, span: newRegexSpan(re)}
+}
+
+// Next returns the next record. A match is used only once data after it has
+// arrived, or the input has ended, so that a separator such as \n{2,} is
+// taken whole. An empty record before a match at the very start of the
+// input is not returned.
+func (rr *regexReader) Next() ([]byte, error) {
+	for {
+		m := rr.re.FindSubmatchIndex(rr.buf[rr.from:])
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += rr.from
+			}
+		}
+		if m != nil && (m[1] < len(rr.buf) || rr.eof) {
+			record := append(rr.prefix, rr.buf[:m[0]]...)
+			rr.prefix = nil
+			if len(m) > 2 && m[2] >= 0 {
+				rr.prefix = append([]byte{}, rr.buf[m[2]:m[3]]...)
+			}
+			rr.buf, rr.from = rr.buf[m[1]:], 0
+			first := !rr.started
+			rr.started = true
+			if first && len(record) == 0 {
+				continue
+			}
+			return record, nil
+		}
+		if rr.eof {
+			if len(rr.buf) == 0 && rr.prefix == nil {
+				return nil, io.EOF
+			}
+			record := append(rr.prefix, rr.buf...)
+			rr.buf, rr.from, rr.prefix, rr.started = nil, 0, nil, true
+			return record, nil
+		}
+
+		// Rather than search a long record again from its start each time
+		// more arrives, continue from the earliest place a match can start
+		rr.from = rr.span.resume(rr.buf, rr.from, m)
+
+		// Read more, moving the unread data to the front of a buffer with
+		// room for it
+		if cap(rr.buf)-len(rr.buf) < 32*1024 {
+			grown := make([]byte, len(rr.buf), 2*len(rr.buf)+64*1024)
+			copy(grown, rr.buf)
+			rr.buf = grown
+		}
+		n, err := rr.reader.Read(rr.buf[len(rr.buf):cap(rr.buf)])
+		rr.buf = rr.buf[:len(rr.buf)+n]
+		if err == io.EOF {
+			rr.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// regexSpan describes the matches of an -irs-regex separator, so that
+// regexReader can tell how far back a match that is not yet complete could
+// start.
+type regexSpan struct {
+	maxLen    int       // longest match in bytes, or -1 if unbounded
+	bytes     [256]bool // bytes a match can contain
+	beginText bool      // uses ^ or \A, which match only at the start of the data
+	beginLine bool      // uses ^ with the m flag, which needs the byte before it
+	boundary  bool      // uses \b or \B, which need the byte before them
+}
+
+// newRegexSpan works out the regexSpan of re from its syntax.
+func newRegexSpan(re *regexp.Regexp) regexSpan {
+	tree, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		// Not expected, as re compiled; always search from the start
+		return regexSpan{beginText: true}
+	}
+	var s regexSpan
+	s.maxLen = s.add(tree.Simplify())
+	return s
+}
+
+// add records what re can match and returns the length in bytes of its
+// longest match, or -1 if there is no limit.
+func (s *regexSpan) add(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpNoMatch, syntax.OpEndLine, syntax.OpEndText:
+		return 0
+	case syntax.OpBeginText:
+		s.beginText = true
+		return 0
+	case syntax.OpBeginLine:
+		s.beginLine = true
+		return 0
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		s.boundary = true
+		return 0
+	case syntax.OpLiteral:
+		n := 0
+		for _, r := range re.Rune {
+			longest := s.addRange(r, r)
+			if re.Flags&syntax.FoldCase != 0 {
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					longest = max(longest, s.addRange(f, f))
+				}
+			}
+			n += longest
+		}
+		return n
+	case syntax.OpCharClass:
+		n := 0
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			n = max(n, s.addRange(re.Rune[i], re.Rune[i+1]))
+		}
+		return n
+	case syntax.OpAnyCharNotNL:
+		s.addRange(0, '\n'-1)
+		return s.addRange('\n'+1, unicode.MaxRune)
+	case syntax.OpAnyChar:
+		return s.addRange(0, unicode.MaxRune)
+	case syntax.OpCapture, syntax.OpQuest:
+		return s.add(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus:
+		s.add(re.Sub[0])
+		return -1
+	case syntax.OpRepeat:
+		n := s.add(re.Sub[0])
+		if n < 0 || re.Max < 0 {
+			return -1
+		}
+		return n * re.Max
+	case syntax.OpConcat, syntax.OpAlternate:
+		n := 0
+		for _, sub := range re.Sub {
+			m := s.add(sub)
+			switch {
+			case n < 0 || m < 0:
+				n = -1
+			case re.Op == syntax.OpConcat:
+				n += m
+			default:
+				n = max(n, m)
+			}
+		}
+		return n
+	}
+	// Unknown to this analysis; always search from the start
+	s.beginText = true
+	return -1
+}
+
+// addRange records that a match can contain the characters lo to hi, and
+// returns the length of the longest of them in bytes. Any character beyond
+// ASCII allows every non-ASCII byte, as does invalid UTF-8, which . matches.
+func (s *regexSpan) addRange(lo, hi rune) int {
+	for c := lo; c <= hi && c < utf8.RuneSelf; c++ {
+		s.bytes[c] = true
+	}
+	if hi < utf8.RuneSelf {
+		return 1
+	}
+	for c := utf8.RuneSelf; c < len(s.bytes); c++ {
+		s.bytes[c] = true
+	}
+	return utf8.UTFMax
+}
+
+// resume returns where in buf to continue the search for a separator once
+// more data is added to it, given that the last search started at from and
+// found m, a match not yet known to be complete, or nothing. A match that
+// can still appear must reach past the end of buf, so it starts after the
+// last byte no match can contain, and within the longest match of the end.
+func (s *regexSpan) resume(buf []byte, from int, m []int) int {
+	if s.beginText {
+		return 0
+	}
+	if s.maxLen >= 0 {
+		from = max(from, len(buf)-s.maxLen)
+	}
+	for i := len(buf) - 1; i >= from; i-- {
+		if !s.bytes[buf[i]] {
+			from = i + 1
+			break
+		}
+	}
+	if m != nil {
+		from = min(from, m[0])
+	}
+
+	// The search is of buf[from:], which must start with a whole character
+	// and with the context the assertions look back at
+	for from > 0 && from < len(buf) && !utf8.RuneStart(buf[from]) {
+		from--
+	}
+	if s.beginLine {
+		from = bytes.LastIndexByte(buf[:from], '\n') + 1
+	}
+	if s.boundary {
+		for from > 0 && isWordByte(buf[from-1]) {
+			from--
+		}
+	}
+	return from
+}
+
+// detectSeparator guesses the record separator of input from the data the
+// first read returned, without waiting for more: NUL if it holds at least as
+// many NULs as newlines, CRLF if any line ends with "\r\n", and otherwise a
+// newline.
+func detectSeparator(r *bufio.Reader) string {
+	r.Peek(1)
+	head, _ := r.Peek(r.Buffered())
+	nuls, newlines := bytes.Count(head, []byte{0}), bytes.Count(head, []byte{'\n'})
+	switch {
+	case nuls > 0 && nuls >= newlines:
+		return "\x00"
+	case bytes.Contains(head, []byte("\r\n")):
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// separatorNames describes the separators detectSeparator returns.
+var separatorNames = map[string]string{"\n": "LF", "\r\n": "CRLF", "\x00": "NUL"}
+
+// trimCRReader removes a trailing carriage return from each record, so that
+// CRLF and LF line endings can be read alike.
+type trimCRReader struct {
+	lines recordReader
+}
+
+func (tr *trimCRReader) Next() ([]byte, error) {
+	line, err := tr.lines.Next()
+	return bytes.TrimSuffix(line, []byte{'\r'}), err
+}
+
+// paragraphReader groups blank-line-separated blocks of lines into single records.
+type paragraphReader struct {
+	lines recordReader
+	sep   []byte
+}
+
+// newParagraphReader returns a recordReader that joins the lines of each
+// paragraph read from lines with sep. Runs of blank (or whitespace-only)
+// lines separate paragraphs and are otherwise discarded.
+func newParagraphReader(lines recordReader, sep string) *paragraphReader {
+	return &paragraphReader{lines: lines, sep: []byte(sep)}
+}
+
+// Next returns the next paragraph.
+func (pr *paragraphReader) Next() ([]byte, error) {
+	var para []byte
+	inPara := false
+
+	for {
+		line, err := pr.lines.Next()
+		if err == io.EOF {
+			if inPara {
+				return para, nil
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			if inPara {
+				return para, nil
+			}
+			// Skip leading blank lines
+			continue
+		}
+
+		if inPara {
+			para = append(para, pr.sep...)
+		}
+		para = append(para, line...)
+		inPara = true
+	}
+}
+
+// widthReader breaks records longer than a given number of characters into
+// several shorter records.
+type widthReader struct {
+	records   recordReader
+	width     int
+	wordBreak bool
+	pending   []byte
+}
+
+// newWidthReader returns a recordReader that splits each record from records
+// into pieces of at most width characters (runes). When wordBreak is set,
+// pieces are broken at the last whitespace within the limit where possible.
+func newWidthReader(records recordReader, width int, wordBreak bool) *widthReader {
+	return &widthReader{records: records, width: width, wordBreak: wordBreak}
+}
+
+// Next returns the next piece.
+func (wr *widthReader) Next() ([]byte, error) {
+	if wr.pending == nil {
+		line, err := wr.records.Next()
+		if err != nil {
+			return nil, err
+		}
+		wr.pending = line
+	}
+
+	piece, rest := splitAtWidth(wr.pending, wr.width, wr.wordBreak)
+	if len(rest) == 0 {
+		rest = nil
+	}
+	wr.pending = rest
+	return piece, nil
+}
+
+// splitAtWidth returns the first piece of line that fits within width runes
+// and the remainder. With wordBreak, the split happens at the last whitespace
+// run within the limit, which is dropped; lines without such a break point are
+// split at exactly width runes.
+func splitAtWidth(line []byte, width int, wordBreak bool) ([]byte, []byte) {
+	// Find the byte offset of the rune at index width
+	cut, runes := 0, 0
+	for cut < len(line) && runes < width {
+		_, size := utf8.DecodeRune(line[cut:])
+		cut += size
+		runes++
+	}
+	if cut >= len(line) {
+		return line, nil
+	}
+
+	if wordBreak {
+		// Break at whitespace immediately after the limit, or else at the
+		// last whitespace before it
+		breakAt := -1
+		if r, _ := utf8.DecodeRune(line[cut:]); unicode.IsSpace(r) {
+			breakAt = cut
+		} else {
+			breakAt = bytes.LastIndexFunc(line[:cut], unicode.IsSpace)
+		}
+		if breakAt >= 0 {
+			piece := bytes.TrimRightFunc(line[:breakAt], unicode.IsSpace)
+			if len(piece) > 0 {
+				return piece, bytes.TrimLeftFunc(line[breakAt:], unicode.IsSpace)
+			}
+		}
+	}
+	return line[:cut], line[cut:]
+}
+
+// idleReader reads records on a background goroutine so that a callback can
+// run, on the caller's goroutine, when no record arrives for a while.
+type idleReader struct {
+	records recordReader
+	idle    time.Duration
+	onIdle  func() error
+	results chan readResult
+}
+
+// readResult is the outcome of one Next call made by an idleReader.
+type readResult struct {
+	line []byte
+	err  error
+}
+
+// newIdleReader returns a recordReader that calls onIdle once each time a
+// call to Next has waited idle for the next record from records. Only one
+// read is in progress at a time, so records is never read ahead.
+func newIdleReader(records recordReader, idle time.Duration, onIdle func() error) *idleReader {
+	return &idleReader{records: records, idle: idle, onIdle: onIdle, results: make(chan readResult, 1)}
+}
+
+// Next returns the next record, running onIdle if it is slow to arrive.
+func (ir *idleReader) Next() ([]byte, error) {
+	go func() {
+		line, err := ir.records.Next()
+		ir.results <- readResult{line, err}
+	}()
+
+	timer := time.NewTimer(ir.idle)
+	defer timer.Stop()
+	for {
+		select {
+		case res := <-ir.results:
+			return res.line, res.err
+		case <-timer.C:
+			if err := ir.onIdle(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// stdinTimeoutReader fails if nothing arrives on its input within a time
+// limit, for -stdin-timeout, so that a pipeline whose upstream never writes
+// does not hang. Once data arrives, reads are passed straight through.
+type stdinTimeoutReader struct {
+	io.ReadCloser
+	timeout time.Duration
+	started bool
+	err     error
+}
+
+// newStdinTimeoutReader returns a reader of r that fails unless its first
+// data arrives within timeout.
+func newStdinTimeoutReader(r io.ReadCloser, timeout time.Duration) *stdinTimeoutReader {
+	return &stdinTimeoutReader{ReadCloser: r, timeout: timeout}
+}
+
+func (r *stdinTimeoutReader) Read(p []byte) (int, error) {
+	if r.started {
+		return r.ReadCloser.Read(p)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	// The read cannot be interrupted, so it fills its own buffer, which is
+	// abandoned if the time runs out
+	buf := make([]byte, len(p))
+	results := make(chan readResult, 1)
+	go func() {
+		n, err := r.ReadCloser.Read(buf)
+		results <- readResult{buf[:n], err}
+	}()
+	select {
+	case res := <-results:
+		r.started = true
+		return copy(p, res.line), res.err
+	case <-time.After(r.timeout):
+		r.err = fmt.Errorf("no input arrived on STDIN within %v", r.timeout)
+		return 0, r.err
+	}
+}
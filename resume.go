@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// progressWriter counts the bytes accepted by the underlying writer and
+// remembers the first error it returns.
+type progressWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	return n, err
+}
+
+// outputProgress tracks how many records have completely reached the
+// output, as opposed to sitting in the write buffer, so that a failed run
+// can report, and later resume from, the last complete record.
+type outputProgress struct {
+	out      *progressWriter
+	writer   *bufio.Writer
+	pending  []int64 // output offsets at which pending records end
+	complete int     // records handled whose output has been fully written
+}
+
+// newOutputProgress returns a tracker for records written to writer, which
+// must write to out.
+func newOutputProgress(out *progressWriter, writer *bufio.Writer) *outputProgress {
+	return &outputProgress{out: out, writer: writer}
+}
+
+// recordDone notes that a record has been handled: written to the buffer,
+// or dropped. It is complete once everything buffered so far is written.
+func (p *outputProgress) recordDone() {
+	p.pending = append(p.pending, p.out.n+int64(p.writer.Buffered()))
+	i := 0
+	for i < len(p.pending) && p.pending[i] <= p.out.n {
+		i++
+	}
+	p.complete += i
+	p.pending = p.pending[i:]
+}
+
+// resumeState records how far a failed run got, for -resume-state.
+type resumeState struct {
+	Input   string `json:"input"`
+	Records int    `json:"records"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// loadResumeState reads a state file left by a failed run. A missing file
+// means there is nothing to resume and returns nil.
+func loadResumeState(filename string) (*resumeState, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resume state: %w", err)
+	}
+	var state resumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid resume state file '%s': %w", filename, err)
+	}
+	if state.Records < 0 || state.Bytes < 0 {
+		return nil, fmt.Errorf("invalid resume state file '%s': negative position", filename)
+	}
+	return &state, nil
+}
+
+// save writes the state to filename.
+func (s *resumeState) save(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// openResumedOutput opens an output file left by a failed run and cuts it
+// back to the end of the last complete record, ready for appending.
+func openResumedOutput(filename string, state *resumeState) (*os.File, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err == nil && info.Size() < state.Bytes {
+		err = fmt.Errorf("file is %d bytes, shorter than the %d bytes recorded in the resume state", info.Size(), state.Bytes)
+	}
+	if err == nil {
+		err = file.Truncate(state.Bytes)
+	}
+	if err == nil {
+		_, err = file.Seek(state.Bytes, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// reportOutputFailure explains a failed write: how many records of input
+// were completely written and, with a state filename, saves where to resume.
+// base is the state the run resumed from, if any. It does nothing if the
+// output did not fail.
+func reportOutputFailure(p *outputProgress, base *resumeState, stateFile, input string) {
+	if p == nil || p.out.err == nil {
+		return
+	}
+	records, written := p.complete, p.out.n
+	if base != nil {
+		records += base.Records
+		written += base.Bytes
+	}
+	reason := "output failed"
+	if errors.Is(p.out.err, syscall.ENOSPC) {
+		reason = "output device is full"
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s; the first %d records are completely written (%d bytes)\n", pgmName, reason, records, written)
+
+	if stateFile == "" {
+		return
+	}
+	state := &resumeState{Input: input, Records: records, Bytes: written}
+	if err := state.save(stateFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save resume state: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: saved resume state to '%s'; run the same command again to continue\n", pgmName, stateFile)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// peakRSS is not supported on this platform.
+func peakRSS() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"math/rand/v2"
+	"slices"
+)
+
+// sampler chooses records at random for -sample and -sample-n. The same
+// seed always makes the same choices for the same input.
+type sampler struct {
+	fraction float64 // for -sample; 0 with -sample-n
+	size     int     // for -sample-n; 0 with -sample
+	rng      *rand.Rand
+}
+
+// newSampler returns a sampler for -sample fraction or -sample-n size.
+func newSampler(fraction float64, size int, seed uint64) *sampler {
+	return &sampler{fraction: fraction, size: size, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// randomSeed returns a seed for when -seed is not given.
+func randomSeed() uint64 {
+	return rand.Uint64()
+}
+
+// keep reports whether -sample keeps the next record. With -sample-n, which
+// chooses records with a reservoir, it keeps every one.
+func (s *sampler) keep() bool {
+	return s.fraction == 0 || s.rng.Float64() < s.fraction
+}
+
+// sampledRecord is a record chosen by -sample-n, with its position in the
+// input so the sample can be written in input order.
+type sampledRecord struct {
+	line []byte
+	meta recordMeta
+	seq  int
+}
+
+// reservoir keeps a uniform random sample of the records added to it, of at
+// most size records, for -sample-n. It uses reservoir sampling (Algorithm R),
+// so the input is read once and memory depends only on the sample size.
+type reservoir struct {
+	records []sampledRecord
+	size    int
+	seen    int
+	rng     *rand.Rand
+}
+
+// newReservoir returns a reservoir that keeps size records chosen with rng.
+func newReservoir(size int, rng *rand.Rand) *reservoir {
+	return &reservoir{records: make([]sampledRecord, 0, size), size: size, rng: rng}
+}
+
+// add offers a record to the sample, and reports whether a record, this one
+// or one chosen earlier, was left out of it as a result.
+func (r *reservoir) add(line []byte, meta recordMeta) bool {
+	r.seen++
+	if len(r.records) < r.size {
+		r.records = append(r.records, sampledRecord{line: bytes.Clone(line), meta: meta, seq: r.seen})
+		return false
+	}
+	if i := r.rng.IntN(r.seen); i < r.size {
+		r.records[i] = sampledRecord{line: bytes.Clone(line), meta: meta, seq: r.seen}
+	}
+	return true
+}
+
+// each calls fn with the sampled records in input order, stopping at an
+// error.
+func (r *reservoir) each(fn func(line []byte, meta recordMeta) error) error {
+	slices.SortFunc(r.records, func(a, b sampledRecord) int { return cmp.Compare(a.seq, b.seq) })
+	for _, record := range r.records {
+		if err := fn(record.line, record.meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// setOps lists the operations supported by the "set" subcommand.
+var setOps = []string{"union", "intersect", "subtract"}
+
+// inputSize returns the size of the named input and whether it is known.
+// The size of STDIN and other non-regular files is unknown.
+func inputSize(filename string) (int64, bool) {
+	if filename == "-" {
+		return 0, false
+	}
+	info, err := os.Stat(filename)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// openInput opens filename for reading, treating "-" as STDIN.
+func openInput(filename string) (io.ReadCloser, error) {
+	if filename == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(filename)
+}
+
+// forEachRecord calls fn for every non-empty record in r.
+func forEachRecord(r io.Reader, terminator byte, fn func(line []byte) error) error {
+	records := newLineReader(bufio.NewReader(r), terminator)
+	for {
+		line, err := records.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+}
+
+// memorySetOp performs op on the records of a and b using in-memory hash sets
+// and calls emit for each resulting record, once, in input order: A's order
+// for intersect and subtract, A then B for union.
+func memorySetOp(op string, a, b io.Reader, terminator byte, emit func(line []byte) error) error {
+	set := make(map[string]struct{})
+
+	if op == "union" {
+		both := func(line []byte) error {
+			if _, ok := set[string(line)]; ok {
+				return nil
+			}
+			set[string(line)] = struct{}{}
+			return emit(line)
+		}
+		if err := forEachRecord(a, terminator, both); err != nil {
+			return err
+		}
+		return forEachRecord(b, terminator, both)
+	}
+
+	// Load B, then stream A against it
+	if err := forEachRecord(b, terminator, func(line []byte) error {
+		set[string(line)] = struct{}{}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return forEachRecord(a, terminator, func(line []byte) error {
+		_, inB := set[string(line)]
+		switch {
+		case op == "intersect" && inB:
+			// Remove so that duplicates in A are emitted once
+			delete(set, string(line))
+			return emit(line)
+		case op == "subtract" && !inB:
+			// Add so that duplicates in A are emitted once
+			set[string(line)] = struct{}{}
+			return emit(line)
+		}
+		return nil
+	})
+}
+
+// partitionInput splits the records of r into the given partition files by
+// hash, so that equal records always land in the same partition.
+func partitionInput(r io.Reader, terminator byte, files []*os.File) error {
+	writers := make([]*bufio.Writer, len(files))
+	for i, f := range files {
+		writers[i] = bufio.NewWriter(f)
+	}
+
+	h := fnv.New64a()
+	err := forEachRecord(r, terminator, func(line []byte) error {
+		h.Reset()
+		h.Write(line)
+		w := writers[h.Sum64()%uint64(len(writers))]
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		return w.WriteByte(terminator)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, w := range writers {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spillSetOp performs op by first partitioning both inputs by hash into
+// temporary files and then running memorySetOp on each pair of partitions,
+// so that only one partition needs to fit in memory at a time.
+func spillSetOp(op string, a, b io.Reader, terminator byte, partitions int, emit func(line []byte) error) error {
+	tmpDir, err := os.MkdirTemp("", pgmName+"-set-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	create := func(side string) ([]*os.File, error) {
+		files := make([]*os.File, partitions)
+		for i := range files {
+			f, err := os.Create(filepath.Join(tmpDir, fmt.Sprintf("%s.%04d", side, i)))
+			if err != nil {
+				return files, err
+			}
+			files[i] = f
+		}
+		return files, nil
+	}
+	closeAll := func(files []*os.File) {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}
+
+	filesA, err := create("a")
+	defer closeAll(filesA)
+	if err != nil {
+		return err
+	}
+	filesB, err := create("b")
+	defer closeAll(filesB)
+	if err != nil {
+		return err
+	}
+
+	if err := partitionInput(a, terminator, filesA); err != nil {
+		return err
+	}
+	if err := partitionInput(b, terminator, filesB); err != nil {
+		return err
+	}
+
+	for i := range partitions {
+		for _, f := range []*os.File{filesA[i], filesB[i]} {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		if err := memorySetOp(op, filesA[i], filesB[i], terminator, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runSet implements the "set" subcommand, which performs a line-set
+// operation between two inputs and wraps the result.
+func runSet(args []string) {
+	fs := flag.NewFlagSet(pgmName+" set", flag.ExitOnError)
+	delimiterArg := fs.String("d", "\"", "delimiter to wrap lines with (or hex value with 0x prefix, or @file to read it from a file)")
+	escapeDelim := fs.Bool("escape", false, "escape delimiter characters within lines")
+	outputFile := fs.String("o", "", "output file (default: STDOUT)")
+	nullTerminated := fs.Bool("0", false, "read null-terminated records instead of newlines")
+	maxMemoryArg := fs.String("max-memory", "256m", "inputs larger than this are partitioned to temporary files")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s set [options] %s A B\n\n", pgmName, strings.Join(setOps, "|"))
+		fmt.Fprintf(fs.Output(), "Perform a line-set operation between inputs A and B ('-' for STDIN) and wrap the result.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	op, pathA, pathB := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	if !slices.Contains(setOps, op) {
+		fmt.Fprintf(os.Stderr, "Error: unknown set operation '%s' (supported: %s)\n", op, strings.Join(setOps, ", "))
+		os.Exit(1)
+	}
+	if pathA == "-" && pathB == "-" {
+		fmt.Fprintln(os.Stderr, "Error: only one input may be STDIN")
+		os.Exit(1)
+	}
+
+	delimiter, err := parseDelimiterArg(*delimiterArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid delimiter: %v\n", err)
+		os.Exit(1)
+	}
+	maxMemory, err := parseSize(*maxMemoryArg)
+	if err != nil || maxMemory <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -max-memory value '%s'\n", *maxMemoryArg)
+		os.Exit(1)
+	}
+
+	var inputs [2]io.ReadCloser
+	for i, path := range []string{pathA, pathB} {
+		inputs[i], err = openInput(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to open file '%s': %v\n", path, err)
+			os.Exit(1)
+		}
+		defer inputs[i].Close()
+	}
+
+	var output io.Writer = os.Stdout
+	if *outputFile != "" {
+		outFile, err := os.Create(*outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create output file '%s': %v\n", *outputFile, err)
+			os.Exit(1)
+		}
+		defer outFile.Close()
+		output = outFile
+	}
+	writer := bufio.NewWriter(output)
+
+	var terminator byte = '\n'
+	if *nullTerminated {
+		terminator = 0
+	}
+
+	format := newDelimiterFormatter(delimiter, "\n", *escapeDelim)
+	num := 0
+	emit := func(line []byte) error {
+		num++
+		return format.Record(writer, line, recordMeta{num: num})
+	}
+
+	// Use in-memory sets only when both inputs are known to fit
+	sizeA, knownA := inputSize(pathA)
+	sizeB, knownB := inputSize(pathB)
+	if knownA && knownB && sizeA+sizeB <= maxMemory {
+		err = memorySetOp(op, inputs[0], inputs[1], terminator, emit)
+	} else {
+		partitions := 64
+		if knownA && knownB {
+			partitions = int(2*(sizeA+sizeB)/maxMemory) + 2
+		}
+		err = spillSetOp(op, inputs[0], inputs[1], terminator, partitions, emit)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := writer.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
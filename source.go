@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ASCII unit and record separators, as used by the sqlite3 tool's ascii mode.
+const (
+	asciiUnitSep   = 0x1F
+	asciiRecordSep = 0x1E
+)
+
+// sqliteQueryReader yields the first column of each row returned by a query,
+// streamed from the sqlite3 command-line tool.
+type sqliteQueryReader struct {
+	cmd  *exec.Cmd
+	rows *lineReader
+}
+
+// newSQLiteQueryReader runs query against dbFile. The sqlite3 tool's ascii
+// output mode is used so that values may contain newlines.
+func newSQLiteQueryReader(dbFile, query string) (*sqliteQueryReader, error) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return nil, fmt.Errorf("SQLite input requires the sqlite3 command-line tool: %w", err)
+	}
+	if _, err := os.Stat(dbFile); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	cmd := exec.Command("sqlite3", "-batch", "-bail", "-readonly", "-ascii", "-noheader", dbFile, query)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start sqlite3: %w", err)
+	}
+	return &sqliteQueryReader{cmd: cmd, rows: newLineReader(bufio.NewReader(stdout), asciiRecordSep)}, nil
+}
+
+// Next returns the first column of the next row.
+func (r *sqliteQueryReader) Next() ([]byte, error) {
+	row, err := r.rows.Next()
+	if err == io.EOF {
+		if err := r.cmd.Wait(); err != nil {
+			return nil, fmt.Errorf("sqlite3: %w", err)
+		}
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(row, asciiUnitSep); i >= 0 {
+		row = row[:i]
+	}
+	return row, nil
+}
+
+// csvColumnReader yields the values of one named column of a CSV file.
+type csvColumnReader struct {
+	reader *csv.Reader
+	index  int
+}
+
+// newCSVColumnReader reads the header row of r and locates column name. A
+// name that matches no header but is a positive number selects the column by
+// its 1-based position.
+func newCSVColumnReader(r io.Reader, name string) (*csvColumnReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV input has no header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	for i, col := range header {
+		// Tolerate a UTF-8 byte order mark before the first header
+		if i == 0 {
+			col = strings.TrimPrefix(col, "\ufeff")
+		}
+		if col == name {
+			return &csvColumnReader{reader: reader, index: i}, nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return &csvColumnReader{reader: reader, index: n - 1}, nil
+	}
+	return nil, fmt.Errorf("CSV column '%s' not found in header", name)
+}
+
+// Next returns the column's value from the next row. Rows too short to
+// contain the column yield an empty value.
+func (r *csvColumnReader) Next() ([]byte, error) {
+	row, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if r.index >= len(row) {
+		return []byte{}, nil
+	}
+	return []byte(row[r.index]), nil
+}
+
+// sourceOverrideKeys lists the settings an input argument may override.
+var sourceOverrideKeys = []string{"d", "format", "field"}
+
+// parseSourceSpec splits an input argument of the form FILE?key=value&...
+// into the filename and its overrides. An argument that names an existing
+// file, or has no '?', is returned unchanged with no overrides.
+func parseSourceSpec(arg string) (string, map[string]string, error) {
+	i := strings.LastIndex(arg, "?")
+	if i < 0 {
+		return arg, nil, nil
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return arg, nil, nil
+	}
+
+	name := arg[:i]
+	query, err := url.ParseQuery(arg[i+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid overrides for input '%s': %w", name, err)
+	}
+	overrides := make(map[string]string)
+	for key, values := range query {
+		if !slices.Contains(sourceOverrideKeys, key) {
+			return "", nil, fmt.Errorf("unknown override '%s' for input '%s' (supported: %s)", key, name, strings.Join(sourceOverrideKeys, ", "))
+		}
+		if len(values) > 1 {
+			return "", nil, fmt.Errorf("override '%s' given more than once for input '%s'", key, name)
+		}
+		overrides[key] = values[0]
+	}
+
+	switch overrides["format"] {
+	case "", "lines":
+		if _, ok := overrides["field"]; ok {
+			return "", nil, fmt.Errorf("override 'field' for input '%s' requires format=csv", name)
+		}
+	case "csv":
+		if overrides["field"] == "" {
+			return "", nil, fmt.Errorf("override format=csv for input '%s' requires a field", name)
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown input format '%s' for input '%s' (supported: lines, csv)", overrides["format"], name)
+	}
+	return name, overrides, nil
+}
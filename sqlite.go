@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sqliteColumnNames lists the optional columns that -sqlite-cols accepts.
+var sqliteColumnNames = []string{"n", "file", "hash"}
+
+// parseSQLiteColumns validates a comma-separated list of optional columns.
+func parseSQLiteColumns(arg string) ([]string, error) {
+	var cols []string
+	for _, col := range strings.Split(arg, ",") {
+		col = strings.TrimSpace(col)
+		if !slices.Contains(sqliteColumnNames, col) {
+			return nil, fmt.Errorf("unknown SQLite column '%s' (supported: %s)", col, strings.Join(sqliteColumnNames, ", "))
+		}
+		if slices.Contains(cols, col) {
+			return nil, fmt.Errorf("duplicate SQLite column '%s'", col)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// quoteSQLIdentifier returns name as a double-quoted SQL identifier.
+func quoteSQLIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// appendSQLiteText appends s to buf as a SQLite text value. Values containing
+// NUL bytes, which cannot appear in SQL text, are written as a blob literal
+// cast to text.
+func appendSQLiteText(buf []byte, s []byte) []byte {
+	if bytes.IndexByte(s, 0) < 0 {
+		return appendSQLString(buf, s, false)
+	}
+	buf = append(buf, "CAST(X'"...)
+	buf = hex.AppendEncode(buf, s)
+	return append(buf, "' AS TEXT)"...)
+}
+
+// sqliteFormatter inserts records into a SQLite database by streaming SQL to
+// the sqlite3 command-line tool. Inserts are grouped into transactions of
+// batchSize rows, and an index on the line column is built at the end.
+type sqliteFormatter struct {
+	dbFile    string
+	table     string
+	columns   []string
+	batchSize int
+
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	sql       *bufio.Writer
+	inBatch   int
+	outputBuf []byte
+}
+
+// newSQLiteFormatter returns a formatter for -o sqlite:FILE.
+func newSQLiteFormatter(dbFile, table string, columns []string, batchSize int) *sqliteFormatter {
+	return &sqliteFormatter{dbFile: dbFile, table: table, columns: columns, batchSize: batchSize}
+}
+
+func (f *sqliteFormatter) Begin(w *bufio.Writer) error {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return fmt.Errorf("SQLite output requires the sqlite3 command-line tool: %w", err)
+	}
+
+	f.cmd = exec.Command("sqlite3", "-batch", "-bail", f.dbFile)
+	f.cmd.Stdout = os.Stderr
+	f.cmd.Stderr = os.Stderr
+	stdin, err := f.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := f.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start sqlite3: %w", err)
+	}
+	f.stdin = stdin
+	f.sql = bufio.NewWriterSize(stdin, 64*1024)
+
+	var defs []string
+	for _, col := range f.columns {
+		switch col {
+		case "n":
+			defs = append(defs, "n INTEGER")
+		case "file", "hash":
+			defs = append(defs, col+" TEXT")
+		}
+	}
+	defs = append(defs, "line TEXT")
+	fmt.Fprintf(f.sql, "CREATE TABLE IF NOT EXISTS %s (%s);\nBEGIN;\n", quoteSQLIdentifier(f.table), strings.Join(defs, ", "))
+	return nil
+}
+
+func (f *sqliteFormatter) Record(w *bufio.Writer, line []byte, meta recordMeta) error {
+	f.outputBuf = append(f.outputBuf[:0], "INSERT INTO "...)
+	f.outputBuf = append(f.outputBuf, quoteSQLIdentifier(f.table)...)
+	f.outputBuf = append(f.outputBuf, " VALUES ("...)
+	for _, col := range f.columns {
+		switch col {
+		case "n":
+			f.outputBuf = strconv.AppendInt(f.outputBuf, int64(meta.num), 10)
+		case "file":
+			f.outputBuf = appendSQLiteText(f.outputBuf, []byte(meta.source))
+		case "hash":
+			sum := sha256.Sum256(line)
+			f.outputBuf = append(f.outputBuf, '\'')
+			f.outputBuf = hex.AppendEncode(f.outputBuf, sum[:])
+			f.outputBuf = append(f.outputBuf, '\'')
+		}
+		f.outputBuf = append(f.outputBuf, ", "...)
+	}
+	f.outputBuf = appendSQLiteText(f.outputBuf, line)
+	f.outputBuf = append(f.outputBuf, ");\n"...)
+
+	f.inBatch++
+	if f.inBatch >= f.batchSize {
+		f.outputBuf = append(f.outputBuf, "COMMIT;\nBEGIN;\n"...)
+		f.inBatch = 0
+	}
+
+	if _, err := f.sql.Write(f.outputBuf); err != nil {
+		return fmt.Errorf("sqlite3: %w", err)
+	}
+	return nil
+}
+
+func (f *sqliteFormatter) End(w *bufio.Writer) error {
+	table := quoteSQLIdentifier(f.table)
+	index := quoteSQLIdentifier(f.table + "_line")
+	fmt.Fprintf(f.sql, "COMMIT;\nCREATE INDEX IF NOT EXISTS %s ON %s (line);\n", index, table)
+
+	flushErr := f.sql.Flush()
+	f.stdin.Close()
+	if err := f.cmd.Wait(); err != nil {
+		return fmt.Errorf("sqlite3: %w", err)
+	}
+	if flushErr != nil {
+		return fmt.Errorf("sqlite3: %w", flushErr)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// runStats counts records as they pass through wrapRecords. Every record
+// read is either written or counted under exactly one drop reason.
+type runStats struct {
+	read         int
+	written      int
+	skipped      int // leading records discarded by -skip
+	droppedEmpty int // empty records skipped with -e
+	droppedLast  int // empty final record, always skipped
+	filtered     int // records rejected by -include-file, -exclude-file, -grep, or -grep-v
+	beforeTail   int // records before the last -tail N
+	unsampled    int // records left out by -sample or -sample-n
+}
+
+// dropped returns the number of records read but not written.
+func (s *runStats) dropped() int {
+	return s.skipped + s.droppedEmpty + s.droppedLast + s.filtered + s.beforeTail + s.unsampled
+}
+
+// reportStats writes record counts to w.
+func reportStats(w io.Writer, s *runStats) {
+	fmt.Fprintf(w, "%s: record stats\n", pgmName)
+	fmt.Fprintf(w, "  read:              %d\n", s.read)
+	fmt.Fprintf(w, "  written:           %d\n", s.written)
+	fmt.Fprintf(w, "  dropped:           %d\n", s.dropped())
+	fmt.Fprintf(w, "    skipped (-skip): %d\n", s.skipped)
+	fmt.Fprintf(w, "    empty (-e):      %d\n", s.droppedEmpty)
+	fmt.Fprintf(w, "    empty last line: %d\n", s.droppedLast)
+	fmt.Fprintf(w, "    filtered:        %d\n", s.filtered)
+	fmt.Fprintf(w, "    before -tail:    %d\n", s.beforeTail)
+	fmt.Fprintf(w, "    not sampled:     %d\n", s.unsampled)
+}
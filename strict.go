@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"unicode/utf8"
+)
+
+// strictMaxRecord is the record size limit applied by -strict when
+// -max-record is not given.
+const strictMaxRecord = 16 << 20
+
+// recordCheck returns an error if a record must not be written. Checks run
+// on the final record, after transforms and filters, and abort the run.
+type recordCheck func(line []byte, meta recordMeta) error
+
+// checkUTF8 rejects records that are not valid UTF-8.
+func checkUTF8(line []byte, meta recordMeta) error {
+	if !utf8.Valid(line) {
+		return fmt.Errorf("record %d is not valid UTF-8", meta.num)
+	}
+	return nil
+}
+
+// newSizeCheck returns a check that rejects records longer than max bytes.
+func newSizeCheck(max int64) recordCheck {
+	return func(line []byte, meta recordMeta) error {
+		if int64(len(line)) > max {
+			return fmt.Errorf("record %d is %d bytes, over the limit of %s", meta.num, len(line), formatBytes(uint64(max)))
+		}
+		return nil
+	}
+}
+
+// newCollisionCheck returns a check that rejects records containing the
+// delimiter, which would make the wrapped output ambiguous.
+func newCollisionCheck(delimiter string) recordCheck {
+	delim := []byte(delimiter)
+	return func(line []byte, meta recordMeta) error {
+		if bytes.Contains(line, delim) {
+			return fmt.Errorf("record %d contains the delimiter '%s' (use -escape or another delimiter)", meta.num, delimiter)
+		}
+		return nil
+	}
+}
+
+// ineffectiveFlags returns the names of flags that were set on the command
+// line but have no effect, as listed in active, in lexical order. Flags not in
+// active are always considered effective.
+func ineffectiveFlags(active map[string]bool) []string {
+	var names []string
+	flag.Visit(func(f *flag.Flag) {
+		if effective, ok := active[f.Name]; ok && !effective {
+			names = append(names, f.Name)
+		}
+	})
+	return names
+}
@@ -0,0 +1,46 @@
+package main
+
+import "bytes"
+
+// tailRecord is a record held back by -tail, with its metadata.
+type tailRecord struct {
+	line []byte
+	meta recordMeta
+}
+
+// recordRing keeps the last records added to it, for -tail, so memory use
+// depends on the number kept rather than on the size of the input.
+type recordRing struct {
+	records []tailRecord
+	start   int // index of the oldest record once the ring is full
+	size    int
+}
+
+// newRecordRing returns a ring that keeps the last size records.
+func newRecordRing(size int) *recordRing {
+	return &recordRing{records: make([]tailRecord, 0, size), size: size}
+}
+
+// add keeps a copy of line, and reports whether the oldest record was
+// discarded to make room for it.
+func (r *recordRing) add(line []byte, meta recordMeta) bool {
+	record := tailRecord{line: bytes.Clone(line), meta: meta}
+	if len(r.records) < r.size {
+		r.records = append(r.records, record)
+		return false
+	}
+	r.records[r.start] = record
+	r.start = (r.start + 1) % r.size
+	return true
+}
+
+// each calls fn with the kept records, oldest first, stopping at an error.
+func (r *recordRing) each(fn func(line []byte, meta recordMeta) error) error {
+	for i := range r.records {
+		record := r.records[(r.start+i)%len(r.records)]
+		if err := fn(record.line, record.meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// transformer rewrites a record before it is wrapped.
+type transformer interface {
+	Transform(line []byte) ([]byte, error)
+}
+
+// transformFunc adapts an infallible function to the transformer interface.
+type transformFunc func(line []byte) []byte
+
+// Transform calls f(line).
+func (f transformFunc) Transform(line []byte) ([]byte, error) {
+	return f(line), nil
+}
+
+// recordEncodings lists the values accepted by -encode.
+var recordEncodings = []string{"hex", "base64"}
+
+// newEncodeTransform returns the transform for -encode, which replaces each
+// record with its hex or base64 encoding so binary data can be wrapped.
+func newEncodeTransform(encoding string) (transformer, error) {
+	switch encoding {
+	case "hex":
+		return transformFunc(func(line []byte) []byte { return hex.AppendEncode(nil, line) }), nil
+	case "base64":
+		return transformFunc(func(line []byte) []byte { return base64.StdEncoding.AppendEncode(nil, line) }), nil
+	}
+	return nil, fmt.Errorf("unknown -encode '%s' (supported: %s)", encoding, strings.Join(recordEncodings, ", "))
+}
+
+// lineEdit is one occurrence of a line-editing flag, such as -s or -sub,
+// with its value.
+type lineEdit struct {
+	name  string
+	value string
+}
+
+// editFlag is the flag.Value of a line-editing flag. The editing flags all
+// append to the same list, so edits can be repeated and mixed, and are
+// applied in the order they appear on the command line.
+type editFlag struct {
+	name    string
+	boolean bool // a switch such as -s, rather than a flag with a value
+	edits   *[]lineEdit
+}
+
+func (f *editFlag) String() string {
+	return ""
+}
+
+func (f *editFlag) Set(value string) error {
+	if f.boolean {
+		on, err := strconv.ParseBool(value)
+		if err != nil || !on {
+			return err
+		}
+	}
+	*f.edits = append(*f.edits, lineEdit{name: f.name, value: value})
+	return nil
+}
+
+// IsBoolFlag lets a switch be given without a value.
+func (f *editFlag) IsBoolFlag() bool {
+	return f.boolean
+}
+
+// newEditTransform returns the transform for one line edit.
+func newEditTransform(e lineEdit) (transformer, error) {
+	switch e.name {
+	case "s":
+		return transformFunc(stripWhitespace), nil
+	case "sl":
+		return transformFunc(func(line []byte) []byte { return bytes.TrimLeftFunc(line, unicode.IsSpace) }), nil
+	case "sr":
+		return transformFunc(func(line []byte) []byte { return bytes.TrimRightFunc(line, unicode.IsSpace) }), nil
+	case "squeeze":
+		return transformFunc(squeezeSpace), nil
+	case "sub":
+		return parseSubstitution(e.value)
+	case "upper", "lower", "title":
+		return changeCase(e.name), nil
+	case "trim-chars":
+		return transformFunc(func(line []byte) []byte { return bytes.Trim(line, e.value) }), nil
+	}
+	return nil, fmt.Errorf("unknown line edit -%s", e.name)
+}
+
+// stripWhitespace removes leading and trailing whitespace.
+func stripWhitespace(line []byte) []byte {
+	return bytes.TrimSpace(line)
+}
+
+// squeezeSpace replaces each run of whitespace inside line with a single
+// space, for -squeeze. Whitespace at either end is left for -s, -sl, and -sr.
+func squeezeSpace(line []byte) []byte {
+	start := len(line) - len(bytes.TrimLeftFunc(line, unicode.IsSpace))
+	end := len(bytes.TrimRightFunc(line, unicode.IsSpace))
+	if start >= end {
+		return line
+	}
+	out := append([]byte(nil), line[:start]...)
+	out = append(out, bytes.Join(bytes.Fields(line[start:end]), []byte(" "))...)
+	return append(out, line[end:]...)
+}
+
+// changeCase returns the transform for -upper, -lower, or -title, which use
+// the full Unicode case mappings, so "ß" upper-cases to "SS". -title
+// upper-cases the first letter of each word and lower-cases the rest.
+func changeCase(mode string) transformer {
+	var caser cases.Caser
+	switch mode {
+	case "upper":
+		caser = cases.Upper(language.Und)
+	case "lower":
+		caser = cases.Lower(language.Und)
+	default:
+		caser = cases.Title(language.Und)
+	}
+	return transformFunc(caser.Bytes)
+}
+
+// isInvisible reports whether r is a soft hyphen, zero-width character, or
+// bidirectional formatting mark.
+func isInvisible(r rune) bool {
+	switch {
+	case r == 0x00AD: // soft hyphen
+		return true
+	case r == 0x061C: // Arabic letter mark
+		return true
+	case r == 0x180E: // Mongolian vowel separator
+		return true
+	case r >= 0x200B && r <= 0x200F: // zero-width space, non-joiner, joiner, LRM, RLM
+		return true
+	case r >= 0x202A && r <= 0x202E: // bidirectional embeddings and overrides
+		return true
+	case r >= 0x2060 && r <= 0x2064: // word joiner and invisible operators
+		return true
+	case r >= 0x2066 && r <= 0x2069: // bidirectional isolates
+		return true
+	case r == 0xFEFF: // zero-width no-break space (BOM)
+		return true
+	}
+	return false
+}
+
+// stripInvisible removes invisible characters (see isInvisible) from line.
+// Invalid UTF-8 sequences are left untouched.
+func stripInvisible(line []byte) []byte {
+	// Avoid copying lines that contain nothing to remove
+	i := 0
+	for i < len(line) {
+		r, size := utf8.DecodeRune(line[i:])
+		if isInvisible(r) {
+			break
+		}
+		i += size
+	}
+	if i == len(line) {
+		return line
+	}
+
+	out := make([]byte, i, len(line))
+	copy(out, line[:i])
+	for i < len(line) {
+		r, size := utf8.DecodeRune(line[i:])
+		if !isInvisible(r) {
+			out = append(out, line[i:i+size]...)
+		}
+		i += size
+	}
+	return out
+}
+
+// defaultConfusables maps common look-alike characters found in copy-pasted
+// text to their ASCII equivalents. Fullwidth ASCII forms are handled
+// separately by deconfuser.
+var defaultConfusables = map[rune]string{
+	0x00A0: " ",   // no-break space
+	0x2000: " ",   // en quad
+	0x2001: " ",   // em quad
+	0x2002: " ",   // en space
+	0x2003: " ",   // em space
+	0x2004: " ",   // three-per-em space
+	0x2005: " ",   // four-per-em space
+	0x2006: " ",   // six-per-em space
+	0x2007: " ",   // figure space
+	0x2008: " ",   // punctuation space
+	0x2009: " ",   // thin space
+	0x200A: " ",   // hair space
+	0x202F: " ",   // narrow no-break space
+	0x205F: " ",   // medium mathematical space
+	0x3000: " ",   // ideographic space
+	0x2018: "'",   // left single quotation mark
+	0x2019: "'",   // right single quotation mark
+	0x201A: "'",   // single low-9 quotation mark
+	0x201B: "'",   // single high-reversed-9 quotation mark
+	0x2032: "'",   // prime
+	0x201C: "\"",  // left double quotation mark
+	0x201D: "\"",  // right double quotation mark
+	0x201E: "\"",  // double low-9 quotation mark
+	0x201F: "\"",  // double high-reversed-9 quotation mark
+	0x2033: "\"",  // double prime
+	0x2010: "-",   // hyphen
+	0x2011: "-",   // non-breaking hyphen
+	0x2012: "-",   // figure dash
+	0x2013: "-",   // en dash
+	0x2014: "-",   // em dash
+	0x2015: "-",   // horizontal bar
+	0x2212: "-",   // minus sign
+	0x2026: "...", // horizontal ellipsis
+	0x2044: "/",   // fraction slash
+	0x2215: "/",   // division slash
+}
+
+// deconfuser replaces Unicode confusables with ASCII equivalents.
+type deconfuser struct {
+	mapping map[rune]string
+}
+
+// newDeconfuser returns a deconfuser using the built-in mapping, extended
+// or overridden by the entries in mapFile if it is not empty.
+func newDeconfuser(mapFile string) (*deconfuser, error) {
+	d := &deconfuser{mapping: make(map[rune]string, len(defaultConfusables))}
+	for r, s := range defaultConfusables {
+		d.mapping[r] = s
+	}
+	// Fullwidth forms of printable ASCII
+	for r := rune(0xFF01); r <= 0xFF5E; r++ {
+		d.mapping[r] = string(r - 0xFF01 + '!')
+	}
+
+	if mapFile != "" {
+		if err := d.load(mapFile); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// load reads mapping entries from filename. Each non-blank line that does not
+// start with '#' holds a source character and an optional replacement
+// separated by whitespace; a missing replacement deletes the character.
+// Either field may use 0x hex notation.
+func (d *deconfuser) load(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open mapping file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return fmt.Errorf("mapping file %s:%d: expected at most two fields", filename, lineNum)
+		}
+
+		from, err := parseDelimiter(fields[0])
+		if err != nil {
+			return fmt.Errorf("mapping file %s:%d: %w", filename, lineNum, err)
+		}
+		if utf8.RuneCountInString(from) != 1 {
+			return fmt.Errorf("mapping file %s:%d: source '%s' must be a single character", filename, lineNum, fields[0])
+		}
+
+		to := ""
+		if len(fields) == 2 {
+			if to, err = parseDelimiter(fields[1]); err != nil {
+				return fmt.Errorf("mapping file %s:%d: %w", filename, lineNum, err)
+			}
+		}
+
+		r, _ := utf8.DecodeRuneInString(from)
+		d.mapping[r] = to
+	}
+	return scanner.Err()
+}
+
+// Transform replaces every mapped character in line.
+// Invalid UTF-8 sequences are left untouched.
+func (d *deconfuser) Transform(line []byte) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRune(line[i:])
+		replacement, ok := d.mapping[r]
+		if ok && out == nil {
+			// First replacement: copy the untouched prefix
+			out = make([]byte, i, len(line))
+			copy(out, line[:i])
+		}
+		switch {
+		case ok:
+			out = append(out, replacement...)
+		case out != nil:
+			out = append(out, line[i:i+size]...)
+		}
+		i += size
+	}
+	if out == nil {
+		return line, nil
+	}
+	return out, nil
+}
+
+// substitution is a sed-style s/FROM/TO/FLAGS edit, for -sub.
+type substitution struct {
+	re       *regexp.Regexp
+	template []byte // in the syntax of regexp.Expand
+	global   bool
+}
+
+// parseSubstitution parses a -sub expression such as 's/FROM/TO/g'. The
+// character after 's' separates the parts, and may appear within them
+// escaped with a backslash. In TO, \1 to \9 insert capture groups and &
+// the whole match, as in sed, and \n and \t insert a newline and a tab.
+// The flags are g, to replace every match rather than the first, and i, to
+// ignore case.
+func parseSubstitution(expr string) (*substitution, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return nil, fmt.Errorf("invalid -sub '%s': must have the form s/FROM/TO/", expr)
+	}
+	sep := expr[1]
+	if sep == '\\' || sep == '\n' || isWordByte(sep) {
+		return nil, fmt.Errorf("invalid -sub '%s': '%c' cannot separate its parts", expr, sep)
+	}
+
+	// Split on the separator where it is not escaped
+	var parts []string
+	var part strings.Builder
+	for i := 2; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == '\\' && i+1 < len(expr) && expr[i+1] == sep:
+			part.WriteString(`\` + string(sep))
+			i++
+		case c == '\\' && i+1 < len(expr):
+			part.WriteString(expr[i : i+2])
+			i++
+		case c == sep:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(c)
+		}
+	}
+	parts = append(parts, part.String())
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid -sub '%s': must have the form s%cFROM%cTO%c", expr, sep, sep, sep)
+	}
+	pattern, replacement, flags := parts[0], parts[1], parts[2]
+
+	// An escaped separator is a literal character in the pattern
+	pattern = strings.ReplaceAll(pattern, `\`+string(sep), regexp.QuoteMeta(string(sep)))
+	s := &substitution{}
+	for _, flag := range flags {
+		switch flag {
+		case 'g':
+			s.global = true
+		case 'i':
+			pattern = "(?i)" + pattern
+		default:
+			return nil, fmt.Errorf("invalid -sub '%s': unknown flag '%c' (supported: g, i)", expr, flag)
+		}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -sub '%s': %w", expr, err)
+	}
+	s.re = re
+
+	// Translate sed's replacement syntax to regexp.Expand's
+	for i := 0; i < len(replacement); i++ {
+		switch c := replacement[i]; {
+		case c == '\\' && i+1 < len(replacement):
+			i++
+			switch next := replacement[i]; {
+			case next >= '0' && next <= '9':
+				s.template = append(s.template, "${"+string(next)+"}"...)
+			case next == 'n':
+				s.template = append(s.template, '\n')
+			case next == 't':
+				s.template = append(s.template, '\t')
+			case next == '$':
+				s.template = append(s.template, "$$"...)
+			default:
+				s.template = append(s.template, next)
+			}
+		case c == '&':
+			s.template = append(s.template, "${0}"...)
+		case c == '$':
+			s.template = append(s.template, "$$"...)
+		default:
+			s.template = append(s.template, c)
+		}
+	}
+	return s, nil
+}
+
+// isWordByte reports whether c is an ASCII letter, digit, or underscore.
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
+
+// Transform replaces the first match in line, or every match with the g
+// flag.
+func (s *substitution) Transform(line []byte) ([]byte, error) {
+	if s.global {
+		return s.re.ReplaceAll(line, s.template), nil
+	}
+	match := s.re.FindSubmatchIndex(line)
+	if match == nil {
+		return line, nil
+	}
+	out := append([]byte(nil), line[:match[0]]...)
+	out = s.re.Expand(out, s.template, line, match)
+	return append(out, line[match[1]:]...), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// unwrapLine reverses processLine for a single output line, given without
+// its trailing newline: the opening and closing delimiters are removed and,
+// with escapeDelim, escaped delimiters are restored.
+func unwrapLine(out []byte, delimiter string, escapeDelim bool) ([]byte, error) {
+	inner, ok := bytes.CutPrefix(out, []byte(delimiter))
+	if ok {
+		inner, ok = bytes.CutSuffix(inner, []byte(delimiter))
+	}
+	if !ok {
+		return nil, fmt.Errorf("line is not enclosed in the delimiter")
+	}
+	if escapeDelim && len(delimiter) > 0 {
+		inner = bytes.ReplaceAll(inner, []byte("\\"+delimiter), []byte(delimiter))
+	}
+	return inner, nil
+}
+
+// verifyRecord wraps line as the main command would and checks that the
+// result is exactly one output line that unwraps back to line.
+func verifyRecord(line []byte, delimiter string, escapeDelim bool, outputBuf *[]byte) error {
+	var out bytes.Buffer
+	writer := bufio.NewWriter(&out)
+	if err := processLine(writer, line, delimiter, "\n", escapeDelim, outputBuf); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	wrapped := bytes.TrimSuffix(out.Bytes(), []byte("\n"))
+	if n := bytes.Count(wrapped, []byte("\n")); n > 0 {
+		return fmt.Errorf("wrapped record spans %d lines", n+1)
+	}
+	unwrapped, err := unwrapLine(wrapped, delimiter, escapeDelim)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(unwrapped, line) {
+		return fmt.Errorf("unwraps to %q", unwrapped)
+	}
+	return nil
+}
+
+// runVerify implements the "verify" subcommand, which checks that wrapped
+// output can be turned back into the original records byte for byte.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet(pgmName+" verify", flag.ExitOnError)
+	delimiterArg := fs.String("d", "\"", "delimiter to wrap lines with (or hex value with 0x prefix, or @file to read it from a file)")
+	escapeDelim := fs.Bool("escape", false, "escape delimiter characters within lines")
+	nullTerminated := fs.Bool("0", false, "read null-terminated records instead of newlines")
+	lines := fs.Int("lines", 10000, "without an input file, number of sample lines to generate")
+	profile := fs.String("profile", "pathological", "without an input file, kind of sample data: "+strings.Join(genProfiles, ", "))
+	seed := fs.Uint64("seed", 1, "without an input file, random seed for the sample")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s verify [options] [file]\n\n", pgmName)
+		fmt.Fprintf(fs.Output(), "Wrap then unwrap every record of file ('-' for STDIN), or of a generated sample,\nand report the first record that does not round-trip byte for byte.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	delimiter, err := parseDelimiterArg(*delimiterArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid delimiter: %v\n", err)
+		os.Exit(1)
+	}
+
+	var terminator byte = '\n'
+	if *nullTerminated {
+		terminator = 0
+	}
+
+	// Read the given input, or generate a sample into memory
+	var input io.Reader
+	source := "sample"
+	if fs.NArg() == 1 {
+		source = fs.Arg(0)
+		in, err := openInput(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to open file '%s': %v\n", source, err)
+			os.Exit(1)
+		}
+		defer in.Close()
+		input = in
+	} else {
+		if *lines < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid line count %d: must not be negative\n", *lines)
+			os.Exit(1)
+		}
+		gen, err := newGenerator(*profile, *seed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		var sample bytes.Buffer
+		if err := gen.writeLines(&sample, *lines, terminator); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		input = &sample
+	}
+
+	records := newLineReader(bufio.NewReader(input), terminator)
+	outputBuf := make([]byte, 0, 1024)
+	num := 0
+	for {
+		line, err := records.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+		num++
+		if err := verifyRecord(line, delimiter, *escapeDelim, &outputBuf); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: record %d of %s does not round-trip: %v\n  record: %q\n", num, source, err, line)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("%s: %d records round-trip\n", source, num)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ignoreFiles are the files whose patterns -gitignore honors, in each
+// directory. Patterns in .ignore take precedence, as in ripgrep.
+var ignoreFiles = []string{".gitignore", ".ignore"}
+
+// walkInputs returns the regular files under each of dirs, in lexical order
+// within each directory, for -r. A file is kept if its base name matches one
+// of include, or include is empty, and none of exclude. A directory whose
+// name matches exclude is skipped whole. Symbolic links are not followed.
+// With gitignore, files and directories matched by the .gitignore and
+// .ignore files found along the way are skipped too, as is .git. A path that
+// cannot be read stops the walk, unless skipped is not nil, in which case its
+// error is passed to skipped and the walk goes on without it.
+func walkInputs(dirs, include, exclude []string, gitignore bool, skipped func(error)) ([]string, error) {
+	for _, pattern := range slices.Concat(include, exclude) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	matchAny := func(patterns []string, name string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		rules := make(ignoreRules)
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if skipped == nil {
+					return err
+				}
+				skipped(err)
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() {
+				if path != dir && matchAny(exclude, d.Name()) {
+					return filepath.SkipDir
+				}
+				if !gitignore {
+					return nil
+				}
+				if path != dir && (d.Name() == ".git" || rules.ignored(rel, true)) {
+					return filepath.SkipDir
+				}
+				return rules.load(path, rel)
+			}
+			if !d.Type().IsRegular() || matchAny(exclude, d.Name()) {
+				return nil
+			}
+			if gitignore && path != dir && rules.ignored(rel, false) {
+				return nil
+			}
+			if len(include) == 0 || matchAny(include, d.Name()) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// ignoreRules holds the ignore patterns read so far during a walk, keyed by
+// the slash-separated path of their directory relative to the walk's root,
+// "." for the root itself.
+type ignoreRules map[string][]ignoreRule
+
+// ignoreRule is one line of a .gitignore file.
+type ignoreRule struct {
+	segments []string // path segments to match, "**" matching any number
+	negate   bool     // "!pattern" re-includes what an earlier pattern ignored
+	dirOnly  bool     // "pattern/" matches only directories
+}
+
+// load reads the ignore files in the directory dir, whose path relative to
+// the walk's root is rel.
+func (rules ignoreRules) load(dir, rel string) error {
+	for _, name := range ignoreFiles {
+		file, err := os.Open(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+				rules[rel] = append(rules[rel], rule)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read '%s': %w", filepath.Join(dir, name), err)
+		}
+	}
+	return nil
+}
+
+// ignored reports whether the slash-separated path rel is ignored by the
+// rules of its ancestor directories. Deeper directories, and later lines
+// within a directory, override earlier ones.
+func (rules ignoreRules) ignored(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	ignored := false
+	for i := range parts {
+		dir := "."
+		if i > 0 {
+			dir = strings.Join(parts[:i], "/")
+		}
+		for _, rule := range rules[dir] {
+			if (!rule.dirOnly || isDir) && matchSegments(rule.segments, parts[i:]) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// parseIgnoreRule parses one line of a .gitignore file. It returns false for
+// blank lines and comments.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	var rule ignoreRule
+	line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " ")
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+	if line[0] == '!' {
+		rule.negate, line = true, line[1:]
+	} else if line[0] == '\\' {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly, line = true, strings.TrimSuffix(line, "/")
+	}
+	// A pattern with a slash is relative to its directory; one without
+	// matches a name at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return rule, false
+	}
+	rule.segments = strings.Split(line, "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	return rule, true
+}
+
+// matchSegments reports whether the path segments parts match the pattern
+// segments, where "**" matches zero or more whole segments.
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := range len(parts) + 1 {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && matchSegments(pattern[1:], parts[1:])
+}
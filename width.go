@@ -0,0 +1,75 @@
+package main
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// runeWidth returns the number of terminal columns occupied by r:
+// 0 for combining marks and other zero-width characters, 2 for East Asian
+// wide and fullwidth characters, and 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0:
+		return 0
+	case r == 0x200B || r == 0x200C || r == 0x200D || r == 0x2060 || r == 0xFEFF:
+		return 0
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// displayWidth returns the total number of terminal columns occupied by s.
+func displayWidth(s []byte) int {
+	width := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRune(s)
+		width += runeWidth(r)
+		s = s[size:]
+	}
+	return width
+}
+
+// truncateTransform cuts each line to a maximum display width.
+type truncateTransform struct {
+	width    int
+	ellipsis []byte
+}
+
+// newTruncateTransform returns a transformer that shortens lines wider than
+// width columns, appending ellipsis so the result still fits within width.
+func newTruncateTransform(width int, ellipsis string) *truncateTransform {
+	return &truncateTransform{width: width, ellipsis: []byte(ellipsis)}
+}
+
+// Transform truncates line if it is wider than the configured width.
+func (tt *truncateTransform) Transform(line []byte) ([]byte, error) {
+	if displayWidth(line) <= tt.width {
+		return line, nil
+	}
+
+	// Keep as many whole characters as fit alongside the ellipsis
+	limit := tt.width - displayWidth(tt.ellipsis)
+	cut, width := 0, 0
+	for cut < len(line) {
+		r, size := utf8.DecodeRune(line[cut:])
+		w := runeWidth(r)
+		if width+w > limit {
+			break
+		}
+		width += w
+		cut += size
+	}
+
+	out := make([]byte, 0, cut+len(tt.ellipsis))
+	out = append(out, line[:cut]...)
+	out = append(out, tt.ellipsis...)
+	return out, nil
+}
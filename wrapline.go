@@ -18,13 +18,23 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
+	"maps"
+	"net/http"
 	"os"
+	"regexp"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/term"
 )
@@ -52,185 +62,1978 @@ func parseDelimiter(arg string) (string, error) {
 	return arg, nil
 }
 
-// processLine builds a complete output line with delimiters and writes it in a single operation.
+// parseDelimiterArg converts a -d argument to a string. An argument of the
+// form "@file" reads the delimiter from the named file; anything else is
+// handled by parseDelimiter.
+func parseDelimiterArg(arg string) (string, error) {
+	if len(arg) > 1 && arg[0] == '@' {
+		return readDelimiterFile(arg[1:])
+	}
+	return parseDelimiter(arg)
+}
+
+// readDelimiterFile returns the contents of filename minus one trailing
+// newline (LF or CRLF), so a delimiter saved by an editor keeps its bytes.
+func readDelimiterFile(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read delimiter file: %w", err)
+	}
+	value := strings.TrimSuffix(string(data), "\n")
+	value = strings.TrimSuffix(value, "\r")
+	return value, nil
+}
+
+// parseTerminator converts an output record terminator argument to a
+// string. Hexadecimal and @file arguments are handled as by parseDelimiterArg;
+// otherwise the backslash escapes \n, \r, \t, \0, \\, and \xHH are
+// interpreted.
+func parseTerminator(arg string) (string, error) {
+	if strings.HasPrefix(arg, "0x") || (len(arg) > 1 && arg[0] == '@') {
+		return parseDelimiterArg(arg)
+	}
+	var buf []byte
+	for i := 0; i < len(arg); i++ {
+		if arg[i] != '\\' {
+			buf = append(buf, arg[i])
+			continue
+		}
+		if i+1 == len(arg) {
+			return "", fmt.Errorf("'%s' ends with an unfinished escape", arg)
+		}
+		i++
+		switch arg[i] {
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case '0':
+			buf = append(buf, 0)
+		case '\\':
+			buf = append(buf, '\\')
+		case 'x':
+			if i+2 >= len(arg) {
+				return "", fmt.Errorf("'%s' has an incomplete \\x escape", arg)
+			}
+			value, err := strconv.ParseUint(arg[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid \\x escape in '%s'", arg)
+			}
+			buf = append(buf, byte(value))
+			i += 2
+		default:
+			return "", fmt.Errorf("unknown escape '\\%c' in '%s'", arg[i], arg)
+		}
+	}
+	return string(buf), nil
+}
+
+// randomSentinel returns a delimiter built from 128 bits of cryptographically
+// secure randomness, so it is practically guaranteed not to occur in any input.
+func randomSentinel() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "WRAPLINE_" + strings.ToUpper(hex.EncodeToString(buf)), nil
+}
+
+// announceSentinel reports a generated sentinel so that callers can later
+// find or strip it: to filename if one is given, otherwise to STDERR.
+func announceSentinel(sentinel, filename string) error {
+	if filename == "" {
+		_, err := fmt.Fprintln(os.Stderr, sentinel)
+		return err
+	}
+	return os.WriteFile(filename, []byte(sentinel+"\n"), 0600)
+}
+
+// processLine builds a complete output line with delimiters and a terminator and writes it in a single operation.
 // Uses the provided buffer to avoid allocations. Optionally escapes delimiter characters within the line.
-func processLine(writer *bufio.Writer, line []byte, delimiter string, escapeDelim bool, outputBuf *[]byte) error {
-	// Reset the buffer for reuse
-	*outputBuf = (*outputBuf)[:0]
+func processLine(writer *bufio.Writer, line []byte, delimiter, terminator string, escapeDelim bool, outputBuf *[]byte) error {
+	// Reset the buffer for reuse, then add the wrapped line and terminator
+	*outputBuf = appendWrapped((*outputBuf)[:0], line, delimiter, escapeDelim)
+	*outputBuf = append(*outputBuf, terminator...)
+
+	// Single write operation
+	_, err := writer.Write(*outputBuf)
+	return err
+}
 
+// appendWrapped appends line to buf enclosed in delimiter, with delimiters
+// inside the line escaped if escapeDelim is set.
+func appendWrapped(buf []byte, line []byte, delimiter string, escapeDelim bool) []byte {
 	// Add opening delimiter
-	*outputBuf = append(*outputBuf, delimiter...)
+	buf = append(buf, delimiter...)
 
 	// Add line content (escaped if needed)
 	if escapeDelim && len(delimiter) > 0 {
 		lineStr := string(line)
 		escapedLine := strings.ReplaceAll(lineStr, delimiter, "\\"+delimiter)
-		*outputBuf = append(*outputBuf, escapedLine...)
+		buf = append(buf, escapedLine...)
 	} else {
-		*outputBuf = append(*outputBuf, line...)
+		buf = append(buf, line...)
 	}
 
-	// Add closing delimiter and newline
-	*outputBuf = append(*outputBuf, delimiter...)
-	*outputBuf = append(*outputBuf, '\n')
-
-	// Single write operation
-	_, err := writer.Write(*outputBuf)
-	return err
+	// Add closing delimiter
+	return append(buf, delimiter...)
 }
 
-func main() {
-	// Define command-line flags
-	showVersion := flag.Bool("v", false, "show version and exit")
-	delimiterArg := flag.String("d", "\"", "delimiter to wrap lines with (or hex value with 0x prefix)")
-	stripWS := flag.Bool("s", false, "strip whitespace from lines before wrapping")
-	skipEmpty := flag.Bool("e", false, "do not emit empty lines")
-	escapeDelim := flag.Bool("escape", false, "escape delimiter characters within lines")
-	outputFile := flag.String("o", "", "output file (default: STDOUT)")
-	nullTerminated := flag.Bool("0", false, "read null-terminated records instead of newlines")
-	flag.Parse()
-
-	// Handle version flag
-	if *showVersion {
-		fmt.Printf("%s v%s\n%s\n", pgmName, pgmVersion, pgmURL)
-		os.Exit(0)
+// formatBytes renders a byte count using binary (IEC) units.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
 	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
 
-	// Parse delimiter (handle hex notation)
-	delimiter, err := parseDelimiter(*delimiterArg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: invalid delimiter: %v\n", err)
-		os.Exit(1)
+// parseSize converts a size such as "512", "64k", "64m", or "2g" to bytes.
+// Suffixes are binary multiples and case-insensitive; an optional trailing
+// "b" (as in "64mb") is accepted.
+func parseSize(arg string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(arg)), "b")
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		case 't':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", arg)
 	}
+	return value * multiplier, nil
+}
 
-	// Get filename from remaining arguments
-	args := flag.Args()
-	// Determine whether stdin is a terminal
-	inputIsTerminal := term.IsTerminal(int(os.Stdin.Fd()))
+// reportMemory writes peak resident set size and Go heap statistics to w.
+// Peak RSS is omitted on platforms where it cannot be determined.
+func reportMemory(w io.Writer) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
 
-	var filename string
-	switch {
-	case len(args) == 1:
-		// User explicitly provided a filename or "-"
-		filename = args[0]
-	case len(args) == 0 && !inputIsTerminal:
-		// No filename, but data is being piped in
-		filename = "-"
-	default:
-		// Anything else is an error
-		fmt.Fprintln(os.Stderr, "Error: exactly one filename (or '-' for STDIN) required")
-		os.Exit(1)
+	fmt.Fprintf(w, "%s: memory report\n", pgmName)
+	if rss, ok := peakRSS(); ok {
+		fmt.Fprintf(w, "  peak RSS:       %s\n", formatBytes(rss))
 	}
+	fmt.Fprintf(w, "  heap in use:    %s\n", formatBytes(m.HeapInuse))
+	fmt.Fprintf(w, "  heap reserved:  %s\n", formatBytes(m.HeapSys))
+	fmt.Fprintf(w, "  total alloc:    %s\n", formatBytes(m.TotalAlloc))
+	fmt.Fprintf(w, "  allocations:    %d\n", m.Mallocs)
+	fmt.Fprintf(w, "  GC cycles:      %d\n", m.NumGC)
+}
 
-	// Open input source
-	var input io.Reader
-	if filename == "-" {
-		input = os.Stdin
-	} else {
-		file, err := os.Open(filename)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to open file '%s': %v\n", filename, err)
-			os.Exit(1)
+// options holds the settings that control how each record is wrapped.
+type options struct {
+	source     string
+	skipEmpty  bool
+	transforms []transformer
+	filters    []recordFilter
+	checks     []recordCheck
+	format     formatter
+	stats      *runStats
+	flushIdle  time.Duration
+	progress   *outputProgress
+	skip       int
+	limit      int         // stop once this many records are written; 0 for no limit
+	tail       int         // write only the last this many records; 0 for all
+	sample     *sampler    // with -sample or -sample-n, chooses the records written
+	keepLast   bool        // keep an empty last record, which structured input gives explicitly
+	sources    sourceNamer // with several inputs, which one each record came from
+	rows       rowSource   // with -csv-in or -tsv-in, the row each record came from
+	raw        rawSource   // with -binary pass, which records are input to copy as is
+}
+
+// wrapRecords reads every record from records and writes it, wrapped, to writer.
+// A one-record lookahead is used so that an empty final record can always be skipped.
+// Transforms are applied as each record is read, so that when input goes idle a
+// buffered record that is known to be non-empty can be written without waiting.
+func wrapRecords(records recordReader, writer *bufio.Writer, opts options) error {
+	// Skip records already written by an earlier run
+	for range opts.skip {
+		if _, err := records.Next(); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("cannot resume: input has fewer than %d records", opts.skip)
+			}
+			return fmt.Errorf("failed to read input: %w", err)
 		}
-		defer file.Close()
-		input = file
 	}
 
-	// Set up output destination
-	var output io.Writer = os.Stdout
-	if *outputFile != "" {
-		outFile, err := os.Create(*outputFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to create output file '%s': %v\n", *outputFile, err)
-			os.Exit(1)
-		}
-		defer outFile.Close()
-		output = outFile
+	if err := opts.format.Begin(writer); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
 	}
 
-	// Create buffered reader and writer for optimal I/O performance
-	reader := bufio.NewReader(input)
-	writer := bufio.NewWriter(output)
-	defer writer.Flush()
+	meta := recordMeta{num: opts.skip, source: opts.source}
+	written := 0
+
+	write := func(line []byte, meta recordMeta) error {
+		if err := opts.format.Record(writer, line, meta); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		written++
+		if opts.stats != nil {
+			opts.stats.written++
+		}
+		return nil
+	}
 
-	// Create reusable output buffer to avoid allocations per line
-	outputBuf := make([]byte, 0, 1024)
+	// With -tail, records are held back until the end of input, and only
+	// the last ones written
+	var tail *recordRing
+	if opts.tail > 0 {
+		tail = newRecordRing(opts.tail)
+	}
+	var sample *reservoir
+	if opts.sample != nil && opts.sample.size > 0 {
+		sample = newReservoir(opts.sample.size, opts.sample.rng)
+	}
 
-	// Determine delimiter byte for reading
-	var delimByte byte = '\n'
-	if *nullTerminated {
-		delimByte = 0
+	render := func(line []byte, isLast bool) error {
+		meta.num++
+		if opts.stats != nil {
+			opts.stats.read++
+		}
+		// Empty last lines are skipped unless the input format marks them
+		// explicitly; others only with -e
+		if len(line) == 0 && ((isLast && !opts.keepLast) || opts.skipEmpty) {
+			if opts.stats != nil {
+				if isLast {
+					opts.stats.droppedLast++
+				} else {
+					opts.stats.droppedEmpty++
+				}
+			}
+			return nil
+		}
+		for _, keep := range opts.filters {
+			if !keep(line) {
+				if opts.stats != nil {
+					opts.stats.filtered++
+				}
+				return nil
+			}
+		}
+		if opts.sample != nil && !opts.sample.keep() {
+			if opts.stats != nil {
+				opts.stats.unsampled++
+			}
+			return nil
+		}
+		for _, check := range opts.checks {
+			if err := check(line, meta); err != nil {
+				return err
+			}
+		}
+		if tail != nil {
+			if tail.add(line, meta) && opts.stats != nil {
+				opts.stats.beforeTail++
+			}
+			return nil
+		}
+		if sample != nil {
+			if sample.add(line, meta) && opts.stats != nil {
+				opts.stats.unsampled++
+			}
+			return nil
+		}
+		return write(line, meta)
 	}
 
-	// Read and process with one-line lookahead to detect last line
 	var bufferedLine []byte
+	var bufferedSource string
+	var bufferedRow []string
 	var hasBufferedLine bool
 
-	for {
-		line, err := reader.ReadBytes(delimByte)
-		if err != nil && err != io.EOF {
-			fmt.Fprintf(os.Stderr, "Error: failed to read input: %v\n", err)
-			os.Exit(1)
+	// emit handles the buffered record. Each input is numbered separately,
+	// even when -merge interleaves them.
+	nums := make(map[string]int)
+	emit := func(line []byte, isLast bool) error {
+		if opts.sources != nil && bufferedSource != meta.source {
+			nums[meta.source] = meta.num
+			meta.source, meta.num = bufferedSource, nums[bufferedSource]
 		}
+		meta.row = bufferedRow
+		if err := render(line, isLast); err != nil {
+			return err
+		}
+		if opts.progress != nil {
+			opts.progress.recordDone()
+		}
+		return nil
+	}
+
+	var idleErr error
+	if opts.flushIdle > 0 {
+		records = newIdleReader(records, opts.flushIdle, func() error {
+			// A non-empty record is written whether or not it is the last
+			if hasBufferedLine && len(bufferedLine) > 0 {
+				if idleErr = emit(bufferedLine, false); idleErr != nil {
+					return idleErr
+				}
+				hasBufferedLine = false
+			}
+			if err := writer.Flush(); err != nil {
+				idleErr = fmt.Errorf("failed to write output: %w", err)
+			}
+			return idleErr
+		})
+	}
 
-		// Remove the delimiter from the end
-		if len(line) > 0 && line[len(line)-1] == delimByte {
-			line = line[:len(line)-1]
+	for {
+		// With a limit, stop reading as soon as it is reached
+		if opts.limit > 0 && written >= opts.limit {
+			if err := opts.format.End(writer); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			return nil
 		}
 
-		// Check if we've reached EOF
+		line, err := records.Next()
 		if err == io.EOF {
-			// If we have a buffered line, it's the last line
+			// The buffered line, if any, is the last line
 			if hasBufferedLine {
-				processedLine := bufferedLine
-				if *stripWS {
-					processedLine = bytes.TrimSpace(processedLine)
-				}
-				// Always skip empty last lines
-				if len(processedLine) > 0 {
-					if err := processLine(writer, processedLine, delimiter, *escapeDelim, &outputBuf); err != nil {
-						fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
-						os.Exit(1)
-					}
+				if err := emit(bufferedLine, true); err != nil {
+					return err
 				}
 			}
-			// If line has data (no trailing delimiter case), it's also the last line
-			if len(line) > 0 {
-				processedLine := line
-				if *stripWS {
-					processedLine = bytes.TrimSpace(processedLine)
+			if tail != nil {
+				if err := tail.each(write); err != nil {
+					return err
 				}
-				// Always skip empty last lines
-				if len(processedLine) > 0 {
-					if err := processLine(writer, processedLine, delimiter, *escapeDelim, &outputBuf); err != nil {
-						fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
-						os.Exit(1)
-					}
+			}
+			if sample != nil {
+				if err := sample.each(write); err != nil {
+					return err
 				}
 			}
-			break
+			if err := opts.format.End(writer); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			return nil
+		}
+		if idleErr != nil {
+			return idleErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
 		}
 
 		// If we have a buffered line, process it now (we know it's not the last line)
 		if hasBufferedLine {
-			processedLine := bufferedLine
+			if err := emit(bufferedLine, false); err != nil {
+				return err
+			}
+		}
 
-			// Strip whitespace if requested
-			if *stripWS {
-				processedLine = bytes.TrimSpace(processedLine)
+		// A binary input passed through is copied without wrapping
+		if opts.raw != nil && opts.raw.Raw() {
+			hasBufferedLine = false
+			if _, err := writer.Write(line); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
 			}
+			continue
+		}
 
-			// Output line unless it's empty and we're skipping empty lines
-			if len(processedLine) > 0 || !*skipEmpty {
-				if err := processLine(writer, processedLine, delimiter, *escapeDelim, &outputBuf); err != nil {
-					fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
-					os.Exit(1)
-				}
+		for _, t := range opts.transforms {
+			if line, err = t.Transform(line); err != nil {
+				return err
 			}
 		}
 
 		// Buffer current line for next iteration
 		bufferedLine = line
 		hasBufferedLine = true
+		if opts.sources != nil {
+			bufferedSource = opts.sources.Source()
+		}
+		if opts.rows != nil {
+			bufferedRow = opts.rows.Row()
+		}
+	}
+}
+
+// setFlags collects the flags given on the command line (or through
+// flag.Set) in a single flag.Visit pass and returns a lookup for them.
+func setFlags() func(name string) bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return func(name string) bool {
+		return set[name]
+	}
+}
+
+func main() {
+	// Dispatch subcommands; "head" and "convert" take the usual options,
+	// plus -n or -from and -to
+	limit := 0
+	convertFrom := ""
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "gen":
+			runGen(os.Args[2:])
+			return
+		case "set":
+			runSet(os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "inspect":
+			runInspect(os.Args[2:])
+			return
+		case "head":
+			limit, os.Args = parseHeadArgs(os.Args)
+		case "convert":
+			convertFrom, os.Args = parseConvertArgs(os.Args)
+		}
+	}
+
+	// Define command-line flags
+	showVersion := flag.Bool("v", false, "show version and exit")
+	delimiterArg := flag.String("d", "\"", "delimiter to wrap lines with (or hex value with 0x prefix, @file to read it from a file, or 'random')")
+	crlf := flag.Bool("crlf", false, "end output lines with \\r\\n instead of \\n, for Windows tools")
+	noFinalNewline := flag.Bool("no-final-newline", false, "omit the terminator after the last line of output")
+	orsArg := flag.String("ors", "\\n", "output record terminator written after each wrapped line; accepts \\n, \\r, \\t, \\0, \\\\, and \\xHH escapes, a hex value with 0x prefix, or @file")
+	noDelimiter := flag.Bool("none", false, "do not add any delimiter (same as -d ''); other processing still applies")
+	sentinelFile := flag.String("sentinel-file", "", "with -d random, write the generated sentinel to this file instead of STDERR")
+	var edits []lineEdit
+	flag.Var(&editFlag{name: "s", boolean: true, edits: &edits}, "s", "strip whitespace from lines before wrapping")
+	flag.Var(&editFlag{name: "sl", boolean: true, edits: &edits}, "sl", "strip leading whitespace from lines before wrapping")
+	flag.Var(&editFlag{name: "sr", boolean: true, edits: &edits}, "sr", "strip trailing whitespace from lines before wrapping")
+	flag.Var(&editFlag{name: "squeeze", boolean: true, edits: &edits}, "squeeze", "collapse runs of whitespace inside lines into a single space before wrapping")
+	stripInvis := flag.Bool("strip-invisible", false, "remove soft hyphens, zero-width characters, and directional marks")
+	deconfuse := flag.Bool("deconfuse", false, "map confusable characters (fullwidth forms, curly quotes, special spaces) to ASCII")
+	deconfuseMap := flag.String("deconfuse-map", "", "with -deconfuse, file of additional 'FROM TO' character mappings")
+	skipEmpty := flag.Bool("e", false, "do not emit empty lines")
+	escapeDelim := flag.Bool("escape", false, "escape delimiter characters within lines")
+	formatName := flag.String("format", "", "output format: json, js, csv, md-table, html-list, curl-h, curl-d, tsv, sql-in, sql-insert, json-string, or heredoc (default: wrapped lines)")
+	heredocTagArg := flag.String("tag", "", "with -format heredoc, terminator tag (default: EOF, or EOF_N if the input contains EOF)")
+	heredocCmd := flag.String("heredoc-cmd", "cat", "with -format heredoc, command that the heredoc is fed to")
+	jsonOutput := flag.Bool("json", false, "emit all lines as a JSON array of strings (-d and -escape are ignored)")
+	jsOutput := flag.Bool("js", false, "emit all lines as a JavaScript/JSON5 array of strings (-d and -escape are ignored)")
+	jsQuote := flag.String("js-quote", "double", "with -js, quote style for strings: single or double")
+	jsTrailingComma := flag.Bool("js-trailing-comma", false, "with -js, add a comma after the last element")
+	mdTable := flag.Bool("md-table", false, "emit lines as a single-column Markdown table (-d and -escape are ignored)")
+	mdNum := flag.Bool("md-num", false, "with -md-table, add a line-number column")
+	htmlList := flag.Bool("html-list", false, "emit lines as the items of an HTML <ul> list, entity-escaped (-d and -escape are ignored)")
+	includeFile := flag.String("include-file", "", "only keep lines listed in this file (exact lines, or 're:' regular expressions)")
+	excludeFile := flag.String("exclude-file", "", "drop lines listed in this file (exact lines, or 're:' regular expressions)")
+	grepPattern := flag.String("grep", "", "only keep lines matching this regular expression")
+	grepVPattern := flag.String("grep-v", "", "drop lines matching this regular expression")
+	flag.Var(&editFlag{name: "sub", edits: &edits}, "sub", "edit each line with a sed-style substitution, such as 's/FROM/TO/g', before wrapping; \\1 in TO inserts a capture group; repeatable; line edits such as -s, -sub, and -upper are applied in the order given")
+	flag.Var(&editFlag{name: "trim-chars", edits: &edits}, "trim-chars", "trim any of these characters from both ends of lines before wrapping")
+	flag.Var(&editFlag{name: "upper", boolean: true, edits: &edits}, "upper", "convert lines to upper case before wrapping")
+	flag.Var(&editFlag{name: "lower", boolean: true, edits: &edits}, "lower", "convert lines to lower case before wrapping")
+	flag.Var(&editFlag{name: "title", boolean: true, edits: &edits}, "title", "capitalize each word of lines before wrapping")
+	csvOutput := flag.Bool("csv", false, "emit lines as a single-column RFC 4180 CSV (-d and -escape are ignored)")
+	csvCols := flag.String("csv-cols", "", "CSV columns to emit, comma-separated from num, file, line (implies -csv)")
+	csvCRLF := flag.Bool("csv-crlf", false, "with -csv, terminate records with CRLF as RFC 4180 specifies")
+	templateText := flag.String("template", "", "emit each line as the output of this Go text/template, given .Line, .Num, .File, and .Bytes (-d and -escape are ignored)")
+	xmlTag := flag.String("xml", "", "emit each line as an XML element with this name, entity-escaped (-d and -escape are ignored)")
+	xmlAttrs := flag.String("xml-attrs", "", "with -xml, attributes to add, comma-separated from n (line number), file (source filename)")
+	kvPrefix := flag.String("kv", "", "emit lines as numbered key=value pairs, with keys made from this prefix and the line's number")
+	kvNum := flag.String("kv-num", "%d", "with -kv, printf format for the number in each key, e.g. _%02d")
+	kvSection := flag.String("kv-section", "", "with -kv, write the pairs under this INI [section] header")
+	dotenvKey := flag.String("dotenv", "", "emit lines as KEY=value pairs for a .env file, with keys from this template, where {n} is the line's number, e.g. HOST_{n} (-d and -escape are ignored)")
+	dotenvDocker := flag.Bool("dotenv-docker", false, "with -dotenv, write values unquoted, as docker --env-file expects")
+	curlHeaders := flag.Bool("curl-h", false, "emit each 'Name: value' line as a shell-quoted curl -H argument, e.g. for xargs curl (-d and -escape are ignored)")
+	curlData := flag.Bool("curl-d", false, "emit each line as a shell-quoted curl -d argument, e.g. for xargs curl (-d and -escape are ignored)")
+	joinSepArg := flag.String("join", "", "emit all wrapped lines on a single line separated by this string (or hex value with 0x prefix)")
+	header := flag.String("header", "", "text to write before the output: with -join, at the start of the joined line; otherwise as a line of its own")
+	footer := flag.String("footer", "", "text to write after the output: with -join, at the end of the joined line; otherwise as a line of its own")
+	columns := flag.Int("columns", 0, "pack this many wrapped lines into each output line (0 disables)")
+	columnsSepArg := flag.String("columns-sep", ", ", "with -columns, separator between values in a line (or hex value with 0x prefix)")
+	columnsAlign := flag.Bool("columns-align", false, "with -columns, pad values so that columns line up (holds the whole input in memory)")
+	columnsTrailing := flag.Bool("columns-trailing", false, "with -columns, end every line but the last with the separator, as in initializer lists")
+	tomlKey := flag.String("toml", "", "emit all lines as a TOML array assigned to this key (-d and -escape are ignored)")
+	sqlIn := flag.Bool("sql-in", false, "emit all lines as a SQL IN list: ('a','b','c') (-d and -escape are ignored)")
+	sqlInChunk := flag.Int("sql-in-chunk", 0, "with -sql-in, start a new list every N elements (0 disables)")
+	sqlInsert := flag.Bool("sql-insert", false, "emit one SQL INSERT statement per line into -table and -column (-d and -escape are ignored)")
+	column := flag.String("column", "line", "with -sql-insert, column to insert lines into")
+	sqlInsertBatch := flag.Int("sql-insert-batch", 1, "with -sql-insert, number of rows per multi-row INSERT statement")
+	sqlDialect := flag.String("sql-dialect", "standard", "with -sql-in or -sql-insert, string quoting rules: standard (PostgreSQL, SQLite, SQL Server, Oracle) or mysql (also escapes backslashes)")
+	tsvOutput := flag.Bool("tsv", false, "escape tabs, newlines, and backslashes in content for TSV loads (PostgreSQL COPY, BigQuery); values are not wrapped unless -d is given")
+	postURL := flag.String("post", "", "send each wrapped record to this URL with HTTP POST instead of writing output")
+	var postHeaders stringList
+	flag.Var(&postHeaders, "post-header", "with -post, add a 'Name: value' request header (repeatable)")
+	postBatchSize := flag.Int("post-batch", 1, "with -post, number of records sent per request")
+	postConcurrency := flag.Int("post-concurrency", 4, "with -post, number of concurrent requests")
+	postRetries := flag.Int("post-retries", 3, "with -post, retries for network errors, 429, and 5xx responses")
+	postBackoff := flag.Duration("post-backoff", 500*time.Millisecond, "with -post, initial delay between retries, doubled on each attempt")
+	postTimeout := flag.Duration("post-timeout", 30*time.Second, "with -post, timeout for each request")
+	urlRetries := flag.Int("url-retries", 3, "for URL inputs, retries for network errors, 429, and 5xx responses")
+	urlBackoff := flag.Duration("url-backoff", 500*time.Millisecond, "for URL inputs, initial delay between retries, doubled on each attempt")
+	urlTimeout := flag.Duration("url-timeout", 30*time.Second, "for URL inputs, timeout for connecting and receiving the response headers")
+	rejectFile := flag.String("reject-file", "", "with -post, write records that could not be delivered to this file")
+	recordWidth := flag.Int("record-width", 0, "pad each output line to exactly N bytes, failing on longer lines (0 disables)")
+	padCharArg := flag.String("pad-char", " ", "with -record-width, single-byte padding character (or hex value with 0x prefix)")
+	var outputFiles stringList
+	flag.Var(&outputFiles, "o", "output file or /dev/fd/N (default: STDOUT; repeatable to write the same output to several places), or sqlite:FILE to insert records into a SQLite database")
+	compressArg := flag.String("compress", "", "compress output: gzip or none (default: gzip for -o files ending in .gz, otherwise none)")
+	tee := flag.Bool("tee", false, "with -o FILE, also write the output to STDOUT (same as adding -o -)")
+	table := flag.String("table", "lines", "with -o sqlite:FILE or -sql-insert, table to insert records into")
+	sqliteCols := flag.String("sqlite-cols", "", "with -o sqlite:FILE, extra columns to store, comma-separated from n, file, hash")
+	sqliteBatch := flag.Int("sqlite-batch", 1000, "with -o sqlite:FILE, number of rows per transaction")
+	nullTerminated := flag.Bool("0", false, "read null-terminated records instead of newlines")
+	irsArg := flag.String("irs", "", "input record separator to split records on instead of newlines; accepts any string with \\n, \\r, \\t, \\0, \\\\, and \\xHH escapes, a hex value with 0x prefix, or @file; 'auto' detects LF, CRLF, or NUL")
+	csvIn := flag.Bool("csv-in", false, "read the input as CSV, wrap only the -col column of each row, and write the rows back out as CSV")
+	tsvIn := flag.Bool("tsv-in", false, "read the input as tab-separated values, wrap only the -col column of each row, and write the rows back out as TSV")
+	col := flag.Int("col", 0, "with -csv-in or -tsv-in, the column to wrap, counted from 1")
+	encodingArg := flag.String("encoding", "utf-8", "character encoding of the input, converted to UTF-8 before processing: utf-8, utf-16 (by byte order mark), utf-16le, utf-16be, latin-1, or shift-jis")
+	jsonlIn := flag.Bool("jsonl-in", false, "read the input as JSON Lines and wrap the value at -path in each line")
+	pathArg := flag.String("path", "", "with -jsonl-in, the value to wrap, such as '.user.email' or '.items[0]'")
+	keepGoing := flag.Bool("keep-going", false, "report inputs that cannot be read to STDERR and carry on with the others, exiting with an error at the end")
+	mergeArg := flag.String("merge", "", "with several inputs, interleave their records instead of reading them in turn: sorted (merge inputs that are each sorted) or roundrobin")
+	binaryArg := flag.String("binary", "wrap", "what to do with an input whose first block has NUL bytes or invalid UTF-8: wrap, skip, pass (copy it to the output untouched), or error")
+	recordLen := flag.Int("record-len", 0, "read fixed-length records of N bytes, with no separator, such as mainframe dumps")
+	encodeArg := flag.String("encode", "", "replace each record with its encoding before other processing, for binary data: hex or base64")
+	followName := flag.Bool("follow-name", false, "keep reading the input file as it grows, like 'tail -F', reopening it by name when it is rotated or truncated")
+	skipRecords := flag.Int("skip", 0, "discard the first N records of each input, such as header lines")
+	headRecords := flag.Int("head", 0, "stop reading input once N records have been written (default: no limit)")
+	tailRecords := flag.Int("tail", 0, "write only the last N records, holding them back until the end of input (default: all)")
+	sampleFraction := flag.Float64("sample", 0, "keep each record with this probability, between 0 and 1, e.g. 0.01 for about 1% (default: all)")
+	sampleCount := flag.Int("sample-n", 0, "write a random sample of N records, in input order, holding them back until the end of input (default: all)")
+	seed := flag.Uint64("seed", 0, "random seed for -sample and -sample-n; the same seed always chooses the same records (default: a new seed each run)")
+	crlfIn := flag.Bool("crlf-in", false, "remove a trailing carriage return from each input record, as left by CRLF line endings")
+	irsRegex := flag.String("irs-regex", "", "split input records wherever this regular expression matches; the text of its first capturing group, if any, starts the next record")
+	verbose := flag.Bool("verbose", false, "report decisions made automatically, such as the detected input record separator, to STDERR")
+	filesFrom := flag.String("files-from", "", "read the input filenames, one per line, from this file ('-' for STDIN)")
+	var recursiveDirs, includeGlobs, excludeGlobs stringList
+	flag.Var(&recursiveDirs, "r", "read every file under this directory, recursively and in lexical order (repeatable)")
+	flag.Var(&includeGlobs, "include", "with -r, only read files whose names match this glob, e.g. '*.log' (repeatable)")
+	flag.Var(&excludeGlobs, "exclude", "with -r, skip files and directories whose names match this glob (repeatable)")
+	decompressArg := flag.String("decompress", "auto", "decompress input: auto (detect from the first bytes), gzip, bzip2, or none")
+	gitignore := flag.Bool("gitignore", false, "with -r, skip files and directories matched by .gitignore and .ignore files, and .git")
+	files0From := flag.String("files0-from", "", "read the input filenames, NUL-separated as from find -print0, from this file ('-' for STDIN)")
+	fromSQLite := flag.String("from-sqlite", "", "read input from the first column of a SQLite query, given as 'FILE:QUERY'")
+	fromCSVColumn := flag.String("from-csv-column", "", "read input from one column of a CSV file with a header row, given as 'FILE:NAME'")
+	paragraph := flag.Bool("paragraph", false, "treat blank-line-separated blocks as a single record")
+	paragraphSepArg := flag.String("paragraph-sep", " ", "string used to join lines within a paragraph (or hex value with 0x prefix)")
+	wrapWidth := flag.Int("wrap-width", 0, "break lines longer than N characters into multiple records (0 disables)")
+	wrapWords := flag.Bool("wrap-words", false, "with -wrap-width, break lines at word boundaries where possible")
+	pluginCmd := flag.String("plugin", "", "external command that transforms each line (line in / line out over stdio)")
+	pluginTimeout := flag.Duration("plugin-timeout", 30*time.Second, "with -plugin, how long to wait for the reply to each line; 0 waits forever")
+	truncate := flag.Int("truncate", 0, "cut lines to at most N display columns before wrapping (0 disables)")
+	ellipsis := flag.String("ellipsis", "", "with -truncate, string appended to truncated lines (counts toward N)")
+	report := flag.String("report", "", "print a report to STDERR after the run (supported: memory)")
+	strict := flag.Bool("strict", false, "fail on delimiter collisions, invalid UTF-8, oversized records, ineffective flags, and empty output")
+	maxRecordArg := flag.String("max-record", "", "fail if a record is larger than this size, e.g. 64k or 1m (default: no limit, 16m with -strict)")
+	failEmpty := flag.Bool("fail-empty", false, "exit with an error if no records are written")
+	stdinTimeout := flag.Duration("stdin-timeout", 0, "fail if no input arrives on STDIN within this long, e.g. 30s, instead of waiting forever (default: wait)")
+	flushIdle := flag.Duration("flush-idle", 0, "flush output when no input has arrived for this long, e.g. 200ms (0 disables)")
+	showStats := flag.Bool("stats", false, "print counts of records read, written, and dropped (by reason) to STDERR after the run")
+	failOnDrop := flag.Bool("fail-on-drop", false, "exit with an error if any record was dropped by -skip, -e, filters, -tail, sampling, or empty last-line skipping")
+	resumeStateFile := flag.String("resume-state", "", "if a write fails, e.g. on a full disk, save progress to this file; when it exists, continue the -o file from there")
+	sinceCheckpoint := flag.String("since-checkpoint", "", "process only the complete records appended to the input file since the offset recorded in this file, then record the new offset")
+	splitLines := flag.Int("split-lines", 0, "write the -o output to numbered files FILE.0001, FILE.0002, ..., each holding at most N records (0 disables)")
+	splitBytesArg := flag.String("split-bytes", "", "write the -o output to numbered files FILE.0001, FILE.0002, ..., each at most this size, e.g. 64m; records are never split")
+	checkFlags := flag.Bool("check-flags", false, "validate the combination of options and report ineffective flags and buffering, without reading input or writing output")
+	manifestFile := flag.String("manifest", "", "write a JSON manifest of input and output paths, record counts, and SHA-256 hashes to this file")
+	flag.Parse()
+
+	// Handle version flag
+	if *showVersion {
+		fmt.Printf("%s v%s\n%s\n", pgmName, pgmVersion, pgmURL)
+		os.Exit(0)
+	}
+
+	// An input given as FILE?key=value&... overrides options for that source
+	args := flag.Args()
+	if len(args) == 1 {
+		name, overrides, err := parseSourceSpec(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		args[0] = name
+		if d, ok := overrides["d"]; ok {
+			flag.Set("d", d)
+		}
+		if overrides["format"] == "csv" {
+			if *fromSQLite != "" || *fromCSVColumn != "" {
+				fmt.Fprintln(os.Stderr, "Error: -from-sqlite and -from-csv-column replace the input filename and cannot be combined")
+				os.Exit(1)
+			}
+			*fromCSVColumn = name + ":" + overrides["field"]
+			args = nil
+		}
+	}
+
+	// Source overrides may have set flags, so look them up only now
+	flagSet := setFlags()
+
+	// Parse delimiter (handle hex notation), or generate a random sentinel
+	var delimiter string
+	var err error
+	if *noDelimiter {
+		if flagSet("d") {
+			fmt.Fprintln(os.Stderr, "Error: -none and -d cannot be used together")
+			os.Exit(1)
+		}
+	} else if *delimiterArg == "random" {
+		// Announced only once the options have been checked, with the outputs
+		delimiter, err = randomSentinel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: random delimiter: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		delimiter, err = parseDelimiterArg(*delimiterArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid delimiter: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Parse output record terminator
+	terminator, err := parseTerminator(*orsArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -ors: %v\n", err)
+		os.Exit(1)
+	}
+	if terminator == "" {
+		fmt.Fprintln(os.Stderr, "Error: -ors must not be empty")
+		os.Exit(1)
+	}
+
+	// Parse paragraph separator (handle hex notation)
+	paragraphSep, err := parseDelimiter(*paragraphSepArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid paragraph separator: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Validate wrap width
+	if *wrapWidth < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid wrap width %d: must not be negative\n", *wrapWidth)
+		os.Exit(1)
+	}
+
+	// Validate truncation settings
+	if *truncate < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid truncate width %d: must not be negative\n", *truncate)
+		os.Exit(1)
+	}
+	if *truncate > 0 && displayWidth([]byte(*ellipsis)) > *truncate {
+		fmt.Fprintf(os.Stderr, "Error: ellipsis '%s' is wider than the truncate width %d\n", *ellipsis, *truncate)
+		os.Exit(1)
+	}
+
+	// Validate report type
+	if *report != "" && *report != "memory" {
+		fmt.Fprintf(os.Stderr, "Error: unknown report type '%s' (supported: memory)\n", *report)
+		os.Exit(1)
+	}
+
+	// -head sets the same record limit as the head subcommand
+	if *headRecords != 0 {
+		if *headRecords < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -head %d: must not be negative\n", *headRecords)
+			os.Exit(1)
+		}
+		if limit > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -head cannot be combined with the head subcommand; use its -n")
+			os.Exit(1)
+		}
+		limit = *headRecords
+	}
+	if *tailRecords < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -tail %d: must not be negative\n", *tailRecords)
+		os.Exit(1)
+	}
+	if *tailRecords > 0 && limit > 0 {
+		fmt.Fprintln(os.Stderr, "Error: -tail cannot be combined with -head or the head subcommand")
+		os.Exit(1)
+	}
+
+	// Validate sampling, and seed its random numbers
+	if *sampleFraction < 0 || *sampleFraction > 1 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -sample %v: must be between 0 and 1\n", *sampleFraction)
+		os.Exit(1)
+	}
+	if *sampleCount < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -sample-n %d: must not be negative\n", *sampleCount)
+		os.Exit(1)
+	}
+	if *sampleCount > 0 && (*sampleFraction > 0 || *tailRecords > 0 || limit > 0) {
+		fmt.Fprintln(os.Stderr, "Error: -sample-n cannot be combined with -sample, -tail, -head, or the head subcommand")
+		os.Exit(1)
+	}
+	if !flagSet("seed") {
+		*seed = randomSeed()
+	}
+
+	// Resolve -format to the matching output format switch
+	var jsonString, heredoc bool
+	switch *formatName {
+	case "":
+	case "json":
+		*jsonOutput = true
+	case "js":
+		*jsOutput = true
+	case "csv":
+		*csvOutput = true
+	case "md-table":
+		*mdTable = true
+	case "html-list":
+		*htmlList = true
+	case "curl-h":
+		*curlHeaders = true
+	case "curl-d":
+		*curlData = true
+	case "tsv":
+		*tsvOutput = true
+	case "sql-in":
+		*sqlIn = true
+	case "sql-insert":
+		*sqlInsert = true
+	case "json-string":
+		jsonString = true
+	case "heredoc":
+		heredoc = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown output format '%s' (supported: json, js, csv, md-table, html-list, curl-h, curl-d, tsv, sql-in, sql-insert, json-string, heredoc)\n", *formatName)
+		os.Exit(1)
+	}
+
+	// Parse record size limit
+	var maxRecord int64
+	if *maxRecordArg != "" {
+		maxRecord, err = parseSize(*maxRecordArg)
+		if err != nil || maxRecord == 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -max-record '%s': must be a positive size\n", *maxRecordArg)
+			os.Exit(1)
+		}
+	} else if *strict {
+		maxRecord = strictMaxRecord
+	}
+	if *strict {
+		*failEmpty = true
+	}
+
+	// Get filename from remaining arguments
+	// Determine whether stdin is a terminal
+	inputIsTerminal := term.IsTerminal(int(os.Stdin.Fd()))
+
+	// With -files-from or -files0-from, the inputs are listed in a file instead
+	listFlag, listFile, listTerm := "files-from", *filesFrom, byte('\n')
+	if *files0From != "" {
+		if *filesFrom != "" {
+			fmt.Fprintln(os.Stderr, "Error: -files-from and -files0-from cannot be combined")
+			os.Exit(1)
+		}
+		listFlag, listFile, listTerm = "files0-from", *files0From, 0
+	}
+	if listFile != "" {
+		if len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: -%s replaces the input filenames, which cannot also be given\n", listFlag)
+			os.Exit(1)
+		}
+		args, err = readFileList(listFile, listTerm)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read -%s list '%s': %v\n", listFlag, listFile, err)
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: -%s list '%s' names no inputs\n", listFlag, listFile)
+			os.Exit(1)
+		}
+		if listFile == "-" && slices.Contains(args, "-") {
+			fmt.Fprintf(os.Stderr, "Error: with -%s -, STDIN holds the list and cannot also be an input\n", listFlag)
+			os.Exit(1)
+		}
+	}
+
+	// With -keep-going, inputs that cannot be read are reported and counted
+	// instead of stopping the run
+	var unreadable int
+	var skipped func(error)
+	if *keepGoing {
+		skipped = func(err error) {
+			unreadable++
+			fmt.Fprintf(os.Stderr, "%s: skipping: %v\n", pgmName, err)
+		}
+	}
+
+	// With -r, the inputs are the files found under the directories
+	if len(recursiveDirs) > 0 {
+		if len(args) > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -r replaces the input filenames, which cannot also be given")
+			os.Exit(1)
+		}
+		args, err = walkInputs(recursiveDirs, includeGlobs, excludeGlobs, *gitignore, skipped)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -r: %v\n", err)
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: -r found no matching files under %s\n", strings.Join(recursiveDirs, ", "))
+			os.Exit(1)
+		}
+	}
+
+	var filename string
+	var inputs []string // several inputs, read in turn
+	var sources sourceNamer
+	switch {
+	case *fromSQLite != "" || *fromCSVColumn != "":
+		if len(args) > 0 || (*fromSQLite != "" && *fromCSVColumn != "") {
+			fmt.Fprintln(os.Stderr, "Error: -from-sqlite and -from-csv-column replace the input filename and cannot be combined")
+			os.Exit(1)
+		}
+		if convertFrom != "" {
+			fmt.Fprintln(os.Stderr, "Error: convert reads its input with -from and cannot be combined with -from-sqlite or -from-csv-column")
+			os.Exit(1)
+		}
+	case len(args) == 1:
+		// User explicitly provided a filename or "-"
+		filename = args[0]
+	case len(args) > 1:
+		filename, inputs = args[0], args
+		if *resumeStateFile != "" || *manifestFile != "" {
+			fmt.Fprintln(os.Stderr, "Error: -resume-state and -manifest require a single input")
+			os.Exit(1)
+		}
+	case len(args) == 0 && (!inputIsTerminal || *checkFlags):
+		// No filename, but data is being piped in (or will not be read)
+		filename = "-"
+	default:
+		// Anything else is an error
+		fmt.Fprintln(os.Stderr, "Error: a filename (or '-' for STDIN) is required")
+		os.Exit(1)
+	}
+
+	if !slices.Contains(decompressMethods, *decompressArg) {
+		fmt.Fprintf(os.Stderr, "Error: unknown decompression '%s' (supported: %s)\n", *decompressArg, strings.Join(decompressMethods, ", "))
+		os.Exit(1)
+	}
+
+	// Determine the record separator for reading
+	var delimByte byte = '\n'
+	if *nullTerminated {
+		delimByte = 0
+	}
+	inputSep := string(delimByte)
+	irsAuto := *irsArg == "auto"
+	if *irsArg != "" && *nullTerminated {
+		fmt.Fprintln(os.Stderr, "Error: -irs and -0 cannot be combined")
+		os.Exit(1)
+	}
+	var irsPattern *regexp.Regexp
+	if *irsRegex != "" {
+		if *irsArg != "" || *nullTerminated {
+			fmt.Fprintln(os.Stderr, "Error: -irs-regex cannot be combined with -irs or -0")
+			os.Exit(1)
+		}
+		irsPattern, err = regexp.Compile(*irsRegex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -irs-regex: %v\n", err)
+			os.Exit(1)
+		}
+		if irsPattern.MatchString("") {
+			fmt.Fprintf(os.Stderr, "Error: invalid -irs-regex '%s': must not match an empty string\n", *irsRegex)
+			os.Exit(1)
+		}
+	}
+	if !slices.Contains(binaryPolicies, *binaryArg) {
+		fmt.Fprintf(os.Stderr, "Error: unknown -binary '%s' (supported: %s)\n", *binaryArg, strings.Join(binaryPolicies, ", "))
+		os.Exit(1)
+	}
+	if *mergeArg != "" {
+		if !slices.Contains(mergeModes, *mergeArg) {
+			fmt.Fprintf(os.Stderr, "Error: unknown -merge '%s' (supported: %s)\n", *mergeArg, strings.Join(mergeModes, ", "))
+			os.Exit(1)
+		}
+		if *binaryArg == "pass" {
+			fmt.Fprintln(os.Stderr, "Error: -merge cannot be combined with -binary pass")
+			os.Exit(1)
+		}
+	}
+	if *recordLen < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -record-len %d: must not be negative\n", *recordLen)
+		os.Exit(1)
+	}
+	if *recordLen > 0 && (*irsArg != "" || irsPattern != nil || *nullTerminated || *csvIn || *tsvIn || convertFrom != "" || *sinceCheckpoint != "") {
+		fmt.Fprintln(os.Stderr, "Error: -record-len cannot be combined with -irs, -irs-regex, -0, -csv-in, -tsv-in, convert, or -since-checkpoint")
+		os.Exit(1)
+	}
+	tableIn := *csvIn || *tsvIn
+	if tableIn {
+		if *csvIn && *tsvIn {
+			fmt.Fprintln(os.Stderr, "Error: -csv-in and -tsv-in cannot be combined")
+			os.Exit(1)
+		}
+		if *col < 1 {
+			fmt.Fprintln(os.Stderr, "Error: -csv-in and -tsv-in require -col N, counting columns from 1")
+			os.Exit(1)
+		}
+		if convertFrom != "" || *irsArg != "" || irsPattern != nil || *nullTerminated || *paragraph || *wrapWidth > 0 || *fromSQLite != "" || *fromCSVColumn != "" {
+			fmt.Fprintln(os.Stderr, "Error: -csv-in and -tsv-in cannot be combined with convert, -irs, -irs-regex, -0, -paragraph, -wrap-width, -from-sqlite, or -from-csv-column")
+			os.Exit(1)
+		}
+	}
+	// Other encodings are converted to UTF-8 as each input is read
+	transcode := !strings.EqualFold(*encodingArg, "utf-8")
+	if transcode {
+		if _, err := newDecoder(*encodingArg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -encoding: %v\n", err)
+			os.Exit(1)
+		}
+		if *sinceCheckpoint != "" {
+			fmt.Fprintln(os.Stderr, "Error: -since-checkpoint requires UTF-8 input")
+			os.Exit(1)
+		}
+	}
+
+	var jsonPath []pathStep
+	if *jsonlIn {
+		if *pathArg == "" {
+			fmt.Fprintln(os.Stderr, "Error: -jsonl-in requires -path, such as '.user.email'")
+			os.Exit(1)
+		}
+		if tableIn || convertFrom != "" || *fromSQLite != "" || *fromCSVColumn != "" {
+			fmt.Fprintln(os.Stderr, "Error: -jsonl-in cannot be combined with -csv-in, -tsv-in, convert, -from-sqlite, or -from-csv-column")
+			os.Exit(1)
+		}
+		jsonPath, err = parsePath(*pathArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *irsArg != "" && !irsAuto {
+		inputSep, err = parseTerminator(*irsArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -irs: %v\n", err)
+			os.Exit(1)
+		}
+		if inputSep == "" {
+			fmt.Fprintln(os.Stderr, "Error: -irs must not be empty")
+			os.Exit(1)
+		}
+		delimByte = inputSep[len(inputSep)-1]
+	}
+
+	// Determine output destinations; a SQLite database must be the only one
+	var sqliteFile string
+	var sqliteOutput bool
+	for _, name := range outputFiles {
+		if strings.HasPrefix(name, "sqlite:") {
+			if len(outputFiles) > 1 {
+				fmt.Fprintln(os.Stderr, "Error: -o sqlite:FILE cannot be combined with other -o outputs")
+				os.Exit(1)
+			}
+			sqliteFile, sqliteOutput = strings.CutPrefix(name, "sqlite:")
+		}
+	}
+	if *tee {
+		if len(outputFiles) == 0 || sqliteOutput || slices.Contains(outputFiles, "-") {
+			fmt.Fprintln(os.Stderr, "Error: -tee requires -o FILE and cannot be used with -o - or -o sqlite:FILE")
+			os.Exit(1)
+		}
+		outputFiles = append(outputFiles, "-")
+	}
+
+	// With -manifest, hash the raw input and output as they stream through
+	var inputHash, outputHash hash.Hash
+	if *manifestFile != "" {
+		if sqliteOutput || *postURL != "" {
+			fmt.Fprintln(os.Stderr, "Error: -manifest requires file or STDOUT output and cannot be used with -o sqlite:FILE or -post")
+			os.Exit(1)
+		}
+		outputHash = sha256.New()
+	}
+
+	// With -since-checkpoint, only records appended since the last run are read
+	var checkpointState *checkpoint
+	checkpointNext := make(map[string]checkpointEntry)
+	if *sinceCheckpoint != "" {
+		if filename == "" || filename == "-" || isURL(filename) || slices.Contains(inputs, "-") || slices.ContainsFunc(inputs, isURL) {
+			fmt.Fprintln(os.Stderr, "Error: -since-checkpoint requires input files, not STDIN or URLs")
+			os.Exit(1)
+		}
+		if len(inputSep) > 1 || irsAuto || irsPattern != nil {
+			fmt.Fprintln(os.Stderr, "Error: -since-checkpoint requires a known single-byte input record separator")
+			os.Exit(1)
+		}
+		if *resumeStateFile != "" || limit > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -since-checkpoint cannot be combined with -resume-state, -head, or the head subcommand")
+			os.Exit(1)
+		}
+		checkpointState, err = loadCheckpoint(*sinceCheckpoint)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// -follow-name never reaches the end of its input
+	if *followName {
+		if filename == "" || filename == "-" || isURL(filename) || inputs != nil {
+			fmt.Fprintln(os.Stderr, "Error: -follow-name requires a single input file, not STDIN or URLs")
+			os.Exit(1)
+		}
+		if *sinceCheckpoint != "" || *tailRecords > 0 || *sampleCount > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -follow-name cannot be combined with -since-checkpoint, -tail, or -sample-n, which wait for the end of input")
+			os.Exit(1)
+		}
+	}
+
+	var stats *runStats
+	if *manifestFile != "" || *failEmpty || *showStats || *failOnDrop {
+		stats = &runStats{}
+	}
+
+	// Check the input source; it is opened by openSource only once every
+	// option has been checked, so a rejected run fetches no URL and starts
+	// no sqlite3
+	var records recordReader
+	var openSource func() (recordReader, io.Closer, error)
+	switch {
+	case *checkFlags:
+		// Nothing is read in a dry run, but the input files must exist
+		for _, name := range append([]string{filename}, inputs...) {
+			if name != "" && name != "-" && !isURL(name) {
+				if _, err := os.Stat(name); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: failed to open file '%s': %v\n", name, err)
+					os.Exit(1)
+				}
+			}
+		}
+	case *fromSQLite != "":
+		dbFile, query, ok := strings.Cut(*fromSQLite, ":")
+		if !ok || dbFile == "" || strings.TrimSpace(query) == "" {
+			fmt.Fprintln(os.Stderr, "Error: -from-sqlite requires 'FILE:QUERY'")
+			os.Exit(1)
+		}
+		openSource = func() (recordReader, io.Closer, error) {
+			records, err := newSQLiteQueryReader(dbFile, query)
+			return records, emptyReader{}, err
+		}
+		filename = dbFile
+	case *fromCSVColumn != "":
+		i := strings.LastIndex(*fromCSVColumn, ":")
+		if i <= 0 || i == len(*fromCSVColumn)-1 {
+			fmt.Fprintln(os.Stderr, "Error: -from-csv-column requires 'FILE:NAME'")
+			os.Exit(1)
+		}
+		filename = (*fromCSVColumn)[:i]
+		name, column := filename, (*fromCSVColumn)[i+1:]
+		openSource = func() (recordReader, io.Closer, error) {
+			file, err := os.Open(name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open file '%s': %w", name, err)
+			}
+			records, err := newCSVColumnReader(bufio.NewReader(file), column)
+			if err != nil {
+				file.Close()
+				return nil, nil, err
+			}
+			return records, file, nil
+		}
+	default:
+		if outputHash != nil {
+			inputHash = sha256.New()
+		}
+		if *urlRetries < 0 {
+			fmt.Fprintln(os.Stderr, "Error: -url-retries must be at least 0")
+			os.Exit(1)
+		}
+		fetchCfg := fetchConfig{retries: *urlRetries, backoff: *urlBackoff, timeout: *urlTimeout}
+		fetchClient := newFetchClient(fetchCfg)
+
+		if *stdinTimeout < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -stdin-timeout %v: must not be negative\n", *stdinTimeout)
+			os.Exit(1)
+		}
+		if *skipRecords < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -skip %d: must not be negative\n", *skipRecords)
+			os.Exit(1)
+		}
+
+		// openRecordsFrom opens one input and returns its records
+		openRecordsFrom := func(name string) (recordReader, io.Closer, error) {
+			var file io.ReadCloser
+			var err error
+			if *followName {
+				var notes io.Writer
+				if *verbose {
+					notes = os.Stderr
+				}
+				file, err = newFollowReader(name, notes)
+			} else if isURL(name) {
+				file, err = openURL(fetchClient, name, fetchCfg)
+			} else {
+				file, err = openInput(name)
+				if name == "-" && *stdinTimeout > 0 && !inputIsTerminal {
+					file = newStdinTimeoutReader(file, *stdinTimeout)
+				}
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			var input io.Reader = file
+			if checkpointState != nil {
+				var next checkpointEntry
+				input, next, err = openSinceCheckpoint(file.(*os.File), name, checkpointState, delimByte)
+				if err != nil {
+					file.Close()
+					return nil, nil, err
+				}
+				checkpointNext[name] = next
+			}
+			if inputHash != nil {
+				input = io.TeeReader(input, inputHash)
+			}
+			// Create buffered reader for optimal I/O performance
+			reader, method, err := openDecompressed(bufio.NewReader(input), *decompressArg)
+			if err == nil && method != "none" && checkpointState != nil {
+				err = errors.New("-since-checkpoint cannot read compressed input")
+			}
+			if err != nil {
+				file.Close()
+				return nil, nil, fmt.Errorf("input '%s': %w", name, err)
+			}
+			if transcode {
+				// A decoder is made for each input, as it detects the byte order
+				decoder, _ := newDecoder(*encodingArg)
+				reader = newDecodingReader(reader, decoder)
+			}
+			if *binaryArg != "wrap" {
+				head, err := reader.Peek(reader.Size())
+				if err != nil && err != io.EOF {
+					file.Close()
+					return nil, nil, fmt.Errorf("input '%s': %w", name, err)
+				}
+				nulSeparated := *nullTerminated || irsAuto || strings.Contains(inputSep, "\x00")
+				if reason := binaryReason(head, err == io.EOF, nulSeparated); reason != "" {
+					switch *binaryArg {
+					case "skip":
+						fmt.Fprintf(os.Stderr, "%s: skipping '%s', which looks binary: %s\n", pgmName, name, reason)
+						return emptyReader{}, file, nil
+					case "pass":
+						return &passReader{reader: reader}, file, nil
+					case "error":
+						file.Close()
+						return nil, nil, fmt.Errorf("input '%s' looks binary: %s; use -encode to wrap it, or -binary skip or pass", name, reason)
+					}
+				}
+			}
+			if *csvIn {
+				return newCSVRowColumnReader(reader, *col), file, nil
+			}
+			sep := inputSep
+			if irsAuto {
+				sep = detectSeparator(reader)
+				if *verbose {
+					fmt.Fprintf(os.Stderr, "%s: '%s': detected %s record separators\n", pgmName, name, separatorNames[sep])
+				}
+			}
+			var lines recordReader
+			if *recordLen > 0 {
+				lines = newFixedReader(reader, *recordLen)
+			} else if irsPattern != nil {
+				lines = newRegexReader(reader, irsPattern)
+			} else if irsAuto && sep == "\r\n" {
+				// Stray LF-only lines in a CRLF input are read too
+				lines = &trimCRReader{lines: newLineReader(reader, '\n')}
+			} else {
+				lines = newSeparatorReader(reader, sep)
+			}
+			if *crlfIn {
+				lines = &trimCRReader{lines: lines}
+			}
+			if *tsvIn {
+				return newTSVRowColumnReader(lines, *col), file, nil
+			}
+			if convertFrom != "" {
+				return newConvertReader(convertFrom, reader, lines, delimiter, *escapeDelim), file, nil
+			}
+			if *jsonlIn {
+				return newJSONLReader(lines, jsonPath), file, nil
+			}
+			return lines, file, nil
+		}
+
+		// openRecords opens one input and discards its first -skip records.
+		// With -keep-going, an input that fails is read as far as it can be.
+		openRecords := func(name string) (recordReader, io.Closer, error) {
+			records, file, err := openRecordsFrom(name)
+			if err != nil {
+				if skipped == nil {
+					return nil, nil, err
+				}
+				skipped(err)
+				return emptyReader{}, emptyReader{}, nil
+			}
+			if _, raw := records.(*passReader); raw {
+				return records, file, nil
+			}
+			if *skipRecords > 0 {
+				records = &skipReader{records: records, n: *skipRecords, stats: stats}
+			}
+			if skipped != nil {
+				records = &failSoftReader{records: records, name: name, failed: skipped}
+			}
+			return records, file, nil
+		}
+
+		// Every input file must exist before any is read
+		for _, name := range append([]string{filename}, inputs...) {
+			if name != "-" && !isURL(name) && !*keepGoing {
+				if _, err := os.Stat(name); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: failed to open file '%s': %v\n", name, err)
+					os.Exit(1)
+				}
+			}
+		}
+		openSource = func() (recordReader, io.Closer, error) {
+			if inputs != nil && *mergeArg != "" {
+				merge, err := newMergeReader(inputs, *mergeArg, openRecords)
+				if err != nil {
+					return nil, nil, err
+				}
+				sources = merge
+				return merge, merge, nil
+			}
+			if inputs != nil {
+				multi := newMultiReader(inputs, openRecords)
+				sources = multi
+				return multi, emptyReader{}, nil
+			}
+			return openRecords(filename)
+		}
+	}
+
+	// With -resume-state, a state file left by a failed run says where to continue
+	var resume *resumeState
+	if *resumeStateFile != "" {
+		if len(outputFiles) != 1 || sqliteOutput || outputFiles[0] == "-" || strings.HasPrefix(outputFiles[0], "/dev/fd/") {
+			fmt.Fprintln(os.Stderr, "Error: -resume-state requires a single -o FILE")
+			os.Exit(1)
+		}
+		if *manifestFile != "" {
+			fmt.Fprintln(os.Stderr, "Error: -resume-state cannot be combined with -manifest")
+			os.Exit(1)
+		}
+		if *noFinalNewline {
+			fmt.Fprintln(os.Stderr, "Error: -no-final-newline cannot be combined with -resume-state")
+			os.Exit(1)
+		}
+		if *header != "" {
+			fmt.Fprintln(os.Stderr, "Error: -resume-state cannot be combined with -header, which a resumed run would write again partway through the output")
+			os.Exit(1)
+		}
+		// The records they hold back would be counted as written
+		if *tailRecords > 0 || *sampleCount > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -resume-state cannot be combined with -tail or -sample-n, which hold records back until the input ends")
+			os.Exit(1)
+		}
+		resume, err = loadResumeState(*resumeStateFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if resume != nil && resume.Input != filename {
+			fmt.Fprintf(os.Stderr, "Error: resume state '%s' is for input '%s', not '%s'\n", *resumeStateFile, resume.Input, filename)
+			os.Exit(1)
+		}
+	}
+
+	// With -split-lines or -split-bytes, the -o value names a series of files
+	// opened as output is written
+	var splitBytes int64
+	if *splitBytesArg != "" {
+		splitBytes, err = parseSize(*splitBytesArg)
+		if err != nil || splitBytes == 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -split-bytes '%s': must be a positive size\n", *splitBytesArg)
+			os.Exit(1)
+		}
+	}
+	splitOutput := *splitLines != 0 || splitBytes > 0
+	if splitOutput {
+		if *splitLines < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -split-lines %d: must not be negative\n", *splitLines)
+			os.Exit(1)
+		}
+		if len(outputFiles) != 1 || sqliteOutput || outputFiles[0] == "-" || strings.HasPrefix(outputFiles[0], "/dev/fd/") {
+			fmt.Fprintln(os.Stderr, "Error: -split-lines and -split-bytes require a single -o FILE to name the output files")
+			os.Exit(1)
+		}
+		if *manifestFile != "" || *resumeStateFile != "" {
+			fmt.Fprintln(os.Stderr, "Error: -split-lines and -split-bytes cannot be combined with -manifest or -resume-state")
+			os.Exit(1)
+		}
+	}
+
+	// With -compress, or -o FILE.gz, output is compressed as it is written
+	if *compressArg != "" && !slices.Contains(compressMethods, *compressArg) {
+		fmt.Fprintf(os.Stderr, "Error: unknown compression '%s' (supported: %s)\n", *compressArg, strings.Join(compressMethods, ", "))
+		os.Exit(1)
+	}
+	compressed := outputCompression("", *compressArg) == "gzip"
+	for _, name := range outputFiles {
+		compressed = compressed || outputCompression(name, *compressArg) == "gzip"
+	}
+	if compressed && (resume != nil || *resumeStateFile != "" || splitOutput) {
+		fmt.Fprintln(os.Stderr, "Error: compressed output cannot be combined with -resume-state, -split-lines, or -split-bytes")
+		os.Exit(1)
+	}
+
+	opts := options{
+		source:    filename,
+		skipEmpty: *skipEmpty,
+		keepLast:  (convertFrom != "" && convertFrom != "lines") || tableIn || *jsonlIn,
+		format:    newDelimiterFormatter(delimiter, terminator, *escapeDelim),
+	}
+	if resume != nil {
+		opts.skip = resume.Records
+	}
+	opts.limit = limit
+	opts.tail = *tailRecords
+	if *sampleFraction > 0 || *sampleCount > 0 {
+		opts.sample = newSampler(*sampleFraction, *sampleCount, *seed)
+	}
+	if *flushIdle < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -flush-idle %v: must not be negative\n", *flushIdle)
+		os.Exit(1)
+	}
+	opts.flushIdle = *flushIdle
+	opts.stats = stats
+	csvColumns := []string{"line"}
+	if *csvCols != "" {
+		csvColumns, err = parseCSVColumns(*csvCols)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		*csvOutput = true
+	}
+
+	joinSet := flagSet("join")
+	formats := 0
+	for _, selected := range []bool{*jsonOutput, *jsOutput, *csvOutput, *mdTable, *htmlList, *xmlTag != "", *templateText != "", *kvPrefix != "", *dotenvKey != "", *curlHeaders, *curlData, joinSet, *columns != 0, *tsvOutput, *tomlKey != "", *sqlIn, *sqlInsert, jsonString, heredoc} {
+		if selected {
+			formats++
+		}
+	}
+	sqlBackslashes, ok := sqlDialects[*sqlDialect]
+	if !ok && (*sqlIn || *sqlInsert) {
+		fmt.Fprintf(os.Stderr, "Error: invalid -sql-dialect '%s' (supported: standard, mysql)\n", *sqlDialect)
+		os.Exit(1)
+	}
+	switch {
+	case formats > 1:
+		fmt.Fprintln(os.Stderr, "Error: only one output format (-format, -json, -js, -csv, -md-table, -html-list, -xml, -template, -kv, -dotenv, -curl-h, -curl-d, -join, -columns, -tsv, -toml, -sql-in, -sql-insert) may be selected")
+		os.Exit(1)
+	case *jsonOutput:
+		opts.format = newJSONFormatter()
+	case *jsOutput:
+		quotes := map[string]byte{"single": '\'', "double": '"'}
+		quote, ok := quotes[*jsQuote]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: invalid -js-quote '%s' (supported: single, double)\n", *jsQuote)
+			os.Exit(1)
+		}
+		opts.format = newJSFormatter(quote, *jsTrailingComma)
+	case jsonString:
+		opts.format = newJSONStringFormatter(inputSep)
+	case heredoc:
+		opts.format, err = newHeredocFormatter(*heredocCmd, *heredocTagArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case *csvOutput:
+		opts.format = newCSVFormatter(csvColumns, *csvCRLF || *crlf)
+	case *mdTable:
+		opts.format = newMDTableFormatter(*mdNum)
+	case *htmlList:
+		opts.format = newHTMLListFormatter()
+	case *xmlTag != "":
+		opts.format, err = newXMLFormatter(*xmlTag, *xmlAttrs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case *templateText != "":
+		opts.format, err = newTemplateFormatter(*templateText)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case *kvPrefix != "":
+		opts.format, err = newKVFormatter(*kvPrefix, *kvNum, *kvSection, delimiter, *escapeDelim)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case *dotenvKey != "":
+		opts.format, err = newDotenvFormatter(*dotenvKey, *dotenvDocker)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case *curlHeaders || *curlData:
+		opts.format = newCurlFormatter(*curlHeaders)
+	case joinSet:
+		sep, err := parseDelimiter(*joinSepArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -join separator: %v\n", err)
+			os.Exit(1)
+		}
+		opts.format = newJoinFormatter(delimiter, *escapeDelim, sep, *header, *footer)
+	case *columns != 0:
+		if *columns < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -columns %d: must not be negative\n", *columns)
+			os.Exit(1)
+		}
+		sep, err := parseDelimiter(*columnsSepArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -columns-sep: %v\n", err)
+			os.Exit(1)
+		}
+		opts.format = newColumnsFormatter(delimiter, *escapeDelim, *columns, sep, *columnsAlign, *columnsTrailing)
+	case *tsvOutput:
+		// TSV loaders take values as they are, so -d applies only when given
+		tsvDelimiter := ""
+		if flagSet("d") {
+			tsvDelimiter = delimiter
+		}
+		opts.format = newTSVFormatter(tsvDelimiter)
+	case *tomlKey != "":
+		opts.format = newTOMLFormatter(*tomlKey)
+	case *sqlIn:
+		if *sqlInChunk < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -sql-in-chunk %d: must not be negative\n", *sqlInChunk)
+			os.Exit(1)
+		}
+		opts.format = newSQLInFormatter(*sqlInChunk, sqlBackslashes)
+	case *sqlInsert:
+		if *sqlInsertBatch < 1 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -sql-insert-batch %d: must be at least 1\n", *sqlInsertBatch)
+			os.Exit(1)
+		}
+		opts.format, err = newSQLInsertFormatter(*table, *column, *sqlInsertBatch, sqlBackslashes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if sqliteOutput {
+		if formats > 0 || *postURL != "" {
+			fmt.Fprintln(os.Stderr, "Error: -o sqlite:FILE cannot be combined with another output format or -post")
+			os.Exit(1)
+		}
+		var columns []string
+		if *sqliteCols != "" {
+			columns, err = parseSQLiteColumns(*sqliteCols)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if sqliteFile == "" || *table == "" || *sqliteBatch < 1 {
+			fmt.Fprintln(os.Stderr, "Error: -o sqlite:FILE requires a filename, a non-empty -table, and a -sqlite-batch of at least 1")
+			os.Exit(1)
+		}
+		opts.format = newSQLiteFormatter(sqliteFile, *table, columns, *sqliteBatch)
+	}
+
+	if tableIn {
+		if formats > 0 || sqliteOutput || *postURL != "" || *recordWidth > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -csv-in and -tsv-in write CSV or TSV and cannot be combined with another output format, -o sqlite:FILE, -post, or -record-width")
+			os.Exit(1)
+		}
+		opts.format = newColumnFormatter(newDelimiterFormatter(delimiter, "", *escapeDelim), *col, *tsvIn, *crlf)
+	}
+
+	// Find flags that the chosen output would silently ignore
+	urlInput := isURL(filename) || slices.ContainsFunc(inputs, isURL)
+	plainOutput := formats == 0 && !sqliteOutput
+	wrappedOutput := plainOutput || *kvPrefix != "" || joinSet || *columns != 0
+	if *binaryArg == "pass" && (!plainOutput || tableIn || *postURL != "") {
+		fmt.Fprintln(os.Stderr, "Error: -binary pass requires plain wrapped output, not another output format, -csv-in, -tsv-in, or -post")
+		os.Exit(1)
+	}
+	ineffective := ineffectiveFlags(map[string]bool{
+		"d":                 wrappedOutput || *tsvOutput || convertFrom == "wrapped",
+		"none":              wrappedOutput || *tsvOutput || convertFrom == "wrapped",
+		"escape":            wrappedOutput || convertFrom == "wrapped",
+		"ors":               plainOutput && !tableIn,
+		"col":               tableIn,
+		"path":              *jsonlIn,
+		"crlf-in":           !*csvIn && *fromSQLite == "" && *fromCSVColumn == "",
+		"skip":              *fromSQLite == "" && *fromCSVColumn == "",
+		"merge":             inputs != nil,
+		"keep-going":        *fromSQLite == "" && *fromCSVColumn == "",
+		"stdin-timeout":     filename == "-" || slices.Contains(inputs, "-"),
+		"seed":              *sampleFraction > 0 || *sampleCount > 0,
+		"no-final-newline":  !sqliteOutput && *postURL == "",
+		"crlf":              !sqliteOutput && *postURL == "",
+		"compress":          !sqliteOutput && *postURL == "",
+		"sentinel-file":     *delimiterArg == "random",
+		"csv-crlf":          *csvOutput,
+		"sql-in-chunk":      *sqlIn,
+		"md-num":            *mdTable,
+		"xml-attrs":         *xmlTag != "",
+		"kv-num":            *kvPrefix != "",
+		"kv-section":        *kvPrefix != "",
+		"dotenv-docker":     *dotenvKey != "",
+		"columns-sep":       *columns != 0,
+		"columns-align":     *columns != 0,
+		"columns-trailing":  *columns != 0,
+		"js-quote":          *jsOutput,
+		"js-trailing-comma": *jsOutput,
+		"tag":               heredoc,
+		"heredoc-cmd":       heredoc,
+		"column":            *sqlInsert,
+		"sql-insert-batch":  *sqlInsert,
+		"sql-dialect":       *sqlIn || *sqlInsert,
+		"table":             *sqlInsert || sqliteOutput,
+		"sqlite-cols":       sqliteOutput,
+		"sqlite-batch":      sqliteOutput,
+		"post-header":       *postURL != "",
+		"post-batch":        *postURL != "",
+		"post-concurrency":  *postURL != "",
+		"post-retries":      *postURL != "",
+		"post-backoff":      *postURL != "",
+		"post-timeout":      *postURL != "",
+		"verbose":           irsAuto || *followName,
+		"url-retries":       urlInput,
+		"url-backoff":       urlInput,
+		"url-timeout":       urlInput,
+		"plugin-timeout":    *pluginCmd != "",
+		"reject-file":       *postURL != "",
+		"pad-char":          *recordWidth > 0,
+		"paragraph-sep":     *paragraph,
+		"wrap-words":        *wrapWidth > 0,
+		"ellipsis":          *truncate > 0,
+		"deconfuse-map":     *deconfuse,
+		"include":           len(recursiveDirs) > 0,
+		"exclude":           len(recursiveDirs) > 0,
+		"gitignore":         len(recursiveDirs) > 0,
+	})
+
+	// With -strict, ineffective flags are errors
+	if *strict {
+		if len(ineffective) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: -strict: -%s has no effect with the other options given\n", ineffective[0])
+			os.Exit(1)
+		}
+		opts.checks = append(opts.checks, checkUTF8)
+		if wrappedOutput && delimiter != "" && !*escapeDelim {
+			opts.checks = append(opts.checks, newCollisionCheck(delimiter))
+		}
+	}
+	if maxRecord > 0 {
+		opts.checks = append(opts.checks, newSizeCheck(maxRecord))
+	}
+
+	if *recordWidth != 0 {
+		padChar, err := parseDelimiter(*padCharArg)
+		if err != nil || len(padChar) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -pad-char '%s': must be a single byte\n", *padCharArg)
+			os.Exit(1)
+		}
+		if *recordWidth < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -record-width %d: must not be negative\n", *recordWidth)
+			os.Exit(1)
+		}
+		if (formats > 0 && !*tsvOutput) || sqliteOutput {
+			fmt.Fprintln(os.Stderr, "Error: -record-width applies only to delimiter-wrapped or -tsv output")
+			os.Exit(1)
+		}
+		padTerminator := "\n"
+		if plainOutput {
+			padTerminator = terminator
+		}
+		opts.format = newPaddedFormatter(opts.format, *recordWidth, padChar[0], padTerminator)
+	}
+
+	if (*header != "" || *footer != "") && !joinSet {
+		if sqliteOutput {
+			fmt.Fprintln(os.Stderr, "Error: -header and -footer cannot be used with -o sqlite:FILE")
+			os.Exit(1)
+		}
+		opts.format = newFramedFormatter(opts.format, *header, *footer)
+	}
+
+	// CSV output writes CRLF itself, also inside quoted values
+	if *crlf && !*csvOutput && !tableIn && !sqliteOutput && *postURL == "" {
+		opts.format = newCRLFFormatter(opts.format)
+	}
+
+	if *noFinalNewline && !sqliteOutput && *postURL == "" {
+		finalTerminator := "\n"
+		switch {
+		case plainOutput && *footer == "" && !tableIn:
+			finalTerminator = terminator
+		}
+		if *crlf || (*csvOutput && *csvCRLF) {
+			// As written by -crlf, where a \n that has a \r already keeps it
+			finalTerminator = strings.ReplaceAll(strings.ReplaceAll(finalTerminator, "\r\n", "\n"), "\n", "\r\n")
+		}
+		opts.format = newUnterminatedFormatter(opts.format, finalTerminator)
+	}
+
+	if splitOutput {
+		if *postURL != "" || jsonString || heredoc {
+			fmt.Fprintln(os.Stderr, "Error: -split-lines and -split-bytes cannot be used with -post or -format json-string or heredoc")
+			os.Exit(1)
+		}
+		// Size limits need records that render the same wherever they fall
+		// and documents that have no closing text
+		if splitBytes > 0 && (*jsonOutput || *jsOutput || *tomlKey != "" || joinSet || *columns != 0 || *sqlIn || (*sqlInsert && *sqlInsertBatch > 1) || *htmlList || *footer != "") {
+			fmt.Fprintln(os.Stderr, "Error: -split-bytes cannot be used with -json, -js, -toml, -join, -columns, -sql-in, -sql-insert-batch above 1, -html-list, or -footer")
+			os.Exit(1)
+		}
+		if !*checkFlags {
+			opts.format = newSplitFormatter(opts.format, outputFiles[0], *splitLines, splitBytes)
+		}
+	}
+
+	if *resumeStateFile != "" && ((formats > 0 && !*tsvOutput) || *postURL != "") {
+		fmt.Fprintln(os.Stderr, "Error: -resume-state applies only to delimiter-wrapped or -tsv output written with -o")
+		os.Exit(1)
+	}
+
+	var headers http.Header
+	if *postURL != "" {
+		if *jsonOutput || *jsOutput || *mdTable || *htmlList || joinSet || *columns != 0 || *tomlKey != "" || *sqlIn || *sqlInsert || jsonString || heredoc {
+			fmt.Fprintln(os.Stderr, "Error: -post cannot be used with -json, -js, -md-table, -html-list, -join, -columns, -toml, -sql-in, -sql-insert, or -format json-string or heredoc")
+			os.Exit(1)
+		}
+		if *postBatchSize < 1 || *postConcurrency < 1 || *postRetries < 0 {
+			fmt.Fprintln(os.Stderr, "Error: -post-batch and -post-concurrency must be at least 1, -post-retries at least 0")
+			os.Exit(1)
+		}
+		headers, err = parseHeaders(postHeaders)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Build the record filters, applied after all transforms
+	if *includeFile != "" {
+		set, err := loadLineSet(*includeFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.filters = append(opts.filters, set.contains)
+	}
+	if *excludeFile != "" {
+		set, err := loadLineSet(*excludeFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.filters = append(opts.filters, func(line []byte) bool { return !set.contains(line) })
+	}
+	if *grepPattern != "" {
+		re, err := regexp.Compile(*grepPattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -grep: %v\n", err)
+			os.Exit(1)
+		}
+		opts.filters = append(opts.filters, re.Match)
+	}
+	if *grepVPattern != "" {
+		re, err := regexp.Compile(*grepVPattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -grep-v: %v\n", err)
+			os.Exit(1)
+		}
+		opts.filters = append(opts.filters, func(line []byte) bool { return !re.Match(line) })
+	}
+
+	// Build the transform pipeline; order matters
+	if *encodeArg != "" {
+		encode, err := newEncodeTransform(*encodeArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.transforms = append(opts.transforms, encode)
+	}
+	if *stripInvis {
+		opts.transforms = append(opts.transforms, transformFunc(stripInvisible))
+	}
+	if *deconfuse {
+		d, err := newDeconfuser(*deconfuseMap)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.transforms = append(opts.transforms, d)
+	}
+	for _, e := range edits {
+		t, err := newEditTransform(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.transforms = append(opts.transforms, t)
+	}
+
+	if *pluginTimeout < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -plugin-timeout %v: must not be negative\n", *pluginTimeout)
+		os.Exit(1)
+	}
+	var plugin *execPlugin
+	if *pluginCmd != "" && !*checkFlags {
+		plugin, err = startPlugin(*pluginCmd, *pluginTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.transforms = append(opts.transforms, plugin)
+	}
+	if *truncate > 0 {
+		opts.transforms = append(opts.transforms, newTruncateTransform(*truncate, *ellipsis))
+	}
+
+	if *checkFlags {
+		var buffering []string
+		if heredoc {
+			buffering = append(buffering, "-format heredoc holds the whole input in memory until it ends")
+		}
+		if *columns != 0 && *columnsAlign {
+			buffering = append(buffering, "-columns-align holds the whole input in memory until it ends")
+		}
+		if *sampleCount > 0 {
+			buffering = append(buffering, fmt.Sprintf("-sample-n holds %d records in memory until the input ends", *sampleCount))
+		}
+		if *tailRecords > 0 {
+			buffering = append(buffering, fmt.Sprintf("-tail holds the last %d records in memory until the input ends", *tailRecords))
+		}
+		if *paragraph {
+			buffering = append(buffering, "-paragraph holds each paragraph in memory until a blank line")
+		}
+		if *postURL != "" && *postBatchSize > 1 {
+			buffering = append(buffering, fmt.Sprintf("-post-batch holds up to %d records before sending", *postBatchSize))
+		}
+		if sqliteOutput {
+			buffering = append(buffering, fmt.Sprintf("-o sqlite: commits every %d rows", *sqliteBatch))
+		}
+		reportFlagCheck(os.Stdout, ineffective, buffering)
+		return
+	}
+
+	// Open input source
+	var closer io.Closer
+	records, closer, err = openSource()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer closer.Close()
+	if *paragraph {
+		records = newParagraphReader(records, paragraphSep)
+	}
+	if *wrapWidth > 0 {
+		records = newWidthReader(records, *wrapWidth, *wrapWords)
+	}
+	opts.sources = sources
+	if rows, ok := records.(rowSource); ok && tableIn {
+		opts.rows = rows
+	}
+	if raw, ok := records.(rawSource); ok {
+		opts.raw = raw
+	}
+
+	// Everything that can reject the options has run; only now are outputs
+	// created, so a rejected run leaves existing files untouched
+	if *delimiterArg == "random" && !*noDelimiter {
+		if err := announceSentinel(delimiter, *sentinelFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: random delimiter: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var sink *postSink
+	if *postURL != "" {
+		sink, err = newPostSink(postConfig{
+			url:         *postURL,
+			headers:     headers,
+			batchSize:   *postBatchSize,
+			concurrency: *postConcurrency,
+			retries:     *postRetries,
+			backoff:     *postBackoff,
+			timeout:     *postTimeout,
+			rejectFile:  *rejectFile,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.format = newPostFormatter(opts.format, sink)
+	}
+
+	// Set up output destinations
+	var output io.Writer = os.Stdout
+	var fanout *fanoutWriter
+	var compressedFile io.Closer
+	switch {
+	case splitOutput:
+		output = io.Discard
+	case resume != nil:
+		outFile, err := openResumedOutput(outputFiles[0], resume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to resume output file '%s': %v\n", outputFiles[0], err)
+			os.Exit(1)
+		}
+		defer outFile.Close()
+		output = outFile
+	case len(outputFiles) == 0 && compressed && *postURL == "":
+		outFile, _ := openCompressedOutput("-", *compressArg)
+		compressedFile, output = outFile, outFile
+	case len(outputFiles) == 1 && !sqliteOutput:
+		outFile, err := openCompressedOutput(outputFiles[0], *compressArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create output file '%s': %v\n", outputFiles[0], err)
+			os.Exit(1)
+		}
+		// The end of a compressed stream is only written on Close
+		if compressed {
+			compressedFile = outFile
+		} else {
+			defer outFile.Close()
+		}
+		output = outFile
+	case len(outputFiles) > 1:
+		fanout, err = newFanoutWriter(outputFiles, *compressArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		output = fanout
+	}
+
+	if outputHash != nil {
+		output = io.MultiWriter(output, outputHash)
+	}
+
+	// Create buffered writer for optimal I/O performance, keeping track of
+	// which records have completely reached the output
+	progressOut := &progressWriter{w: output}
+	writer := bufio.NewWriter(progressOut)
+	progress := newOutputProgress(progressOut, writer)
+	opts.progress = progress
+
+	if err := wrapRecords(records, writer, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		reportOutputFailure(progress, resume, *resumeStateFile, filename)
+		os.Exit(1)
+	}
+
+	if plugin != nil {
+		if err := plugin.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if sink != nil {
+		if err := sink.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
+		reportOutputFailure(progress, resume, *resumeStateFile, filename)
+		os.Exit(1)
+	}
+
+	// The run is complete, so there is nothing left to resume
+	if *resumeStateFile != "" {
+		if err := os.Remove(*resumeStateFile); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error: failed to remove resume state: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if compressedFile != nil {
+		if err := compressedFile.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if fanout != nil {
+		if err := fanout.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Everything read has been written, so the next run can start after it
+	if checkpointState != nil && !*checkFlags {
+		maps.Copy(checkpointState.Inputs, checkpointNext)
+		if err := checkpointState.save(*sinceCheckpoint); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to save checkpoint: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *showStats {
+		reportStats(os.Stderr, opts.stats)
+	}
+
+	if *failOnDrop && opts.stats.dropped() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %d of %d records were dropped\n", opts.stats.dropped(), opts.stats.read)
+		os.Exit(1)
+	}
+
+	if *failEmpty && opts.stats.written == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no records were written")
+		os.Exit(1)
+	}
+
+	if *manifestFile != "" {
+		outputNames := []string(outputFiles)
+		if len(outputNames) == 0 {
+			outputNames = []string{"-"}
+		}
+		var entries []manifestEntry
+		for _, name := range outputNames {
+			entries = append(entries, newManifestEntry(filename, name, opts.stats, inputHash, outputHash))
+		}
+		if err := writeManifest(*manifestFile, entries); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to write manifest: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *report == "memory" {
+		reportMemory(os.Stderr)
+	}
+
+	if unreadable > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %d of the inputs could not be read completely\n", unreadable)
+		os.Exit(1)
 	}
 }
@@ -1,12 +1,29 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 // runWrapline executes the wrapline program with given arguments and input
@@ -124,38 +141,44 @@ func TestHexDelimiter(t *testing.T) {
 	}
 }
 
-// TestStripWhitespace tests the -s flag
-func TestStripWhitespace(t *testing.T) {
+// TestDelimiterFromFile tests the -d @file notation
+func TestDelimiterFromFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
 	tests := []struct {
 		name     string
+		contents string
 		input    string
 		expected string
 	}{
 		{
-			name:     "leading spaces",
-			input:    "   hello\n",
-			expected: "\"hello\"\n",
-		},
-		{
-			name:     "trailing spaces",
-			input:    "world   \n",
-			expected: "\"world\"\n",
+			name:     "trailing newline removed",
+			contents: "`$(x)`\n",
+			input:    "test\n",
+			expected: "`$(x)`test`$(x)`\n",
 		},
 		{
-			name:     "both sides",
-			input:    "  test  \n",
-			expected: "\"test\"\n",
+			name:     "no trailing newline",
+			contents: "'",
+			input:    "test\n",
+			expected: "'test'\n",
 		},
 		{
-			name:     "tabs",
-			input:    "\t\tdata\t\t\n",
-			expected: "\"data\"\n",
+			name:     "embedded newline kept",
+			contents: "<\n>\n",
+			input:    "test\n",
+			expected: "<\n>test<\n>\n",
 		},
 	}
 
-	for _, tt := range tests {
+	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			stdout, stderr, err := runWrapline(t, []string{"-s", "-"}, tt.input)
+			delimFile := filepath.Join(tmpDir, "delim"+string(rune('0'+i)))
+			if err := os.WriteFile(delimFile, []byte(tt.contents), 0644); err != nil {
+				t.Fatalf("Failed to create delimiter file: %v", err)
+			}
+
+			stdout, stderr, err := runWrapline(t, []string{"-d", "@" + delimFile, "-"}, tt.input)
 
 			if err != nil {
 				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
@@ -168,88 +191,136 @@ func TestStripWhitespace(t *testing.T) {
 	}
 }
 
-// TestSkipEmptyLines tests the -e flag
-func TestSkipEmptyLines(t *testing.T) {
-	input := "hello\n\nworld\n\n"
-	expected := "\"hello\"\n\"world\"\n"
-
-	stdout, stderr, err := runWrapline(t, []string{"-e", "-"}, input)
+// TestRandomDelimiter tests the -d random and -sentinel-file flags
+func TestRandomDelimiter(t *testing.T) {
+	input := "say \"hi\"\n"
 
+	stdout, stderr, err := runWrapline(t, []string{"-d", "random", "-"}, input)
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
 	}
 
+	sentinel := strings.TrimSpace(stderr)
+	if !strings.HasPrefix(sentinel, "WRAPLINE_") || len(sentinel) != len("WRAPLINE_")+32 {
+		t.Fatalf("Expected sentinel on STDERR, got: %q", stderr)
+	}
+	expected := sentinel + "say \"hi\"" + sentinel + "\n"
 	if stdout != expected {
-		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+		t.Errorf("Expected: %q, Got: %q", expected, stdout)
+	}
+
+	// A second run must pick a different sentinel
+	_, stderr2, _ := runWrapline(t, []string{"-d", "random", "-"}, input)
+	if strings.TrimSpace(stderr2) == sentinel {
+		t.Errorf("Expected a different sentinel on each run, got %q twice", sentinel)
+	}
+
+	// With -sentinel-file, the sentinel goes to the file and STDERR stays empty
+	sentinelFile := filepath.Join(t.TempDir(), "sentinel.txt")
+	stdout, stderr, err = runWrapline(t, []string{"-d", "random", "-sentinel-file", sentinelFile, "-"}, input)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+	if stderr != "" {
+		t.Errorf("Expected empty STDERR, got: %q", stderr)
+	}
+	content, err := os.ReadFile(sentinelFile)
+	if err != nil {
+		t.Fatalf("Failed to read sentinel file: %v", err)
+	}
+	sentinel = strings.TrimSpace(string(content))
+	if !strings.HasPrefix(stdout, sentinel+"say") {
+		t.Errorf("Expected output wrapped with %q, got: %q", sentinel, stdout)
 	}
 }
 
-// TestEmptyLastLine tests that empty last lines are always skipped
-func TestEmptyLastLine(t *testing.T) {
+// TestNoDelimiter tests pass-through mode with an empty -d value and -none
+func TestNoDelimiter(t *testing.T) {
 	tests := []struct {
 		name     string
+		args     []string
 		input    string
 		expected string
 	}{
 		{
-			name:     "single line with trailing newline",
-			input:    "hello\n",
-			expected: "\"hello\"\n",
+			name:     "empty delimiter",
+			args:     []string{"-d", "", "-"},
+			input:    "hello\nworld\n",
+			expected: "hello\nworld\n",
 		},
 		{
-			name:     "multiple lines with empty last",
-			input:    "hello\nworld\n\n",
-			expected: "\"hello\"\n\"world\"\n",
+			name:     "none flag",
+			args:     []string{"-none", "-"},
+			input:    "hello\nworld\n",
+			expected: "hello\nworld\n",
 		},
 		{
-			name:     "without -e flag, middle empty preserved",
-			input:    "hello\n\nworld\n",
-			expected: "\"hello\"\n\"\"\n\"world\"\n",
+			name:     "none with strip and skip empty",
+			args:     []string{"-none", "-s", "-e", "-"},
+			input:    "  hello  \n\n   \n world\n",
+			expected: "hello\nworld\n",
+		},
+		{
+			name:     "none with escape leaves content alone",
+			args:     []string{"-none", "-escape", "-"},
+			input:    "say \"hi\"\n",
+			expected: "say \"hi\"\n",
+		},
+		{
+			name:     "none with null-terminated input",
+			args:     []string{"-none", "-0", "-"},
+			input:    "one\x00two\x00",
+			expected: "one\ntwo\n",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			stdout, stderr, err := runWrapline(t, []string{"-"}, tt.input)
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
 
 			if err != nil {
 				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
 			}
 
 			if stdout != tt.expected {
-				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+				t.Errorf("Expected: %q, Got: %q", tt.expected, stdout)
 			}
 		})
 	}
 }
 
-// TestEscapeDelimiter tests the -escape flag
-func TestEscapeDelimiter(t *testing.T) {
+// TestStripWhitespace tests the -s flag
+func TestStripWhitespace(t *testing.T) {
 	tests := []struct {
 		name     string
 		input    string
 		expected string
 	}{
 		{
-			name:     "single delimiter in content",
-			input:    "She said \"hello\"\n",
-			expected: "\"She said \\\"hello\\\"\"\n",
+			name:     "leading spaces",
+			input:    "   hello\n",
+			expected: "\"hello\"\n",
 		},
 		{
-			name:     "multiple delimiters",
-			input:    "\"quoted\" and \"more\"\n",
-			expected: "\"\\\"quoted\\\" and \\\"more\\\"\"\n",
+			name:     "trailing spaces",
+			input:    "world   \n",
+			expected: "\"world\"\n",
 		},
 		{
-			name:     "no delimiters",
-			input:    "plain text\n",
-			expected: "\"plain text\"\n",
+			name:     "both sides",
+			input:    "  test  \n",
+			expected: "\"test\"\n",
+		},
+		{
+			name:     "tabs",
+			input:    "\t\tdata\t\t\n",
+			expected: "\"data\"\n",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			stdout, stderr, err := runWrapline(t, []string{"-escape", "-"}, tt.input)
+			stdout, stderr, err := runWrapline(t, []string{"-s", "-"}, tt.input)
 
 			if err != nil {
 				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
@@ -262,72 +333,8 @@ func TestEscapeDelimiter(t *testing.T) {
 	}
 }
 
-// TestNullTerminated tests the -0 flag
-func TestNullTerminated(t *testing.T) {
-	// Create input with null terminators
-	input := "hello\x00world\x00test\x00"
-	expected := "\"hello\"\n\"world\"\n\"test\"\n"
-
-	stdout, stderr, err := runWrapline(t, []string{"-0", "-"}, input)
-
-	if err != nil {
-		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
-	}
-
-	if stdout != expected {
-		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
-	}
-}
-
-// TestOutputFile tests the -o flag
-func TestOutputFile(t *testing.T) {
-	tmpDir := t.TempDir()
-	outputFile := filepath.Join(tmpDir, "output.txt")
-
-	input := "hello\nworld\n"
-	expected := "\"hello\"\n\"world\"\n"
-
-	_, stderr, err := runWrapline(t, []string{"-o", outputFile, "-"}, input)
-
-	if err != nil {
-		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
-	}
-
-	content, err := os.ReadFile(outputFile)
-	if err != nil {
-		t.Fatalf("Failed to read output file: %v", err)
-	}
-
-	if string(content) != expected {
-		t.Errorf("Expected:\n%q\nGot:\n%q", expected, string(content))
-	}
-}
-
-// TestFileInput tests reading from a file instead of STDIN
-func TestFileInput(t *testing.T) {
-	tmpDir := t.TempDir()
-	inputFile := filepath.Join(tmpDir, "input.txt")
-
-	input := "hello\nworld\n"
-	expected := "\"hello\"\n\"world\"\n"
-
-	if err := os.WriteFile(inputFile, []byte(input), 0644); err != nil {
-		t.Fatalf("Failed to create input file: %v", err)
-	}
-
-	stdout, stderr, err := runWrapline(t, []string{inputFile}, "")
-
-	if err != nil {
-		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
-	}
-
-	if stdout != expected {
-		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
-	}
-}
-
-// TestCombinations tests common flag combinations
-func TestCombinations(t *testing.T) {
+// TestStripInvisible tests the -strip-invisible flag
+func TestStripInvisible(t *testing.T) {
 	tests := []struct {
 		name     string
 		args     []string
@@ -335,34 +342,40 @@ func TestCombinations(t *testing.T) {
 		expected string
 	}{
 		{
-			name:     "strip and skip empty",
-			args:     []string{"-s", "-e", "-"},
-			input:    "  hello  \n\n  world  \n",
-			expected: "\"hello\"\n\"world\"\n",
+			name:     "soft hyphen",
+			args:     []string{"-strip-invisible", "-"},
+			input:    "hy\u00adphen\n",
+			expected: "\"hyphen\"\n",
 		},
 		{
-			name:     "custom delimiter with escape",
-			args:     []string{"-d", "'", "-escape", "-"},
-			input:    "it's working\n",
-			expected: "'it\\'s working'\n",
+			name:     "zero-width characters",
+			args:     []string{"-strip-invisible", "-"},
+			input:    "\ufeffa\u200bb\u200cc\u200dd\u2060e\n",
+			expected: "\"abcde\"\n",
 		},
 		{
-			name:     "strip, skip empty, and escape",
-			args:     []string{"-s", "-e", "-escape", "-"},
-			input:    "  \"test\"  \n\n  data  \n",
-			expected: "\"\\\"test\\\"\"\n\"data\"\n",
+			name:     "directional marks",
+			args:     []string{"-strip-invisible", "-"},
+			input:    "\u200eleft\u200f \u202aembed\u202c \u2067iso\u2069\n",
+			expected: "\"left embed iso\"\n",
 		},
 		{
-			name:     "null-terminated with custom delimiter",
-			args:     []string{"-0", "-d", "|", "-"},
-			input:    "one\x00two\x00three\x00",
-			expected: "|one|\n|two|\n|three|\n",
+			name:     "invalid UTF-8 preserved",
+			args:     []string{"-strip-invisible", "-"},
+			input:    "a\xff\u200bb\n",
+			expected: "\"a\xffb\"\n",
 		},
 		{
-			name:     "all options combined",
-			args:     []string{"-s", "-e", "-escape", "-d", "'", "-"},
-			input:    "  it's  \n\n  'quoted'  \n",
-			expected: "'it\\'s'\n'\\'quoted\\''\n",
+			name:     "applied before strip",
+			args:     []string{"-strip-invisible", "-s", "-"},
+			input:    "\u200b  value  \u200b\n",
+			expected: "\"value\"\n",
+		},
+		{
+			name:     "invisible-only line counts as empty",
+			args:     []string{"-strip-invisible", "-e", "-"},
+			input:    "a\n\u200b\u200e\nb\n",
+			expected: "\"a\"\n\"b\"\n",
 		},
 	}
 
@@ -375,14 +388,21 @@ func TestCombinations(t *testing.T) {
 			}
 
 			if stdout != tt.expected {
-				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+				t.Errorf("Expected: %q, Got: %q", tt.expected, stdout)
 			}
 		})
 	}
 }
 
-// TestEdgeCases tests various edge cases
-func TestEdgeCases(t *testing.T) {
+// TestDeconfuse tests the -deconfuse and -deconfuse-map flags
+func TestDeconfuse(t *testing.T) {
+	tmpDir := t.TempDir()
+	mapFile := filepath.Join(tmpDir, "map.txt")
+	mapping := "# custom mappings\n\u00e9 e\n0x2122 TM\n\u00ae\n\u201c 0x60\nx @at\n"
+	if err := os.WriteFile(mapFile, []byte(mapping), 0644); err != nil {
+		t.Fatalf("Failed to create mapping file: %v", err)
+	}
+
 	tests := []struct {
 		name     string
 		args     []string
@@ -390,34 +410,34 @@ func TestEdgeCases(t *testing.T) {
 		expected string
 	}{
 		{
-			name:     "empty input",
-			args:     []string{"-"},
-			input:    "",
-			expected: "",
+			name:     "curly quotes",
+			args:     []string{"-deconfuse", "-d", "|", "-"},
+			input:    "\u201chello\u201d \u2018world\u2019\n",
+			expected: "|\"hello\" 'world'|\n",
 		},
 		{
-			name:     "single empty line",
-			args:     []string{"-"},
-			input:    "\n",
-			expected: "",
+			name:     "fullwidth forms",
+			args:     []string{"-deconfuse", "-"},
+			input:    "\uff21\uff22\uff23\uff11\uff12\uff13\uff01\n",
+			expected: "\"ABC123!\"\n",
 		},
 		{
-			name:     "only whitespace with strip",
-			args:     []string{"-s", "-"},
-			input:    "   \n",
-			expected: "",
+			name:     "special spaces and dashes",
+			args:     []string{"-deconfuse", "-"},
+			input:    "a\u00a0b\u3000c\u2013d\u2026\n",
+			expected: "\"a b c-d...\"\n",
 		},
 		{
-			name:     "very long line",
-			args:     []string{"-"},
-			input:    strings.Repeat("a", 10000) + "\n",
-			expected: "\"" + strings.Repeat("a", 10000) + "\"\n",
+			name:     "mapping file extends and overrides",
+			args:     []string{"-deconfuse", "-deconfuse-map", mapFile, "-d", "|", "-"},
+			input:    "caf\u00e9\u2122\u00ae \u201cq\u201d x\n",
+			expected: "|cafeTM `q\" @at|\n",
 		},
 		{
-			name:     "no trailing newline",
-			args:     []string{"-"},
-			input:    "hello",
-			expected: "\"hello\"\n",
+			name:     "unmapped text untouched",
+			args:     []string{"-deconfuse", "-"},
+			input:    "plain \u65e5\u672c\n",
+			expected: "\"plain \u65e5\u672c\"\n",
 		},
 	}
 
@@ -430,52 +450,5148 @@ func TestEdgeCases(t *testing.T) {
 			}
 
 			if stdout != tt.expected {
-				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+				t.Errorf("Expected: %q, Got: %q", tt.expected, stdout)
 			}
 		})
 	}
 }
 
-// TestVersion tests the -v flag
-func TestVersion(t *testing.T) {
-	cmd := exec.Command("./wrapline", "-v")
+// TestSkipEmptyLines tests the -e flag
+func TestSkipEmptyLines(t *testing.T) {
+	input := "hello\n\nworld\n\n"
+	expected := "\"hello\"\n\"world\"\n"
 
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
+	stdout, stderr, err := runWrapline(t, []string{"-e", "-"}, input)
 
-	err := cmd.Run()
 	if err != nil {
-		t.Fatalf("Expected no error, got: %v", err)
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
 	}
 
-	output := stdout.String()
-	if !strings.Contains(output, pgmName) {
-		t.Errorf("Expected version output to contain program name, got: %q", output)
-	}
-	if !strings.Contains(output, pgmVersion) {
-		t.Errorf("Expected version output to contain version, got: %q", output)
-	}
-	if !strings.Contains(output, pgmURL) {
-		t.Errorf("Expected version output to contain URL, got: %q", output)
+	if stdout != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
 	}
 }
 
-// TestErrorCases tests error conditions
-// Note: "no filename argument" is not tested here because in the test environment
-// (where stdin is not a terminal), the program correctly treats this as piped input
-// rather than an error condition. This matches the program's intended behavior.
-func TestErrorCases(t *testing.T) {
+// TestEmptyLastLine tests that empty last lines are always skipped
+func TestEmptyLastLine(t *testing.T) {
 	tests := []struct {
-		name        string
-		args        []string
-		input       string
-		expectError bool
+		name     string
+		input    string
+		expected string
 	}{
 		{
-			name:        "too many arguments",
-			args:        []string{"file1.txt", "file2.txt"},
-			input:       "",
-			expectError: true,
+			name:     "single line with trailing newline",
+			input:    "hello\n",
+			expected: "\"hello\"\n",
+		},
+		{
+			name:     "multiple lines with empty last",
+			input:    "hello\nworld\n\n",
+			expected: "\"hello\"\n\"world\"\n",
+		},
+		{
+			name:     "without -e flag, middle empty preserved",
+			input:    "hello\n\nworld\n",
+			expected: "\"hello\"\n\"\"\n\"world\"\n",
+		},
+		{
+			name:     "middle empty preserved before an unterminated last line",
+			input:    "hello\n\nworld",
+			expected: "\"hello\"\n\"\"\n\"world\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, []string{"-"}, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestEscapeDelimiter tests the -escape flag
+func TestEscapeDelimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "single delimiter in content",
+			input:    "She said \"hello\"\n",
+			expected: "\"She said \\\"hello\\\"\"\n",
+		},
+		{
+			name:     "multiple delimiters",
+			input:    "\"quoted\" and \"more\"\n",
+			expected: "\"\\\"quoted\\\" and \\\"more\\\"\"\n",
+		},
+		{
+			name:     "no delimiters",
+			input:    "plain text\n",
+			expected: "\"plain text\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, []string{"-escape", "-"}, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestOutputRecordTerminator tests the -ors, -no-final-newline, and -crlf flags
+func TestOutputRecordTerminator(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "semicolon and newline",
+			args:     []string{"-ors", ";\\n", "-"},
+			input:    "hello\nworld\n",
+			expected: "\"hello\";\n\"world\";\n",
+		},
+		{
+			name:     "CRLF",
+			args:     []string{"-ors", "\\r\\n", "-"},
+			input:    "a\nb\n",
+			expected: "\"a\"\r\n\"b\"\r\n",
+		},
+		{
+			name:     "hex escape sentinel",
+			args:     []string{"-none", "-ors", "\\x1e--", "-"},
+			input:    "a\nb\n",
+			expected: "a\x1e--b\x1e--",
+		},
+		{
+			name:     "no final newline",
+			args:     []string{"-ors", ",", "-no-final-newline", "-"},
+			input:    "a\nb\n",
+			expected: "\"a\",\"b\"",
+		},
+		{
+			name:     "no final newline with JSON",
+			args:     []string{"-json", "-no-final-newline", "-"},
+			input:    "a\n",
+			expected: "[\n  \"a\"\n]",
+		},
+		{
+			name:     "no final newline with footer",
+			args:     []string{"-ors", ";\\n", "-footer", "END", "-no-final-newline", "-"},
+			input:    "a\n",
+			expected: "\"a\";\nEND",
+		},
+		{
+			name:     "no final newline on empty input",
+			args:     []string{"-no-final-newline", "-"},
+			input:    "",
+			expected: "",
+		},
+		{
+			name:     "CRLF line endings",
+			args:     []string{"-crlf", "-header", "H", "-"},
+			input:    "a\nb\n",
+			expected: "H\r\n\"a\"\r\n\"b\"\r\n",
+		},
+		{
+			name:     "CRLF with JSON",
+			args:     []string{"-crlf", "-json", "-"},
+			input:    "a\n",
+			expected: "[\r\n  \"a\"\r\n]\r\n",
+		},
+		{
+			name:     "CRLF with CSV",
+			args:     []string{"-crlf", "-csv", "-0", "-"},
+			input:    "a\nb\x00",
+			expected: "\"a\r\nb\"\r\n",
+		},
+		{
+			name:     "CRLF with a CRLF terminator and no final newline",
+			args:     []string{"-crlf", "-ors", "\\r\\n", "-no-final-newline", "-"},
+			input:    "a\nb\n",
+			expected: "\"a\"\r\n\"b\"",
+		},
+		{
+			name:     "with record width",
+			args:     []string{"-ors", "\\0", "-record-width", "4", "-"},
+			input:    "a\nbc\n",
+			expected: "\"a\" \x00\"bc\"\x00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestNullTerminated tests the -0 flag
+func TestNullTerminated(t *testing.T) {
+	// Create input with null terminators
+	input := "hello\x00world\x00test\x00"
+	expected := "\"hello\"\n\"world\"\n\"test\"\n"
+
+	stdout, stderr, err := runWrapline(t, []string{"-0", "-"}, input)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	if stdout != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+	}
+}
+
+// TestStrict tests the -strict, -max-record, and -fail-empty flags
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		input       string
+		expected    string
+		expectError string
+	}{
+		{
+			name:     "clean input passes",
+			args:     []string{"-strict", "-"},
+			input:    "hello\nworld\n",
+			expected: "\"hello\"\n\"world\"\n",
+		},
+		{
+			name:        "delimiter collision",
+			args:        []string{"-strict", "-"},
+			input:       "ok\nsay \"hi\"\n",
+			expectError: "record 2 contains the delimiter",
+		},
+		{
+			name:     "collision allowed with escape",
+			args:     []string{"-strict", "-escape", "-"},
+			input:    "say \"hi\"\n",
+			expected: "\"say \\\"hi\\\"\"\n",
+		},
+		{
+			name:        "invalid UTF-8",
+			args:        []string{"-strict", "-"},
+			input:       "ok\n\xff\xfe\n",
+			expectError: "record 2 is not valid UTF-8",
+		},
+		{
+			name:        "empty output",
+			args:        []string{"-strict", "-"},
+			input:       "\n",
+			expectError: "no records were written",
+		},
+		{
+			name:        "ineffective flag",
+			args:        []string{"-strict", "-json", "-d", "'", "-"},
+			input:       "test\n",
+			expectError: "-d has no effect",
+		},
+		{
+			name:     "ineffective flag allowed without strict",
+			args:     []string{"-json", "-d", "'", "-"},
+			input:    "test\n",
+			expected: "[\n  \"test\"\n]\n",
+		},
+		{
+			name:        "max record",
+			args:        []string{"-max-record", "4", "-"},
+			input:       "abcd\nabcde\n",
+			expectError: "record 2 is 5 bytes, over the limit of 4 B",
+		},
+		{
+			name:        "fail empty",
+			args:        []string{"-fail-empty", "-e", "-"},
+			input:       "\n\n",
+			expectError: "no records were written",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if tt.expectError != "" {
+				if err == nil {
+					t.Fatalf("Expected error, got none. Stdout: %q", stdout)
+				}
+				if !strings.Contains(stderr, tt.expectError) {
+					t.Errorf("Expected stderr to contain %q, got: %s", tt.expectError, stderr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestParagraphMode tests the -paragraph and -paragraph-sep flags
+func TestParagraphMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "default separator",
+			args:     []string{"-paragraph", "-"},
+			input:    "first line\nsecond line\n\nthird line\n",
+			expected: "\"first line second line\"\n\"third line\"\n",
+		},
+		{
+			name:     "multiple blank lines between paragraphs",
+			args:     []string{"-paragraph", "-"},
+			input:    "\n\none\n\n\n  \ntwo\nthree\n\n",
+			expected: "\"one\"\n\"two three\"\n",
+		},
+		{
+			name:     "custom separator",
+			args:     []string{"-paragraph", "-paragraph-sep", "|", "-"},
+			input:    "a\nb\nc\n\nd\n",
+			expected: "\"a|b|c\"\n\"d\"\n",
+		},
+		{
+			name:     "hex newline separator",
+			args:     []string{"-paragraph", "-paragraph-sep", "0x0A", "-"},
+			input:    "a\nb\n",
+			expected: "\"a\nb\"\n",
+		},
+		{
+			name:     "at signs are literal",
+			args:     []string{"-paragraph", "-paragraph-sep", "@@", "-"},
+			input:    "a\nb\n",
+			expected: "\"a@@b\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestWrapWidth tests the -wrap-width and -wrap-words flags
+func TestWrapWidth(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "hard break",
+			args:     []string{"-wrap-width", "4", "-"},
+			input:    "abcdefghij\nxy\n",
+			expected: "\"abcd\"\n\"efgh\"\n\"ij\"\n\"xy\"\n",
+		},
+		{
+			name:     "exact width is not split",
+			args:     []string{"-wrap-width", "5", "-"},
+			input:    "hello\n",
+			expected: "\"hello\"\n",
+		},
+		{
+			name:     "multibyte characters",
+			args:     []string{"-wrap-width", "2", "-"},
+			input:    "äöüß\n",
+			expected: "\"äö\"\n\"üß\"\n",
+		},
+		{
+			name:     "word boundaries",
+			args:     []string{"-wrap-width", "10", "-wrap-words", "-"},
+			input:    "the quick brown fox jumps\n",
+			expected: "\"the quick\"\n\"brown fox\"\n\"jumps\"\n",
+		},
+		{
+			name:     "word longer than width",
+			args:     []string{"-wrap-width", "4", "-wrap-words", "-"},
+			input:    "abcdefgh ij\n",
+			expected: "\"abcd\"\n\"efgh\"\n\"ij\"\n",
+		},
+		{
+			name:     "empty lines preserved",
+			args:     []string{"-wrap-width", "3", "-"},
+			input:    "abcd\n\nef\n",
+			expected: "\"abc\"\n\"d\"\n\"\"\n\"ef\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestFlushIdle tests that -flush-idle writes buffered output while input is stalled
+func TestFlushIdle(t *testing.T) {
+	cmd := exec.Command("./wrapline", "-flush-idle", "50ms", "-")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("Failed to create stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Failed to create stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start wrapline: %v", err)
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	// Each line must appear while the input is still open
+	for _, word := range []string{"first", "second"} {
+		if _, err := io.WriteString(stdin, word+"\n"); err != nil {
+			t.Fatalf("Failed to write input: %v", err)
+		}
+		select {
+		case line := <-lines:
+			if expected := `"` + word + `"`; line != expected {
+				t.Errorf("Expected %q, got %q", expected, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %q to be flushed", word)
+		}
+	}
+}
+
+// TestFollowName tests that -follow-name keeps reading a file through
+// rotation and truncation
+func TestFollowName(t *testing.T) {
+	tmpDir := t.TempDir()
+	logFile := filepath.Join(tmpDir, "app.log")
+	if err := os.WriteFile(logFile, []byte("first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("./wrapline", "-follow-name", "-flush-idle", "50ms", logFile)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Failed to create stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start wrapline: %v", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	expect := func(word string) {
+		t.Helper()
+		select {
+		case line := <-lines:
+			if expected := `"` + word + `"`; line != expected {
+				t.Errorf("Expected %q, got %q", expected, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %q", word)
+		}
+	}
+	appendLine := func(line string) {
+		t.Helper()
+		f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(line + "\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect("first")
+	appendLine("appended")
+	expect("appended")
+
+	// Rotation: the file is renamed and a new one created under the name
+	if err := os.Rename(logFile, logFile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLine("rotated")
+	expect("rotated")
+
+	// Truncation in place, as with 'logrotate copytruncate'
+	if err := os.Truncate(logFile, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	appendLine("truncated")
+	expect("truncated")
+}
+
+// TestStdinTimeout tests that -stdin-timeout fails when STDIN stays silent
+func TestStdinTimeout(t *testing.T) {
+	stdout, stderr, err := runWrapline(t, []string{"-stdin-timeout", "5s", "-"}, "a\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+	if expected := "\"a\"\n"; stdout != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout)
+	}
+
+	// STDIN is left open but nothing is written to it
+	cmd := exec.Command("./wrapline", "-stdin-timeout", "100ms")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("Failed to create stdin pipe: %v", err)
+	}
+	defer stdin.Close()
+	var errOut bytes.Buffer
+	cmd.Stderr = &errOut
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start wrapline: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Expected an error when no input arrives, got none")
+		}
+		if !strings.Contains(errOut.String(), "no input arrived on STDIN within 100ms") {
+			t.Errorf("Expected a timeout error, got %q", errOut.String())
+		}
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("Timed out waiting for -stdin-timeout to stop wrapline")
+	}
+}
+
+// TestHead tests the head subcommand
+func TestHead(t *testing.T) {
+	input := "a\n\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "default count",
+			args:     []string{"head", "-e", "-"},
+			expected: "\"a\"\n\"b\"\n\"c\"\n\"d\"\n\"e\"\n\"f\"\n\"g\"\n\"h\"\n\"i\"\n\"j\"\n",
+		},
+		{
+			name:     "count after options",
+			args:     []string{"head", "-n", "3", "-none", "-e", "-"},
+			expected: "a\nb\nc\n",
+		},
+		{
+			name:     "attached count",
+			args:     []string{"head", "-n2", "-"},
+			expected: "\"a\"\n\"\"\n",
+		},
+		{
+			name:     "complete document",
+			args:     []string{"head", "-n=2", "-e", "-json", "-"},
+			expected: "[\n  \"a\",\n  \"b\"\n]\n",
+		},
+		{
+			name:     "more than input",
+			args:     []string{"head", "-n", "100", "-e", "-columns", "20", "-columns-sep", ",", "-none", "-"},
+			expected: "a,b,c,d,e,f,g,h,i,j,k,l\n",
+		},
+		{
+			name:     "head flag",
+			args:     []string{"-head", "3", "-e", "-"},
+			expected: "\"a\"\n\"b\"\n\"c\"\n",
+		},
+		{
+			name:     "head flag counts records written",
+			args:     []string{"-head", "2", "-skip", "2", "-none", "-"},
+			expected: "b\nc\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	// Reading stops once the records are written, even though input remains open
+	t.Run("stops reading", func(t *testing.T) {
+		cmd := exec.Command("./wrapline", "head", "-n", "2", "-")
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			t.Fatalf("Failed to create stdin pipe: %v", err)
+		}
+		defer stdin.Close()
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start wrapline: %v", err)
+		}
+		if _, err := io.WriteString(stdin, "a\nb\nc\n"); err != nil {
+			t.Fatalf("Failed to write input: %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			cmd.Process.Kill()
+			t.Fatal("Timed out waiting for head to stop reading")
+		}
+		if expected := "\"a\"\n\"b\"\n"; stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+}
+
+// TestTail tests writing only the last records with -tail
+func TestTail(t *testing.T) {
+	input := "a\n\nb\nc\nd\n"
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "last records",
+			args:     []string{"-tail", "2", "-"},
+			expected: "\"c\"\n\"d\"\n",
+		},
+		{
+			name:     "counted after -e",
+			args:     []string{"-tail", "3", "-e", "-"},
+			expected: "\"b\"\n\"c\"\n\"d\"\n",
+		},
+		{
+			name:     "more than input",
+			args:     []string{"-tail", "10", "-e", "-none", "-"},
+			expected: "a\nb\nc\nd\n",
+		},
+		{
+			name:     "numbers kept from the input",
+			args:     []string{"-tail", "2", "-template", "{{.Num}} {{.Line}}", "-"},
+			expected: "4 c\n5 d\n",
+		},
+		{
+			name:     "complete document",
+			args:     []string{"-tail", "1", "-json", "-"},
+			expected: "[\n  \"d\"\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	t.Run("stats", func(t *testing.T) {
+		_, stderr, err := runWrapline(t, []string{"-tail", "2", "-e", "-stats", "-"}, input)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		for _, want := range []string{"read:              5\n", "written:           2\n", "before -tail:    2\n"} {
+			if !strings.Contains(stderr, want) {
+				t.Errorf("Expected stats to contain %q, got:\n%s", want, stderr)
+			}
+		}
+	})
+}
+
+// TestSample tests writing a random subset of records with -sample and -sample-n
+func TestSample(t *testing.T) {
+	var input strings.Builder
+	for i := 1; i <= 100; i++ {
+		input.WriteString(strconv.Itoa(i) + "\n")
+	}
+
+	run := func(t *testing.T, args ...string) []string {
+		t.Helper()
+		stdout, stderr, err := runWrapline(t, append(append([]string{"-none"}, args...), "-"), input.String())
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		return strings.Fields(stdout)
+	}
+
+	t.Run("fraction", func(t *testing.T) {
+		first := run(t, "-sample", "0.5", "-seed", "7")
+		if len(first) < 20 || len(first) > 80 {
+			t.Errorf("Expected about 50 records, got %d", len(first))
+		}
+		if again := run(t, "-sample", "0.5", "-seed", "7"); !reflect.DeepEqual(first, again) {
+			t.Errorf("Expected the same seed to choose the same records, got %v and %v", first, again)
+		}
+		if all := run(t, "-sample", "1"); len(all) != 100 {
+			t.Errorf("Expected every record with -sample 1, got %d", len(all))
+		}
+	})
+
+	t.Run("reservoir", func(t *testing.T) {
+		first := run(t, "-sample-n", "5", "-seed", "7")
+		if len(first) != 5 {
+			t.Fatalf("Expected 5 records, got %v", first)
+		}
+		if !slices.IsSortedFunc(first, func(a, b string) int {
+			x, _ := strconv.Atoi(a)
+			y, _ := strconv.Atoi(b)
+			return x - y
+		}) {
+			t.Errorf("Expected records in input order, got %v", first)
+		}
+		if again := run(t, "-sample-n", "5", "-seed", "7"); !reflect.DeepEqual(first, again) {
+			t.Errorf("Expected the same seed to choose the same records, got %v and %v", first, again)
+		}
+		if all := run(t, "-sample-n", "200"); len(all) != 100 {
+			t.Errorf("Expected every record when the sample is larger than the input, got %d", len(all))
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		_, stderr, err := runWrapline(t, []string{"-sample-n", "10", "-stats", "-"}, input.String())
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		for _, want := range []string{"written:           10\n", "not sampled:     90\n"} {
+			if !strings.Contains(stderr, want) {
+				t.Errorf("Expected stats to contain %q, got:\n%s", want, stderr)
+			}
+		}
+	})
+}
+
+// TestConvert tests the convert subcommand between structured formats
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "CSV to JSON",
+			args:     []string{"convert", "-from", "csv", "-to", "json"},
+			input:    "\"a,b\"\n\"say \"\"hi\"\"\"\n",
+			expected: "[\n  \"a,b\",\n  \"say \\\"hi\\\"\"\n]\n",
+		},
+		{
+			name:     "JSON to CSV keeps an empty last element",
+			args:     []string{"convert", "-from=json", "-to=csv"},
+			input:    `["x\ny", ""]`,
+			expected: "\"x\ny\"\n\"\"\n",
+		},
+		{
+			name:     "TSV to wrapped",
+			args:     []string{"convert", "-from", "tsv", "-d", "'"},
+			input:    "a\\tb\nc\\\\d\n",
+			expected: "'a\tb'\n'c\\d'\n",
+		},
+		{
+			name:     "wrapped with escapes to SQL IN list",
+			args:     []string{"convert", "-to", "sql-in", "-from", "wrapped", "-escape"},
+			input:    "\"it's\"\n\"say \\\"hi\\\"\"\n",
+			expected: "('it''s','say \"hi\"')\n",
+		},
+		{
+			name:     "lines drop an empty last line",
+			args:     []string{"convert", "-from", "lines", "-to", "json"},
+			input:    "a\n\n",
+			expected: "[\n  \"a\"\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestPlugin tests the -plugin flag with a line-at-a-time shell script
+func TestPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin test requires a POSIX shell")
+	}
+
+	tmpDir := t.TempDir()
+	script := filepath.Join(tmpDir, "upper.sh")
+	body := "#!/bin/sh\nwhile IFS= read -r line; do printf '%s\\n' \"$line\" | tr a-z A-Z; done\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatalf("Failed to create plugin script: %v", err)
+	}
+
+	input := "hello\n\nworld\n"
+	expected := "\"HELLO\"\n\"\"\n\"WORLD\"\n"
+
+	stdout, stderr, err := runWrapline(t, []string{"-plugin", script, "-"}, input)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	if stdout != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+	}
+}
+
+// TestPluginTimeout tests that a plugin that does not flush its replies
+// fails after -plugin-timeout instead of hanging
+func TestPluginTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin test requires a POSIX shell")
+	}
+	if _, err := exec.LookPath("sed"); err != nil {
+		t.Skip("sed not found")
+	}
+
+	tmpDir := t.TempDir()
+	// sed buffers output written to a pipe unless given -u
+	buffered := filepath.Join(tmpDir, "buffered.sh")
+	flushed := filepath.Join(tmpDir, "flushed.sh")
+	scripts := map[string]string{
+		buffered: "#!/bin/sh\nexec sed s/o/0/\n",
+		flushed:  "#!/bin/sh\nexec sed -u s/o/0/\n",
+	}
+	for name, body := range scripts {
+		if err := os.WriteFile(name, []byte(body), 0755); err != nil {
+			t.Fatalf("Failed to create plugin script: %v", err)
+		}
+	}
+
+	t.Run("buffered replies", func(t *testing.T) {
+		_, stderr, err := runWrapline(t, []string{"-plugin", buffered, "-plugin-timeout", "200ms", "-"}, "hello\nworld\n")
+		if err == nil {
+			t.Fatal("Expected an error for a plugin that does not flush, got none")
+		}
+		if !strings.Contains(stderr, "no reply within 200ms") || !strings.Contains(stderr, "flush") {
+			t.Errorf("Expected a timeout error about flushing, got %q", stderr)
+		}
+	})
+
+	t.Run("flushed replies", func(t *testing.T) {
+		stdout, stderr, err := runWrapline(t, []string{"-plugin", flushed, "-plugin-timeout", "5s", "-"}, "hello\nworld\n")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		if expected := "\"hell0\"\n\"w0rld\"\n"; stdout != expected {
+			t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+		}
+	})
+}
+
+// TestPluginUnterminatedReply tests that a plugin whose last reply lacks a
+// newline is reported as such
+func TestPluginUnterminatedReply(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin test requires a POSIX shell")
+	}
+
+	script := filepath.Join(t.TempDir(), "unterminated.sh")
+	body := "#!/bin/sh\nIFS= read -r line\nprintf '%s' \"$line\"\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatalf("Failed to create plugin script: %v", err)
+	}
+
+	_, stderr, err := runWrapline(t, []string{"-plugin", script, "-"}, "hello\n")
+	if err == nil {
+		t.Fatal("Expected an error, got none")
+	}
+	if !strings.Contains(stderr, "not newline-terminated") {
+		t.Errorf("Expected an error about the unterminated reply, got %q", stderr)
+	}
+}
+
+// TestTruncate tests the -truncate and -ellipsis flags
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "plain truncation",
+			args:     []string{"-truncate", "5", "-"},
+			input:    "hello world\nhi\n",
+			expected: "\"hello\"\n\"hi\"\n",
+		},
+		{
+			name:     "with ellipsis",
+			args:     []string{"-truncate", "8", "-ellipsis", "...", "-"},
+			input:    "hello world\nshort\n",
+			expected: "\"hello...\"\n\"short\"\n",
+		},
+		{
+			name:     "wide characters",
+			args:     []string{"-truncate", "5", "-ellipsis", "…", "-"},
+			input:    "日本語のテキスト\n",
+			expected: "\"日本…\"\n",
+		},
+		{
+			name:     "combining marks are zero width",
+			args:     []string{"-truncate", "3", "-"},
+			input:    "e\u0301e\u0301e\u0301e\u0301\n",
+			expected: "\"e\u0301e\u0301e\u0301\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestRecordWidth tests the -record-width and -pad-char flags
+func TestRecordWidth(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		input       string
+		expected    string
+		expectError string
+	}{
+		{
+			name:     "space padding",
+			args:     []string{"-record-width", "8", "-"},
+			input:    "ab\nabcdef\n",
+			expected: "\"ab\"    \n\"abcdef\"\n",
+		},
+		{
+			name:     "custom pad character",
+			args:     []string{"-record-width", "6", "-pad-char", "0x2E", "-d", "|", "-"},
+			input:    "x\n",
+			expected: "|x|...\n",
+		},
+		{
+			name:     "tsv",
+			args:     []string{"-tsv", "-none", "-record-width", "5", "-pad-char", "#", "-"},
+			input:    "a\tb\n",
+			expected: "a\\tb#\n",
+		},
+		{
+			name:        "line too long",
+			args:        []string{"-record-width", "4", "-"},
+			input:       "ab\nabc\n",
+			expectError: "record 2 is 5 bytes when wrapped, longer than the record width 4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if tt.expectError != "" {
+				if err == nil {
+					t.Fatalf("Expected error, got none. Stdout: %q", stdout)
+				}
+				if !strings.Contains(stderr, tt.expectError) {
+					t.Errorf("Expected stderr to contain %q, got: %s", tt.expectError, stderr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestJSONOutput tests the -json flag
+func TestJSONOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "basic array",
+			args:     []string{"-json", "-"},
+			input:    "hello\nworld\n",
+			expected: "[\n  \"hello\",\n  \"world\"\n]\n",
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-json", "-"},
+			input:    "",
+			expected: "[]\n",
+		},
+		{
+			name:     "escaping",
+			args:     []string{"-json", "-"},
+			input:    "a\"b\\c\td\x01\n",
+			expected: "[\n  \"a\\\"b\\\\c\\td\\u0001\"\n]\n",
+		},
+		{
+			name:     "line separators escaped",
+			args:     []string{"-json", "-"},
+			input:    "a\u2028b\u2029c\n",
+			expected: "[\n  \"a\\u2028b\\u2029c\"\n]\n",
+		},
+		{
+			name:     "invalid UTF-8 replaced",
+			args:     []string{"-json", "-"},
+			input:    "a\xffb\n",
+			expected: "[\n  \"a\ufffdb\"\n]\n",
+		},
+		{
+			name:     "with strip and skip empty",
+			args:     []string{"-json", "-s", "-e", "-"},
+			input:    "  one  \n\n two\n",
+			expected: "[\n  \"one\",\n  \"two\"\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestFormat tests the -format flag, including json-string
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "json-string",
+			args:     []string{"-format", "json-string", "-"},
+			input:    "#!/bin/sh\necho \"hi\"\tthere\n",
+			expected: "\"#!/bin/sh\\necho \\\"hi\\\"\\tthere\\n\"\n",
+		},
+		{
+			name:     "json-string with null terminators",
+			args:     []string{"-format", "json-string", "-0", "-"},
+			input:    "a\x00b\x00",
+			expected: "\"a\\u0000b\\u0000\"\n",
+		},
+		{
+			name:     "json-string empty input",
+			args:     []string{"-format", "json-string", "-"},
+			input:    "",
+			expected: "\"\"\n",
+		},
+		{
+			name:     "heredoc",
+			args:     []string{"-format", "heredoc", "-"},
+			input:    "echo $HOME\n",
+			expected: "cat <<'EOF'\necho $HOME\nEOF\n",
+		},
+		{
+			name:     "heredoc avoids tag in input",
+			args:     []string{"-format", "heredoc", "-heredoc-cmd", "cat > out.txt", "-"},
+			input:    "EOF\nEOF_1\n",
+			expected: "cat > out.txt <<'EOF_2'\nEOF\nEOF_1\nEOF_2\n",
+		},
+		{
+			name:     "heredoc with tag",
+			args:     []string{"-format", "heredoc", "-tag", "CONFIG", "-"},
+			input:    "EOF\n",
+			expected: "cat <<'CONFIG'\nEOF\nCONFIG\n",
+		},
+		{
+			name:     "json alias",
+			args:     []string{"-format", "json", "-"},
+			input:    "a\n",
+			expected: "[\n  \"a\"\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestJSONStringRoundTrip tests that -format json-string decodes back to the input
+func TestJSONStringRoundTrip(t *testing.T) {
+	input := "line one\n  indented \\ \"quoted\"\n\u2028 and \x01\n"
+
+	stdout, stderr, err := runWrapline(t, []string{"-format", "json-string", "-"}, input)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	var decoded string
+	if err := json.Unmarshal([]byte(stdout), &decoded); err != nil {
+		t.Fatalf("Output is not a valid JSON string: %v\n%s", err, stdout)
+	}
+	if decoded != input {
+		t.Errorf("Round trip mismatch:\nExpected: %q\nGot:      %q", input, decoded)
+	}
+}
+
+// TestHeredocRoundTrip tests that a shell reproduces the input from -format heredoc
+func TestHeredocRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	input := "#!/bin/sh\necho \"$USER\" `date` \\\n\tEOF\nEOF\n'single' $(whoami)\n"
+
+	stdout, stderr, err := runWrapline(t, []string{"-format", "heredoc", "-"}, input)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	out, err := exec.Command("sh", "-c", stdout).Output()
+	if err != nil {
+		t.Fatalf("Generated heredoc failed to run: %v\n%s", err, stdout)
+	}
+	if string(out) != input {
+		t.Errorf("Round trip mismatch:\nExpected: %q\nGot:      %q", input, string(out))
+	}
+}
+
+// TestJSONRoundTrip tests that -json output decodes back to the input lines
+func TestJSONRoundTrip(t *testing.T) {
+	lines := []string{"plain", "quote \" and backslash \\", "tab\there", "\x00\x1f\x7f", "日本語 🎉", "</script>", ""}
+	input := strings.Join(lines, "\n") + "\nlast\n"
+
+	stdout, stderr, err := runWrapline(t, []string{"-json", "-"}, input)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	var got []string
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\nOutput: %s", err, stdout)
+	}
+
+	expected := append(lines, "last")
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected: %q, Got: %q", expected, got)
+	}
+}
+
+// TestJSOutput tests the -js, -js-quote, and -js-trailing-comma flags
+func TestJSOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "double quotes",
+			args:     []string{"-js", "-"},
+			input:    "a\nit's \"b\"\n",
+			expected: "[\n  \"a\",\n  \"it's \\\"b\\\"\"\n]\n",
+		},
+		{
+			name:     "single quotes",
+			args:     []string{"-js", "-js-quote", "single", "-"},
+			input:    "a\nit's \"b\"\n",
+			expected: "[\n  'a',\n  'it\\'s \"b\"'\n]\n",
+		},
+		{
+			name:     "trailing comma",
+			args:     []string{"-js", "-js-trailing-comma", "-"},
+			input:    "a\nb\n",
+			expected: "[\n  \"a\",\n  \"b\",\n]\n",
+		},
+		{
+			name:     "empty input with trailing comma",
+			args:     []string{"-js", "-js-trailing-comma", "-"},
+			input:    "",
+			expected: "[]\n",
+		},
+		{
+			name:     "line separator escaped",
+			args:     []string{"-format", "js", "-js-quote", "single", "-"},
+			input:    "a\u2028b\n",
+			expected: "[\n  'a\\u2028b'\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestIncludeExcludeFiles tests the -include-file and -exclude-file flags
+func TestIncludeExcludeFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	includeFile := filepath.Join(tmpDir, "include.txt")
+	excludeFile := filepath.Join(tmpDir, "exclude.txt")
+	if err := os.WriteFile(includeFile, []byte("apple\r\ncherry\n\nre:^b.*y$\n"), 0644); err != nil {
+		t.Fatalf("Failed to create include file: %v", err)
+	}
+	if err := os.WriteFile(excludeFile, []byte("cherry\nre:rr\n"), 0644); err != nil {
+		t.Fatalf("Failed to create exclude file: %v", err)
+	}
+
+	input := "apple\nbanana\ncherry\nberry\nblueberry\nbusy\n"
+
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "include",
+			args:     []string{"-include-file", includeFile, "-"},
+			input:    input,
+			expected: "\"apple\"\n\"cherry\"\n\"berry\"\n\"blueberry\"\n\"busy\"\n",
+		},
+		{
+			name:     "exclude",
+			args:     []string{"-exclude-file", excludeFile, "-"},
+			input:    input,
+			expected: "\"apple\"\n\"banana\"\n\"busy\"\n",
+		},
+		{
+			name:     "include and exclude",
+			args:     []string{"-include-file", includeFile, "-exclude-file", excludeFile, "-"},
+			input:    input,
+			expected: "\"apple\"\n\"busy\"\n",
+		},
+		{
+			name:     "matching after strip",
+			args:     []string{"-s", "-include-file", includeFile, "-"},
+			input:    "  apple  \nkiwi\n",
+			expected: "\"apple\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestSubstitution tests editing lines with -sub
+func TestSubstitution(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "first match",
+			args:     []string{"-sub", "s/o/0/", "-"},
+			input:    "foo\n",
+			expected: "\"f0o\"\n",
+		},
+		{
+			name:     "every match",
+			args:     []string{"-sub", "s/o/0/g", "-"},
+			input:    "foo\n",
+			expected: "\"f00\"\n",
+		},
+		{
+			name:     "capture groups",
+			args:     []string{"-sub", `s/(\w+)=(\w+)/\2:\1/g`, "-"},
+			input:    "a=1 b=2\n",
+			expected: "\"1:a 2:b\"\n",
+		},
+		{
+			name:     "whole match and literal dollar",
+			args:     []string{"-sub", `s/\d+/$& (&)/`, "-"},
+			input:    "cost 5\n",
+			expected: "\"cost $5 (5)\"\n",
+		},
+		{
+			name:     "other separator",
+			args:     []string{"-sub", `s|/usr/local|\||`, "-"},
+			input:    "/usr/local/bin\n",
+			expected: "\"|/bin\"\n",
+		},
+		{
+			name:     "escaped separator",
+			args:     []string{"-sub", `s/\//-/g`, "-"},
+			input:    "a/b/c\n",
+			expected: "\"a-b-c\"\n",
+		},
+		{
+			name:     "ignore case",
+			args:     []string{"-sub", "s/error/E/gi", "-"},
+			input:    "Error ERROR\n",
+			expected: "\"E E\"\n",
+		},
+		{
+			name:     "filters see the edited line",
+			args:     []string{"-sub", "s/^#.*//", "-e", "-"},
+			input:    "# comment\nvalue\n",
+			expected: "\"value\"\n",
+		},
+		{
+			name:     "repeated substitutions in order",
+			args:     []string{"-sub", "s/a/b/g", "-sub", "s/b/c/g", "-"},
+			input:    "ab\n",
+			expected: "\"cc\"\n",
+		},
+		{
+			name:     "substitution before -s",
+			args:     []string{"-sub", "s/x/ /g", "-s", "-"},
+			input:    "xvaluex\n",
+			expected: "\"value\"\n",
+		},
+		{
+			name:     "-s before substitution",
+			args:     []string{"-s", "-sub", "s/x/ /g", "-"},
+			input:    "xvaluex\n",
+			expected: "\" value \"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestStripOneSide tests stripping leading or trailing whitespace with -sl and -sr
+func TestStripOneSide(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "leading",
+			args:     []string{"-sl", "-"},
+			input:    " \t a b \t\n",
+			expected: "\"a b \t\"\n",
+		},
+		{
+			name:     "trailing",
+			args:     []string{"-sr", "-"},
+			input:    "  a b \t\n",
+			expected: "\"  a b\"\n",
+		},
+		{
+			name:     "unicode spaces",
+			args:     []string{"-sr", "-"},
+			input:    "a\u00a0\u3000\n",
+			expected: "\"a\"\n",
+		},
+		{
+			name:     "both",
+			args:     []string{"-sl", "-sr", "-"},
+			input:    "  a  \n",
+			expected: "\"a\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestSqueeze tests collapsing internal whitespace with -squeeze
+func TestSqueeze(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "runs of spaces and tabs",
+			args:     []string{"-squeeze", "-"},
+			input:    "eth0    up\t\t 1500\n",
+			expected: "\"eth0 up 1500\"\n",
+		},
+		{
+			name:     "ends are kept",
+			args:     []string{"-squeeze", "-"},
+			input:    "  a   b  \n",
+			expected: "\"  a b  \"\n",
+		},
+		{
+			name:     "with -s",
+			args:     []string{"-s", "-squeeze", "-"},
+			input:    "  a   b  \n",
+			expected: "\"a b\"\n",
+		},
+		{
+			name:     "only whitespace",
+			args:     []string{"-squeeze", "-"},
+			input:    "   \n",
+			expected: "\"   \"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestTrimChars tests trimming a set of characters with -trim-chars
+func TestTrimChars(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "both ends",
+			args:     []string{"-trim-chars", `"[],`, "-"},
+			input:    "\"alpha\",\n[beta]\n",
+			expected: "\"alpha\"\n\"beta\"\n",
+		},
+		{
+			name:     "inner characters are kept",
+			args:     []string{"-trim-chars", "-", "-"},
+			input:    "--a-b--\n",
+			expected: "\"a-b\"\n",
+		},
+		{
+			name:     "multibyte characters",
+			args:     []string{"-trim-chars", "«»", "-"},
+			input:    "«quoted»\n",
+			expected: "\"quoted\"\n",
+		},
+		{
+			name:     "whitespace is kept without -s",
+			args:     []string{"-trim-chars", ",", "-"},
+			input:    " a, \n",
+			expected: "\" a, \"\n",
+		},
+		{
+			name:     "after -s",
+			args:     []string{"-s", "-trim-chars", ",", "-"},
+			input:    " a, \n",
+			expected: "\"a\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestChangeCase tests -upper, -lower, and -title
+func TestChangeCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "upper",
+			args:     []string{"-upper", "-"},
+			input:    "straße café\n",
+			expected: "\"STRASSE CAFÉ\"\n",
+		},
+		{
+			name:     "lower",
+			args:     []string{"-lower", "-"},
+			input:    "ΟΔΟΣ Mixed\n",
+			expected: "\"οδος mixed\"\n",
+		},
+		{
+			name:     "title",
+			args:     []string{"-title", "-"},
+			input:    "hELLO wide-world don't 'quoted'\n",
+			expected: "\"Hello Wide-World Don't 'Quoted'\"\n",
+		},
+		{
+			name:     "invalid UTF-8 is kept",
+			args:     []string{"-upper", "-"},
+			input:    "a\xffb\n",
+			expected: "\"A\xffB\"\n",
+		},
+		{
+			name:     "applied in order with -sub",
+			args:     []string{"-sub", "s/x/y/", "-upper", "-sub", "s/X/z/", "-"},
+			input:    "xx\n",
+			expected: "\"Yz\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestGrep tests keeping and dropping matching lines with -grep and -grep-v
+func TestGrep(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "matching lines",
+			args:     []string{"-grep", "^err", "-"},
+			input:    "error one\ninfo\nerror two\n",
+			expected: "\"error one\"\n\"error two\"\n",
+		},
+		{
+			name:     "line numbers from the input",
+			args:     []string{"-grep", "ERROR", "-template", "{{.Num}}: {{.Line}}", "-"},
+			input:    "ok\nERROR a\nok\nERROR b\n",
+			expected: "2: ERROR a\n4: ERROR b\n",
+		},
+		{
+			name:     "case-insensitive flag",
+			args:     []string{"-grep", "(?i)warn", "-none", "-"},
+			input:    "WARN x\ninfo\nwarning y\n",
+			expected: "WARN x\nwarning y\n",
+		},
+		{
+			name:     "matched after strip",
+			args:     []string{"-s", "-grep", "^a$", "-"},
+			input:    "  a  \nab\n",
+			expected: "\"a\"\n",
+		},
+		{
+			name:     "dropping matching lines",
+			args:     []string{"-grep-v", "DEBUG|^#", "-"},
+			input:    "# comment\nstart\nDEBUG x\nend\n",
+			expected: "\"start\"\n\"end\"\n",
+		},
+		{
+			name:     "grep and grep-v together",
+			args:     []string{"-grep", "error", "-grep-v", "retry", "-none", "-"},
+			input:    "error a\nerror, retry\ninfo\nerror b\n",
+			expected: "error a\nerror b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestTOMLOutput tests the -toml flag
+func TestTOMLOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "bare key",
+			args:     []string{"-toml", "hosts", "-"},
+			input:    "web-01\nweb-02\n",
+			expected: "hosts = [\n  \"web-01\",\n  \"web-02\",\n]\n",
+		},
+		{
+			name:     "quoted key",
+			args:     []string{"-toml", "allowed hosts", "-"},
+			input:    "a\n",
+			expected: "\"allowed hosts\" = [\n  \"a\",\n]\n",
+		},
+		{
+			name:     "escaping",
+			args:     []string{"-toml", "k", "-"},
+			input:    "C:\\path \"x\"\ttab\n",
+			expected: "k = [\n  \"C:\\\\path \\\"x\\\"\\ttab\",\n]\n",
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-toml", "k", "-"},
+			input:    "",
+			expected: "k = []\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestSQLIn tests the -sql-in and -sql-in-chunk flags
+func TestSQLIn(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "single list",
+			args:     []string{"-sql-in", "-"},
+			input:    "a\nb\nc\n",
+			expected: "('a','b','c')\n",
+		},
+		{
+			name:     "quote doubling",
+			args:     []string{"-sql-in", "-"},
+			input:    "O'Brien\nrock 'n' roll\n",
+			expected: "('O''Brien','rock ''n'' roll')\n",
+		},
+		{
+			name:     "chunked",
+			args:     []string{"-sql-in", "-sql-in-chunk", "2", "-"},
+			input:    "1\n2\n3\n4\n5\n",
+			expected: "('1','2')\n('3','4')\n('5')\n",
+		},
+		{
+			name:     "chunk divides evenly",
+			args:     []string{"-sql-in", "-sql-in-chunk", "2", "-"},
+			input:    "1\n2\n",
+			expected: "('1','2')\n",
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-sql-in", "-"},
+			input:    "",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestSQLInsert tests the -sql-insert, -column, and -sql-insert-batch flags
+func TestSQLInsert(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "one statement per line",
+			args:     []string{"-sql-insert", "-"},
+			input:    "a\nb\n",
+			expected: "INSERT INTO lines (line) VALUES ('a');\nINSERT INTO lines (line) VALUES ('b');\n",
+		},
+		{
+			name:     "table and column",
+			args:     []string{"-sql-insert", "-table", "app.users", "-column", "name", "-"},
+			input:    "O'Brien\n",
+			expected: "INSERT INTO app.users (name) VALUES ('O''Brien');\n",
+		},
+		{
+			name:     "batched",
+			args:     []string{"-sql-insert", "-sql-insert-batch", "2", "-"},
+			input:    "1\n2\n3\n",
+			expected: "INSERT INTO lines (line) VALUES ('1'), ('2');\nINSERT INTO lines (line) VALUES ('3');\n",
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-sql-insert", "-"},
+			input:    "",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestSQLDialect tests the -sql-dialect flag and NUL handling in SQL output
+func TestSQLDialect(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		input       string
+		expected    string
+		expectError string
+	}{
+		{
+			name:     "standard keeps backslashes",
+			args:     []string{"-sql-in", "-"},
+			input:    "c\\\nit's\n",
+			expected: "('c\\','it''s')\n",
+		},
+		{
+			name:     "mysql doubles backslashes",
+			args:     []string{"-sql-in", "-sql-dialect", "mysql", "-"},
+			input:    "c\\\nit's\n",
+			expected: "('c\\\\','it''s')\n",
+		},
+		{
+			name:     "mysql insert",
+			args:     []string{"-sql-insert", "-sql-dialect", "mysql", "-"},
+			input:    "c\\\n",
+			expected: "INSERT INTO lines (line) VALUES ('c\\\\');\n",
+		},
+		{
+			name:        "unknown dialect",
+			args:        []string{"-sql-in", "-sql-dialect", "oracle", "-"},
+			input:       "a\n",
+			expectError: "invalid -sql-dialect 'oracle'",
+		},
+		{
+			name:        "NUL in -sql-in",
+			args:        []string{"-sql-in", "-"},
+			input:       "a\nb\x00c\n",
+			expectError: "record 2 contains a NUL byte",
+		},
+		{
+			name:        "NUL in -sql-insert",
+			args:        []string{"-sql-insert", "-"},
+			input:       "b\x00c\n",
+			expectError: "record 1 contains a NUL byte",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if tt.expectError != "" {
+				if err == nil {
+					t.Fatalf("Expected error, got none. Stdout: %q", stdout)
+				}
+				if !strings.Contains(stderr, tt.expectError) {
+					t.Errorf("Expected stderr to contain %q, got: %s", tt.expectError, stderr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestCSVOutput tests the -csv and -csv-crlf flags
+func TestCSVOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "quoting only when needed",
+			args:     []string{"-csv", "-"},
+			input:    "plain\nhas,comma\nsay \"hi\"\n",
+			expected: "plain\n\"has,comma\"\n\"say \"\"hi\"\"\"\n",
+		},
+		{
+			name:     "empty field is quoted",
+			args:     []string{"-csv", "-"},
+			input:    "a\n\nb\n",
+			expected: "a\n\"\"\nb\n",
+		},
+		{
+			name:     "carriage return is quoted",
+			args:     []string{"-csv", "-"},
+			input:    "a\r\n",
+			expected: "\"a\r\"\n",
+		},
+		{
+			name:     "CRLF terminators",
+			args:     []string{"-csv", "-csv-crlf", "-"},
+			input:    "a\n\nb c\n",
+			expected: "a\r\n\"\"\r\nb c\r\n",
+		},
+		{
+			name:     "delimiter flags ignored",
+			args:     []string{"-csv", "-d", "'", "-escape", "-"},
+			input:    "it's\n",
+			expected: "it's\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestMDTable tests the -md-table and -md-num flags
+func TestMDTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "single column",
+			args:     []string{"-md-table", "-"},
+			input:    "alpha\nbeta\n",
+			expected: "| line |\n| --- |\n| alpha |\n| beta |\n",
+		},
+		{
+			name:     "line numbers",
+			args:     []string{"-md-table", "-md-num", "-e", "-"},
+			input:    "alpha\n\nbeta\n",
+			expected: "| # | line |\n| --: | --- |\n| 1 | alpha |\n| 3 | beta |\n",
+		},
+		{
+			name:     "escaping",
+			args:     []string{"-format", "md-table", "-0", "-"},
+			input:    "a|b\\c\x00two\r\nlines\x00",
+			expected: "| line |\n| --- |\n| a\\|b\\\\c |\n| two<br>lines |\n",
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-md-table", "-"},
+			input:    "",
+			expected: "| line |\n| --- |\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestHTMLList tests the -html-list flag
+func TestHTMLList(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "items",
+			args:     []string{"-html-list", "-"},
+			input:    "alpha\nbeta\n",
+			expected: "<ul>\n  <li>alpha</li>\n  <li>beta</li>\n</ul>\n",
+		},
+		{
+			name:     "entity escaping",
+			args:     []string{"-format", "html-list", "-"},
+			input:    "<script>alert('x & \"y\"')</script>\n",
+			expected: "<ul>\n  <li>&lt;script&gt;alert(&#39;x &amp; &#34;y&#34;&#39;)&lt;/script&gt;</li>\n</ul>\n",
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-html-list", "-"},
+			input:    "",
+			expected: "<ul>\n</ul>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestXMLOutput tests the -xml and -xml-attrs flags
+func TestXMLOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "a&b.txt")
+	if err := os.WriteFile(inputFile, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "elements",
+			args:     []string{"-xml", "item", "-"},
+			input:    "alpha\nbeta\n",
+			expected: "<item>alpha</item>\n<item>beta</item>\n",
+		},
+		{
+			name:     "entity escaping",
+			args:     []string{"-xml", "item", "-"},
+			input:    "<a href='x'>\"Q&A\"</a>\n",
+			expected: "<item>&lt;a href=&#39;x&#39;&gt;&#34;Q&amp;A&#34;&lt;/a&gt;</item>\n",
+		},
+		{
+			name:     "whitespace and UTF-8",
+			args:     []string{"-xml", "item", "-"},
+			input:    "a\tb\r\ncaf\u00e9\n",
+			expected: "<item>a&#x9;b&#xD;</item>\n<item>caf\u00e9</item>\n",
+		},
+		{
+			name:     "line number attribute",
+			args:     []string{"-xml", "ns:item", "-xml-attrs", "n", "-e", "-"},
+			input:    "alpha\n\nbeta\n",
+			expected: "<ns:item n=\"1\">alpha</ns:item>\n<ns:item n=\"3\">beta</ns:item>\n",
+		},
+		{
+			name:     "source filename attribute",
+			args:     []string{"-xml", "item", "-xml-attrs", "file,n", inputFile},
+			input:    "",
+			expected: "<item file=\"" + strings.ReplaceAll(inputFile, "&", "&amp;") + "\" n=\"1\">one</item>\n<item file=\"" + strings.ReplaceAll(inputFile, "&", "&amp;") + "\" n=\"2\">two</item>\n",
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-xml", "item", "-"},
+			input:    "",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestInputRecordSeparator tests the -irs flag
+func TestInputRecordSeparator(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "single byte",
+			args:     []string{"-irs", ";", "-"},
+			input:    "a;b;c",
+			expected: "\"a\"\n\"b\"\n\"c\"\n",
+		},
+		{
+			name:     "CRLF",
+			args:     []string{"-irs", "\\r\\n", "-"},
+			input:    "one\r\ntwo\nstill two\r\n",
+			expected: "\"one\"\n\"two\nstill two\"\n",
+		},
+		{
+			name:     "closing tag with a partial match inside a record",
+			args:     []string{"-irs", "</r>", "-"},
+			input:    "<r>x</y></r><r>y</r></r>",
+			expected: "\"<r>x</y>\"\n\"<r>y\"\n",
+		},
+		{
+			name:     "separator split across reads",
+			args:     []string{"-irs=--", "-"},
+			input:    strings.Repeat("x", 5000) + "-" + strings.Repeat("x", 5000) + "--y--",
+			expected: "\"" + strings.Repeat("x", 5000) + "-" + strings.Repeat("x", 5000) + "\"\n\"y\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestCSVInput tests wrapping one column of CSV input with -csv-in
+func TestCSVInput(t *testing.T) {
+	input := "id,name,note\n1,\"Smith, J\",\"multi\nline\"\n2,  Lee  ,\n3,,x\n"
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "quoted fields preserved, empty last value kept",
+			args:     []string{"-csv-in", "-col", "2", "-d", "'", "-"},
+			expected: "id,'name',note\n1,\"'Smith, J'\",\"multi\nline\"\n2,'  Lee  ',\n3,'',x\n",
+		},
+		{
+			name:     "transforms and filters on the column",
+			args:     []string{"-csv-in", "-col", "2", "-s", "-e", "-"},
+			expected: "id,\"\"\"name\"\"\",note\n1,\"\"\"Smith, J\"\"\",\"multi\nline\"\n2,\"\"\"Lee\"\"\",\n",
+		},
+		{
+			name:     "CRLF rows",
+			args:     []string{"-csv-in", "-col", "3", "-d", "|", "-crlf", "-"},
+			expected: "id,name,|note|\r\n1,\"Smith, J\",\"|multi\r\nline|\"\r\n2,\"  Lee  \",||\r\n3,,|x|\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	// A row without the column is an error
+	if _, _, err := runWrapline(t, []string{"-csv-in", "-col", "4", "-"}, input); err == nil {
+		t.Error("Expected an error for rows with too few fields")
+	}
+}
+
+// TestInputEncoding tests converting input to UTF-8 with -encoding
+func TestInputEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "UTF-16LE with a surrogate pair",
+			args:     []string{"-encoding", "utf-16le", "-"},
+			input:    "h\x00\xe9\x00\n\x00\x3d\xd8\x00\xde\n\x00",
+			expected: "\"hé\"\n\"😀\"\n",
+		},
+		{
+			name:     "UTF-16BE",
+			args:     []string{"-encoding", "utf-16be", "-"},
+			input:    "\x00h\x00i\x00\n",
+			expected: "\"hi\"\n",
+		},
+		{
+			name:     "UTF-16 with a big-endian byte order mark",
+			args:     []string{"-encoding", "utf-16", "-"},
+			input:    "\xfe\xff\x00h\x00i\x00\n",
+			expected: "\"hi\"\n",
+		},
+		{
+			name:     "UTF-16 with a little-endian byte order mark and CRLF",
+			args:     []string{"-encoding", "UTF-16", "-irs", "auto", "-"},
+			input:    "\xff\xfeh\x00\r\x00\n\x00i\x00\r\x00\n\x00",
+			expected: "\"h\"\n\"i\"\n",
+		},
+		{
+			name:     "unpaired surrogate and odd trailing byte",
+			args:     []string{"-encoding", "utf-16le", "-"},
+			input:    "\x3d\xd8a\x00\n\x00b",
+			expected: "\"\ufffda\"\n\"\ufffd\"\n",
+		},
+		{
+			name:     "Latin-1",
+			args:     []string{"-encoding", "latin-1", "-"},
+			input:    "caf\xe9\n",
+			expected: "\"café\"\n",
+		},
+		{
+			name:     "UTF-16LE byte order mark removed",
+			args:     []string{"-encoding", "utf-16le", "-"},
+			input:    "\xff\xfeh\x00i\x00\n\x00",
+			expected: "\"hi\"\n",
+		},
+		{
+			name:     "Shift-JIS",
+			args:     []string{"-encoding", "shift-jis", "-"},
+			input:    "\x93\xfa\x96\x7b\x8c\xea\n\xb1\xb2\n",
+			expected: "\"日本語\"\n\"ｱｲ\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestJSONLInput tests extracting values from JSON Lines input with -jsonl-in
+func TestJSONLInput(t *testing.T) {
+	input := `{"user":{"email":"a@x.com","id":12345678901234567890},"tags":["t1",{"b":1,"a":true}]}` + "\n\n" +
+		`{"user":{"email":null}}` + "\n" +
+		`{"user":"flat"}` + "\n"
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "nested key",
+			args:     []string{"-jsonl-in", "-path", ".user.email", "-"},
+			expected: "\"a@x.com\"\n\"\"\n\"\"\n",
+		},
+		{
+			name:     "missing values dropped with -e",
+			args:     []string{"-jsonl-in", "-path", ".user.email", "-e", "-"},
+			expected: "\"a@x.com\"\n",
+		},
+		{
+			name:     "large number kept as written",
+			args:     []string{"-jsonl-in", "-path", "$.user.id", "-e", "-"},
+			expected: "\"12345678901234567890\"\n",
+		},
+		{
+			name:     "array index and object value",
+			args:     []string{"-jsonl-in", "-path", ".tags[1]", "-e", "-d", "'", "-"},
+			expected: "'{\"a\":true,\"b\":1}'\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	// Invalid JSON is reported with its line number
+	_, stderr, err := runWrapline(t, []string{"-jsonl-in", "-path", ".a", "-"}, "{\"a\":1}\n{oops}\n")
+	if err == nil || !strings.Contains(stderr, "line 2") {
+		t.Errorf("Expected an error naming line 2, got %v: %s", err, stderr)
+	}
+}
+
+// TestTSVInput tests wrapping one column of TSV input with -tsv-in
+func TestTSVInput(t *testing.T) {
+	input := "1\tSmith, J\t\"admin\"\n2\t  Lee  \tuser\n3\t\t\n"
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "middle column",
+			args:     []string{"-tsv-in", "-col", "2", "-"},
+			expected: "1\t\"Smith, J\"\t\"admin\"\n2\t\"  Lee  \"\tuser\n3\t\"\"\t\n",
+		},
+		{
+			name:     "last column with CRLF, empty values dropped",
+			args:     []string{"-tsv-in", "-col", "3", "-d", "'", "-e", "-crlf", "-"},
+			expected: "1\tSmith, J\t'\"admin\"'\r\n2\t  Lee  \t'user'\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	// A row without the column is an error
+	if _, _, err := runWrapline(t, []string{"-tsv-in", "-col", "4", "-"}, input); err == nil {
+		t.Error("Expected an error for rows with too few fields")
+	}
+}
+
+// TestRegexReaderResume tests that regexReader finds the same records when
+// the input arrives a byte at a time, continuing each search where it left off,
+// as when it is read at once
+func TestRegexReaderResume(t *testing.T) {
+	long := strings.Repeat("x", 50000)
+	trace := strings.Repeat("  at main.go:10\n", 3000)
+	tests := []struct {
+		name    string
+		pattern string
+		input   string
+	}{
+		{name: "unbounded", pattern: `\n{2,}`, input: "a\nb\n\n\n" + long + "\n\n\nc\n\n"},
+		{name: "bounded", pattern: `\r?\n`, input: "a\r\n" + long + "\nc"},
+		{name: "any character", pattern: `.{3}`, input: "abcdefg"},
+		{name: "multi-line start", pattern: `(?m)^(\d{4}-\d\d-\d\d )`, input: "2024-01-01 start\n2024-01-02 error\n" + trace + "2024-01-03 done\n"},
+		{name: "kept prefix", pattern: `\n(\d{4}-\d\d-\d\d )|\n\z`, input: "2024-01-01 a\n" + trace + "2024-01-02 b\n"},
+		{name: "start of input", pattern: `^-+|;`, input: "--a;-b;c"},
+		{name: "word boundary", pattern: `\bEND\b`, input: "xEND END " + strings.Repeat("ab ", 15000) + "END yENDz END w"},
+		{name: "folded case", pattern: `(?i)kelvin`, input: "1\u212Aelvin" + long + "KELVIN3"},
+		{name: "multi-byte separator", pattern: `é`, input: "aébé" + long + "éc"},
+		{name: "invalid UTF-8", pattern: `[^a-z]+`, input: "ab\xffcd\xc3" + long + "\xe2\x82ef"},
+	}
+
+	split := func(r io.Reader, pattern string) []string {
+		rr := newRegexReader(r, regexp.MustCompile(pattern))
+		var records []string
+		for {
+			record, err := rr.Next()
+			if err == io.EOF {
+				return records
+			}
+			if err != nil {
+				t.Fatalf("Next failed: %v", err)
+			}
+			records = append(records, string(record))
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := split(strings.NewReader(tt.input), tt.pattern)
+			got := split(iotest.OneByteReader(strings.NewReader(tt.input)), tt.pattern)
+			if !slices.Equal(got, expected) {
+				t.Errorf("Expected %d records %.200q\nGot %d records %.200q", len(expected), expected, len(got), got)
+			}
+		})
+	}
+}
+
+// TestInputRecordRegex tests the -irs-regex flag
+func TestInputRecordRegex(t *testing.T) {
+	logEvents := "2024-01-01 start\n2024-01-02 error\n  at main.go:10\n  at app.go:3\n2024-01-03 done\n"
+
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "blank lines",
+			args:     []string{"-irs-regex", `\n{2,}`, "-"},
+			input:    "a\nb\n\n\nc\n\n",
+			expected: "\"a\nb\"\n\"c\"\n",
+		},
+		{
+			name:     "timestamps kept with their events",
+			args:     []string{"-irs-regex", `\n(\d{4}-\d\d-\d\d )|\n\z`, "-json"},
+			input:    logEvents,
+			expected: "[\n  \"2024-01-01 start\",\n  \"2024-01-02 error\\n  at main.go:10\\n  at app.go:3\",\n  \"2024-01-03 done\"\n]\n",
+		},
+		{
+			name:     "timestamps with JSON output",
+			args:     []string{"-irs-regex", `(?m)^(\d{4}-\d\d-\d\d )`, "-json"},
+			input:    logEvents,
+			expected: "[\n  \"2024-01-01 start\\n\",\n  \"2024-01-02 error\\n  at main.go:10\\n  at app.go:3\\n\",\n  \"2024-01-03 done\\n\"\n]\n",
+		},
+		{
+			name:     "separator across reads",
+			args:     []string{"-irs-regex", `;+`, "-"},
+			input:    strings.Repeat("x", 100000) + ";;;y",
+			expected: "\"" + strings.Repeat("x", 100000) + "\"\n\"y\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestCRLFInput tests removing trailing carriage returns with -crlf-in
+func TestCRLFInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "mixed line endings",
+			args:     []string{"-crlf-in", "-"},
+			input:    "a\r\nb\nc\r\r\nd\r",
+			expected: "\"a\"\n\"b\"\n\"c\r\"\n\"d\"\n",
+		},
+		{
+			name:     "TSV rows",
+			args:     []string{"-crlf-in", "-tsv-in", "-col", "2", "-"},
+			input:    "1\tx\r\n2\ty\r\n",
+			expected: "1\t\"x\"\n2\t\"y\"\n",
+		},
+		{
+			name:     "without -crlf-in the carriage return stays",
+			args:     []string{"-"},
+			input:    "a\r\n",
+			expected: "\"a\r\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestFixedLengthRecords tests reading records of a fixed size with -record-len,
+// and encoding them with -encode
+func TestFixedLengthRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "short last record",
+			args:     []string{"-record-len", "3", "-"},
+			input:    "ABCDEFGH",
+			expected: "\"ABC\"\n\"DEF\"\n\"GH\"\n",
+		},
+		{
+			name:     "newlines are data",
+			args:     []string{"-record-len", "3", "-json", "-"},
+			input:    "ab\ncd",
+			expected: "[\n  \"ab\\n\",\n  \"cd\"\n]\n",
+		},
+		{
+			name:     "hex",
+			args:     []string{"-record-len", "2", "-encode", "hex", "-"},
+			input:    "\x00\x01\xff\xfe",
+			expected: "\"0001\"\n\"fffe\"\n",
+		},
+		{
+			name:     "base64",
+			args:     []string{"-record-len", "4", "-encode", "base64", "-none", "-"},
+			input:    "\x00\x01\x02\x03\xff",
+			expected: "AAECAw==\n/w==\n",
+		},
+		{
+			name:     "encode lines",
+			args:     []string{"-encode", "hex", "-"},
+			input:    "hi\n",
+			expected: "\"6869\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestBinaryInput tests the -binary policies for inputs that look binary
+func TestBinaryInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	text := filepath.Join(tmpDir, "text.txt")
+	binary := filepath.Join(tmpDir, "data.bin")
+	latin1 := filepath.Join(tmpDir, "latin1.txt")
+	for name, data := range map[string]string{text: "a\n", binary: "x\x00y\n", latin1: "caf\xe9\n"} {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+		stderr   string
+	}{
+		{
+			name:     "wrapped by default",
+			args:     []string{text, binary},
+			expected: "\"a\"\n\"x\x00y\"\n",
+		},
+		{
+			name:     "skip",
+			args:     []string{"-binary", "skip", text, binary},
+			expected: "\"a\"\n",
+			stderr:   "skipping '" + binary + "', which looks binary: it contains NUL bytes",
+		},
+		{
+			name:     "skip invalid UTF-8",
+			args:     []string{"-binary", "skip", latin1, text},
+			expected: "\"a\"\n",
+			stderr:   "it is not valid UTF-8",
+		},
+		{
+			name:     "pass",
+			args:     []string{"-binary", "pass", binary, text},
+			expected: "x\x00y\n\"a\"\n",
+		},
+		{
+			name:     "NUL-separated text",
+			args:     []string{"-binary", "error", "-0", "-"},
+			input:    "a\x00b\x00",
+			expected: "\"a\"\n\"b\"\n",
+		},
+		{
+			name:     "transcoded text",
+			args:     []string{"-binary", "error", "-encoding", "latin-1", latin1},
+			expected: "\"caf\u00e9\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+			if !strings.Contains(stderr, tt.stderr) {
+				t.Errorf("Expected stderr to contain %q, got %q", tt.stderr, stderr)
+			}
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		_, stderr, err := runWrapline(t, []string{"-binary", "error", text, binary}, "")
+		if err == nil {
+			t.Fatal("Expected an error for binary input, got none")
+		}
+		if !strings.Contains(stderr, "looks binary") {
+			t.Errorf("Expected the error to say the input looks binary, got %q", stderr)
+		}
+	})
+}
+
+// TestSkipRecords tests discarding the first records of each input with -skip
+func TestSkipRecords(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first.txt")
+	second := filepath.Join(tmpDir, "second.txt")
+	if err := os.WriteFile(first, []byte("header\na1\na2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("header\nb1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "STDIN",
+			args:     []string{"-skip", "2", "-"},
+			input:    "a\nb\nc\nd\n",
+			expected: "\"c\"\n\"d\"\n",
+		},
+		{
+			name:     "each input file",
+			args:     []string{"-skip", "1", first, second},
+			expected: "\"a1\"\n\"a2\"\n\"b1\"\n",
+		},
+		{
+			name:     "numbering starts after the skipped records",
+			args:     []string{"-skip", "1", "-template", "{{.Num}} {{.Line}}", "-"},
+			input:    "header\nx\ny\n",
+			expected: "1 x\n2 y\n",
+		},
+		{
+			name:     "CSV header row",
+			args:     []string{"-skip", "1", "-csv-in", "-col", "2", "-"},
+			input:    "id,name\n1,ann\n",
+			expected: "1,\"\"\"ann\"\"\"\n",
+		},
+		{
+			name:     "more than the input has",
+			args:     []string{"-skip", "5", "-"},
+			input:    "a\nb\n",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestInputRecordSeparatorAuto tests detecting the separator with -irs auto
+func TestInputRecordSeparatorAuto(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		detected string
+	}{
+		{
+			name:     "LF",
+			input:    "a\nb\n",
+			expected: "\"a\"\n\"b\"\n",
+			detected: "LF",
+		},
+		{
+			name:     "mixed CRLF and LF",
+			input:    "a\r\nb\nc\r\n",
+			expected: "\"a\"\n\"b\"\n\"c\"\n",
+			detected: "CRLF",
+		},
+		{
+			name:     "NUL with a newline inside a record",
+			input:    "a\x00b\nc\x00",
+			expected: "\"a\"\n\"b\nc\"\n",
+			detected: "NUL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, []string{"-irs", "auto", "-verbose", "-"}, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+			if !strings.Contains(stderr, "detected "+tt.detected+" record separators") {
+				t.Errorf("Expected %s to be reported, got: %s", tt.detected, stderr)
+			}
+		})
+	}
+}
+
+// TestURLInput tests reading input from HTTP URLs
+func TestURLInput(t *testing.T) {
+	var mu sync.Mutex
+	flakyAttempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/lines.txt":
+			io.WriteString(w, "hello\nworld\n")
+		case "/flaky.txt":
+			flakyAttempts++
+			if flakyAttempts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, "recovered\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "single URL",
+			args:     []string{server.URL + "/lines.txt"},
+			expected: "\"hello\"\n\"world\"\n",
+		},
+		{
+			name:     "retried after 503, mixed with STDIN",
+			args:     []string{"-url-backoff", "10ms", server.URL + "/flaky.txt", "-"},
+			expected: "\"recovered\"\n\"stdin\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, "stdin\n")
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	// A 404 is not retried and fails the run
+	_, stderr, err := runWrapline(t, []string{"-url-backoff", "1h", server.URL + "/missing.txt"}, "")
+	if err == nil || !strings.Contains(stderr, "404") {
+		t.Errorf("Expected a 404 error, got %v: %s", err, stderr)
+	}
+}
+
+// TestCompressedInput tests reading gzip- and bzip2-compressed input
+func TestCompressedInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("hello\nworld\n"))
+	gz.Close()
+	gzFile := filepath.Join(tmpDir, "input.txt.gz")
+	if err := os.WriteFile(gzFile, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plainFile := filepath.Join(tmpDir, "plain.txt")
+	if err := os.WriteFile(plainFile, []byte("plain\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "detected in a file",
+			args:     []string{gzFile},
+			expected: "\"hello\"\n\"world\"\n",
+		},
+		{
+			name:     "detected on STDIN",
+			args:     []string{"-"},
+			input:    compressed.String(),
+			expected: "\"hello\"\n\"world\"\n",
+		},
+		{
+			name:     "mixed with plain input",
+			args:     []string{"-decompress", "auto", plainFile, gzFile},
+			expected: "\"plain\"\n\"hello\"\n\"world\"\n",
+		},
+		{
+			name:     "forced",
+			args:     []string{"-decompress", "gzip", "-json", gzFile},
+			expected: "[\n  \"hello\",\n  \"world\"\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	// bzip2 is detected the same way; plain text starting with its "BZh"
+	// signature is not mistaken for it
+	bz2, _ := hex.DecodeString("425a68393141592653596b5fb1dd00000241800010064490802000310c0821a369080723ae878bb9229c284835afd8ee80")
+	for input, expected := range map[string]string{
+		string(bz2):      "\"hello\"\n\"world\"\n",
+		"BZh9 is text\n": "\"BZh9 is text\"\n",
+	} {
+		stdout, stderr, err := runWrapline(t, []string{"-"}, input)
+		if err != nil {
+			t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+		}
+		if stdout != expected {
+			t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+		}
+	}
+
+	// zstd input is recognized and refused rather than wrapped as text
+	_, stderr, err := runWrapline(t, []string{"-"}, "\x28\xb5\x2f\xfd\x00\x00")
+	if err == nil || !strings.Contains(stderr, "zstd") {
+		t.Errorf("Expected an error naming zstd, got %v: %s", err, stderr)
+	}
+
+	// With -decompress none, the compressed bytes are read as they are
+	stdout, _, err := runWrapline(t, []string{"-decompress", "none", "-none", gzFile}, "")
+	if err != nil {
+		t.Fatalf("wrapline failed: %v", err)
+	}
+	if !strings.HasPrefix(stdout, "\x1f\x8b") {
+		t.Errorf("Expected the raw gzip bytes, got %q", stdout)
+	}
+
+	// Forcing gzip on input that is not compressed is an error
+	if _, _, err := runWrapline(t, []string{"-decompress", "gzip", plainFile}, ""); err == nil {
+		t.Error("Expected an error for plain input with -decompress gzip")
+	}
+}
+
+// TestRecursiveInput tests reading the files under a directory with -r
+func TestRecursiveInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{
+		"b.log":          "b\n",
+		"a.log":          "a\n",
+		"notes.txt":      "notes\n",
+		"sub/c.log":      "c\n",
+		"vendor/d.log":   "d\n",
+		"sub/old.log.gz": "gz\n",
+	} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "all files in lexical order",
+			args:     []string{"-r", tmpDir},
+			expected: "\"a\"\n\"b\"\n\"notes\"\n\"c\"\n\"gz\"\n\"d\"\n",
+		},
+		{
+			name:     "include",
+			args:     []string{"-r", tmpDir, "-include", "*.log"},
+			expected: "\"a\"\n\"b\"\n\"c\"\n\"d\"\n",
+		},
+		{
+			name:     "exclude files and directories",
+			args:     []string{"-r", tmpDir, "-exclude", "*.gz", "-exclude", "vendor", "-exclude", "*.txt"},
+			expected: "\"a\"\n\"b\"\n\"c\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, "")
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	// Nothing matching is an error rather than empty output
+	if _, _, err := runWrapline(t, []string{"-r", tmpDir, "-include", "*.csv"}, ""); err == nil {
+		t.Error("Expected an error when no files match")
+	}
+}
+
+// TestRecursiveGitignore tests skipping ignored files with -gitignore
+func TestRecursiveGitignore(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{
+		".gitignore":        "# build output\n*.tmp\n!keep.tmp\nbuild/\n/top.txt\n",
+		".git/HEAD":         "ref\n",
+		"a.txt":             "a\n",
+		"top.txt":           "top\n",
+		"x.tmp":             "x\n",
+		"keep.tmp":          "keep\n",
+		"build/out.txt":     "out\n",
+		"sub/.ignore":       "secret.txt\n",
+		"sub/secret.txt":    "secret\n",
+		"sub/top.txt":       "subtop\n",
+		"sub/deep/y.tmp":    "y\n",
+		"sub/deep/docs.txt": "docs\n",
+	} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, stderr, err := runWrapline(t, []string{"-r", tmpDir, "-gitignore", "-include", "*.t*"}, "")
+	if err != nil {
+		t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+	}
+	expected := "\"a\"\n\"keep\"\n\"docs\"\n\"subtop\"\n"
+	if stdout != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+	}
+}
+
+// TestMultipleInputs tests reading several input files into one output
+func TestMultipleInputs(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first.txt")
+	second := filepath.Join(tmpDir, "second.txt")
+	if err := os.WriteFile(first, []byte("a1\na2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("b1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "files in order",
+			args:     []string{first, second},
+			expected: "\"a1\"\n\"a2\"\n\"b1\"\n",
+		},
+		{
+			name:     "numbering restarts per file",
+			args:     []string{"-template", "{{.Num}} {{.Line}}", second, first},
+			expected: "1 b1\n1 a1\n2 a2\n",
+		},
+		{
+			name:     "names from a list",
+			args:     []string{"-files-from", "-"},
+			input:    second + "\n\n" + first + "\n",
+			expected: "\"b1\"\n\"a1\"\n\"a2\"\n",
+		},
+		{
+			name:     "NUL-separated names",
+			args:     []string{"-files0-from", "-"},
+			input:    first + "\x00" + second + "\x00",
+			expected: "\"a1\"\n\"a2\"\n\"b1\"\n",
+		},
+		{
+			name:     "STDIN among files",
+			args:     []string{"-csv", "-csv-cols", "num,line", first, "-"},
+			input:    "in\n",
+			expected: "1,a1\n2,a2\n1,in\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	// A missing input is reported before anything is written
+	stdout, _, err := runWrapline(t, []string{first, filepath.Join(tmpDir, "missing.txt")}, "")
+	if err == nil {
+		t.Error("Expected an error for a missing input")
+	}
+	if stdout != "" {
+		t.Errorf("Expected no output, got %q", stdout)
+	}
+}
+
+// TestTemplate tests the -template flag
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "numbered lines",
+			args:     []string{"-template", `{{printf "%04d" .Num}}: "{{.Line}}"`, "-"},
+			input:    "hello\nworld\n",
+			expected: "0001: \"hello\"\n0002: \"world\"\n",
+		},
+		{
+			name:     "file and bytes",
+			args:     []string{"-template", "{{.File}}:{{.Bytes}}", "-"},
+			input:    "héllo\n",
+			expected: "-:6\n",
+		},
+		{
+			name:     "escaping functions after transforms",
+			args:     []string{"-s", "-template", "x = {{js .Line}}", "-"},
+			input:    "  it's  \n",
+			expected: "x = it\\'s\n",
+		},
+		{
+			name:     "slice and index of the line",
+			args:     []string{"-template", `{{slice .Line 0 2}} {{printf "%c" (index .Line 2)}}`, "-"},
+			input:    "hello\n",
+			expected: "he l\n",
+		},
+		{
+			name:     "fields inside blocks",
+			args:     []string{"-template", `{{with .Line}}{{$.Num}}={{.}}{{end}}{{if eq .Bytes 0}}empty{{end}}`, "-"},
+			input:    "a\n",
+			expected: "1=a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	t.Run("execution errors come from the record", func(t *testing.T) {
+		_, stderr, err := runWrapline(t, []string{"-template", "{{slice .Line 0 2}}", "-"}, "hello\nx\n")
+		if err == nil {
+			t.Fatal("Expected an error for a record shorter than the slice, got none")
+		}
+		if !strings.Contains(stderr, "record 2") {
+			t.Errorf("Expected the error to name record 2, got %q", stderr)
+		}
+	})
+}
+
+// TestKVOutput tests the -kv, -kv-num, and -kv-section flags
+func TestKVOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "numbered keys",
+			args:     []string{"-kv", "HOST", "-"},
+			input:    "alpha\nbeta\n",
+			expected: "HOST1=\"alpha\"\nHOST2=\"beta\"\n",
+		},
+		{
+			name:     "unwrapped values",
+			args:     []string{"-kv", "host.", "-none", "-"},
+			input:    "alpha\nbeta\n",
+			expected: "host.1=alpha\nhost.2=beta\n",
+		},
+		{
+			name:     "number format",
+			args:     []string{"-kv", "HOST", "-kv-num", "_%02d", "-d", "'", "-escape", "-"},
+			input:    "it's\nbeta\n",
+			expected: "HOST_01='it\\'s'\nHOST_02='beta'\n",
+		},
+		{
+			name:     "numbers skip dropped lines",
+			args:     []string{"-kv", "HOST", "-e", "-"},
+			input:    "alpha\n\nbeta\n",
+			expected: "HOST1=\"alpha\"\nHOST2=\"beta\"\n",
+		},
+		{
+			name:     "INI section",
+			args:     []string{"-kv", "server", "-kv-section", "hosts", "-none", "-"},
+			input:    "alpha\nbeta\n",
+			expected: "[hosts]\nserver1=alpha\nserver2=beta\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestDotenvOutput tests the -dotenv and -dotenv-docker flags
+func TestDotenvOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "single-quoted values",
+			args:     []string{"-dotenv", "HOST_{n}", "-"},
+			input:    "alpha\n$HOME `id` \"q\"\n",
+			expected: "HOST_1='alpha'\nHOST_2='$HOME `id` \"q\"'\n",
+		},
+		{
+			name:     "double-quoted when single quote present",
+			args:     []string{"-dotenv", "V{n}", "-"},
+			input:    "it's $HOME `id` \"q\" a\\b\n",
+			expected: "V1=\"it's \\$HOME \\`id\\` \\\"q\\\" a\\\\b\"\n",
+		},
+		{
+			name:     "line breaks escaped",
+			args:     []string{"-dotenv", "NOTE_{n}", "-0", "-"},
+			input:    "one\ntwo\r\x00",
+			expected: "NOTE_1=\"one\\ntwo\\r\"\n",
+		},
+		{
+			name:     "numbers skip dropped lines",
+			args:     []string{"-dotenv", "HOST_{n}", "-e", "-"},
+			input:    "alpha\n\nbeta\n",
+			expected: "HOST_1='alpha'\nHOST_2='beta'\n",
+		},
+		{
+			name:     "docker env file",
+			args:     []string{"-dotenv", "HOST_{n}", "-dotenv-docker", "-"},
+			input:    "it's $HOME\n",
+			expected: "HOST_1=it's $HOME\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestCurlArgs tests the -curl-h and -curl-d flags
+func TestCurlArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "headers",
+			args:     []string{"-curl-h", "-"},
+			input:    "Accept: application/json\nX-Token:abc $x\n",
+			expected: "-H 'Accept: application/json'\n-H 'X-Token: abc $x'\n",
+		},
+		{
+			name:     "data with single quote",
+			args:     []string{"-format", "curl-d", "-"},
+			input:    "name=it's\n",
+			expected: "-d 'name=it'\\''s'\n",
+		},
+		{
+			name:     "empty lines dropped",
+			args:     []string{"-curl-d", "-e", "-"},
+			input:    "a=1\n\nb=2\n",
+			expected: "-d 'a=1'\n-d 'b=2'\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestJoin tests the -join, -header, and -footer flags
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "comma separated",
+			args:     []string{"-join", ",", "-"},
+			input:    "a\nb\nc\n",
+			expected: "\"a\",\"b\",\"c\"\n",
+		},
+		{
+			name:     "header and footer",
+			args:     []string{"-join", ", ", "-d", "'", "-header", "WHERE id IN (", "-footer", ")", "-"},
+			input:    "1\n2\n",
+			expected: "WHERE id IN ('1', '2')\n",
+		},
+		{
+			name:     "hex separator",
+			args:     []string{"-join", "0x09", "-none", "-"},
+			input:    "a\nb\n",
+			expected: "a\tb\n",
+		},
+		{
+			name:     "empty separator",
+			args:     []string{"-join", "", "-"},
+			input:    "a\nb\n",
+			expected: "\"a\"\"b\"\n",
+		},
+		{
+			name:     "escaping",
+			args:     []string{"-join", " ", "-escape", "-"},
+			input:    "say \"hi\"\n",
+			expected: "\"say \\\"hi\\\"\"\n",
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-join", ",", "-"},
+			input:    "",
+			expected: "",
+		},
+		{
+			name:     "empty input with footer",
+			args:     []string{"-join", ",", "-header", "f(", "-footer", ")", "-"},
+			input:    "",
+			expected: "f()\n",
+		},
+		{
+			name:     "header and footer lines",
+			args:     []string{"-header", "BEGIN", "-footer", "END", "-"},
+			input:    "a\nb\n",
+			expected: "BEGIN\n\"a\"\n\"b\"\nEND\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestColumns tests the -columns flag and its options
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "three per line",
+			args:     []string{"-columns", "3", "-"},
+			input:    "a\nb\nc\nd\ne\n",
+			expected: "\"a\", \"b\", \"c\"\n\"d\", \"e\"\n",
+		},
+		{
+			name:     "exact rows",
+			args:     []string{"-columns", "2", "-columns-sep", " | ", "-none", "-"},
+			input:    "a\nb\nc\nd\n",
+			expected: "a | b\nc | d\n",
+		},
+		{
+			name:     "trailing separator",
+			args:     []string{"-columns", "2", "-columns-trailing", "-"},
+			input:    "a\nb\nc\n",
+			expected: "\"a\", \"b\",\n\"c\"\n",
+		},
+		{
+			name:     "aligned",
+			args:     []string{"-columns", "2", "-columns-align", "-columns-trailing", "-"},
+			input:    "a\nbb\ncccc\nd\ne\n",
+			expected: "\"a\",    \"bb\",\n\"cccc\", \"d\",\n\"e\"\n",
+		},
+		{
+			name:     "aligned wide characters",
+			args:     []string{"-columns", "2", "-columns-align", "-none", "-"},
+			input:    "\u65e5\u672c\nx\nab\ny\n",
+			expected: "\u65e5\u672c, x\nab,   y\n",
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-columns", "3", "-columns-align", "-"},
+			input:    "",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestCSVColumns tests the -csv-cols flag
+func TestCSVColumns(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputFile, []byte("alpha\n\nbeta,gamma\n"), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "all columns",
+			args:     []string{"-csv-cols", "num,file,line", inputFile},
+			expected: "1," + inputFile + ",alpha\n2," + inputFile + ",\n3," + inputFile + ",\"beta,gamma\"\n",
+		},
+		{
+			name:     "custom order",
+			args:     []string{"-csv-cols", "line,num", inputFile},
+			expected: "alpha,1\n,2\n\"beta,gamma\",3\n",
+		},
+		{
+			name:     "numbers reflect input position when skipping",
+			args:     []string{"-csv-cols", "num,line", "-e", inputFile},
+			expected: "1,alpha\n3,\"beta,gamma\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, "")
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestCSVRoundTrip tests that -csv output parses back to the input lines
+func TestCSVRoundTrip(t *testing.T) {
+	lines := []string{"plain", "a,b", "\"quoted\"", " leading space", "tab\there", "", "日本語"}
+	input := strings.Join(lines, "\n") + "\nlast\n"
+
+	stdout, stderr, err := runWrapline(t, []string{"-csv", "-"}, input)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	if err != nil {
+		t.Fatalf("Output is not valid CSV: %v\nOutput: %s", err, stdout)
+	}
+
+	var got []string
+	for _, record := range records {
+		got = append(got, record[0])
+	}
+	expected := append(lines, "last")
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected: %q, Got: %q", expected, got)
+	}
+}
+
+// TestTSVOutput tests the -tsv flag
+func TestTSVOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "escapes without the default delimiter",
+			args:     []string{"-tsv", "-"},
+			input:    "a\tb\\c\rd\n",
+			expected: "a\\tb\\\\c\\rd\n",
+		},
+		{
+			name:     "explicit delimiter",
+			args:     []string{"-tsv", "-d", "'", "-"},
+			input:    "a\tb\n",
+			expected: "'a\\tb'\n",
+		},
+
+		{
+			name:     "raw values for COPY",
+			args:     []string{"-tsv", "-none", "-"},
+			input:    "col\twith tab\nplain\n",
+			expected: "col\\twith tab\nplain\n",
+		},
+		{
+			name:     "embedded newline from paragraph mode",
+			args:     []string{"-tsv", "-none", "-paragraph", "-paragraph-sep", "0x0A", "-"},
+			input:    "one\ntwo\n",
+			expected: "one\\ntwo\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	// convert -from tsv reads -tsv output back
+	tsv, stderr, err := runWrapline(t, []string{"-tsv", "-"}, "a\tb\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+	stdout, stderr, err := runWrapline(t, []string{"convert", "-from", "tsv", "-"}, tsv)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+	if expected := "\"a\tb\"\n"; stdout != expected {
+		t.Errorf("Expected round trip to give %q, got %q", expected, stdout)
+	}
+}
+
+// TestSQLiteOutput tests the -o sqlite:FILE output sink
+func TestSQLiteOutput(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 command-line tool not available")
+	}
+
+	dbFile := filepath.Join(t.TempDir(), "out.db")
+	args := []string{"-o", "sqlite:" + dbFile, "-table", "items", "-sqlite-cols", "n,file", "-sqlite-batch", "2", "-e", "-"}
+	stdout, stderr, err := runWrapline(t, args, "alpha\nit's\n\n\"quoted\"\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("Expected no output, got: %q", stdout)
+	}
+
+	query := exec.Command("sqlite3", dbFile, "SELECT n || '|' || file || '|' || line FROM items ORDER BY n")
+	out, err := query.Output()
+	if err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	expected := "1|-|alpha\n2|-|it's\n4|-|\"quoted\"\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, string(out))
+	}
+
+	// Running again appends to the existing table
+	if _, stderr, err := runWrapline(t, args, "more\n"); err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+	out, err = exec.Command("sqlite3", dbFile, "SELECT count(*) FROM items").Output()
+	if err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if strings.TrimSpace(string(out)) != "4" {
+		t.Errorf("Expected 4 rows, got: %s", out)
+	}
+}
+
+// TestPost tests the -post flag and its delivery options
+func TestPost(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	var headers []string
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		switch {
+		case strings.Contains(string(body), "flaky") && attempts%2 == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case strings.Contains(string(body), "bad"):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			bodies = append(bodies, string(body))
+			headers = append(headers, r.Header.Get("X-Token"))
+		}
+	}))
+	defer server.Close()
+
+	reset := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		bodies, headers, attempts = nil, nil, 0
+	}
+
+	t.Run("one record per request", func(t *testing.T) {
+		reset()
+		args := []string{"-post", server.URL, "-post-header", "X-Token: secret", "-post-concurrency", "1", "-"}
+		stdout, stderr, err := runWrapline(t, args, "one\ntwo\n")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		if stdout != "" {
+			t.Errorf("Expected no output, got: %q", stdout)
+		}
+		expected := []string{"\"one\"\n", "\"two\"\n"}
+		if !reflect.DeepEqual(bodies, expected) {
+			t.Errorf("Expected bodies %q, got %q", expected, bodies)
+		}
+		if !reflect.DeepEqual(headers, []string{"secret", "secret"}) {
+			t.Errorf("Expected X-Token header on every request, got %q", headers)
+		}
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		reset()
+		args := []string{"-post", server.URL, "-post-batch", "2", "-post-concurrency", "1", "-"}
+		_, stderr, err := runWrapline(t, args, "a\nb\nc\n")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		expected := []string{"\"a\"\n\"b\"\n", "\"c\"\n"}
+		if !reflect.DeepEqual(bodies, expected) {
+			t.Errorf("Expected bodies %q, got %q", expected, bodies)
+		}
+	})
+
+	t.Run("retry on server error", func(t *testing.T) {
+		reset()
+		args := []string{"-post", server.URL, "-post-backoff", "1ms", "-"}
+		_, stderr, err := runWrapline(t, args, "flaky\n")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		if len(bodies) != 1 || attempts != 2 {
+			t.Errorf("Expected 1 delivery after 2 attempts, got %d deliveries after %d attempts", len(bodies), attempts)
+		}
+	})
+
+	t.Run("rejected records", func(t *testing.T) {
+		reset()
+		rejectFile := filepath.Join(t.TempDir(), "rejects.txt")
+		args := []string{"-post", server.URL, "-reject-file", rejectFile, "-post-backoff", "1ms", "-"}
+		_, stderr, err := runWrapline(t, args, "good\nbad\n")
+		if err == nil {
+			t.Fatalf("Expected error for rejected record, got none")
+		}
+		if !strings.Contains(stderr, "1 of 2 records failed") {
+			t.Errorf("Expected failure summary, got: %q", stderr)
+		}
+		content, err := os.ReadFile(rejectFile)
+		if err != nil {
+			t.Fatalf("Failed to read reject file: %v", err)
+		}
+		if string(content) != "\"bad\"\n" {
+			t.Errorf("Expected rejected record in reject file, got: %q", string(content))
+		}
+		if attempts != 2 {
+			t.Errorf("Expected client errors not to be retried, got %d attempts", attempts)
+		}
+	})
+}
+
+// TestFromSQLite tests the -from-sqlite input source
+func TestFromSQLite(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 command-line tool not available")
+	}
+
+	dbFile := filepath.Join(t.TempDir(), "in.db")
+	setup := "CREATE TABLE users (id INTEGER, name TEXT); INSERT INTO users VALUES (1, 'alice'), (2, 'o''brien'), (3, 'two' || char(10) || 'lines');"
+	if out, err := exec.Command("sqlite3", dbFile, setup).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to create database: %v\n%s", err, out)
+	}
+
+	stdout, stderr, err := runWrapline(t, []string{"-from-sqlite", dbFile + ":SELECT name, id FROM users ORDER BY id"}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+	expected := "\"alice\"\n\"o'brien\"\n\"two\nlines\"\n"
+	if stdout != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+	}
+
+	if _, _, err := runWrapline(t, []string{"-from-sqlite", dbFile + ":SELECT nope FROM users"}, ""); err == nil {
+		t.Errorf("Expected error for invalid query, got none")
+	}
+}
+
+// TestFromCSVColumn tests the -from-csv-column input source
+func TestFromCSVColumn(t *testing.T) {
+	csvFile := filepath.Join(t.TempDir(), "in.csv")
+	content := "\ufeffid,email,note\n1,a@example.com,\"x, y\"\n2,\"b@example.com\",z\n3\n"
+	if err := os.WriteFile(csvFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create CSV file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "middle column",
+			args:     []string{"-from-csv-column", csvFile + ":email", "-e"},
+			expected: "\"a@example.com\"\n\"b@example.com\"\n",
+		},
+		{
+			name:     "first column after BOM",
+			args:     []string{"-from-csv-column", csvFile + ":id"},
+			expected: "\"1\"\n\"2\"\n\"3\"\n",
+		},
+		{
+			name:     "quoted value with comma",
+			args:     []string{"-from-csv-column", csvFile + ":note", "-d", "'"},
+			expected: "'x, y'\n'z'\n",
+		},
+		{
+			name:     "column by position",
+			args:     []string{"-from-csv-column", csvFile + ":2", "-e"},
+			expected: "\"a@example.com\"\n\"b@example.com\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, "")
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	if _, _, err := runWrapline(t, []string{"-from-csv-column", csvFile + ":missing"}, ""); err == nil {
+		t.Errorf("Expected error for missing column, got none")
+	}
+}
+
+// TestSourceOverrides tests FILE?key=value overrides on the input argument
+func TestSourceOverrides(t *testing.T) {
+	tmpDir := t.TempDir()
+	csvFile := filepath.Join(tmpDir, "in.csv")
+	if err := os.WriteFile(csvFile, []byte("id,email\n1,a@example.com\n2,b@example.com\n"), 0644); err != nil {
+		t.Fatalf("Failed to create CSV file: %v", err)
+	}
+	textFile := filepath.Join(tmpDir, "in.txt")
+	if err := os.WriteFile(textFile, []byte("alpha\nbeta\n"), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+	// A file whose name contains '?' is read as is
+	oddFile := filepath.Join(tmpDir, "odd?d=x")
+	if err := os.WriteFile(oddFile, []byte("gamma\n"), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "CSV field by position",
+			args:     []string{csvFile + "?format=csv&field=2"},
+			expected: "\"a@example.com\"\n\"b@example.com\"\n",
+		},
+		{
+			name:     "CSV field by name with delimiter",
+			args:     []string{csvFile + "?format=csv&field=id&d=%27"},
+			expected: "'1'\n'2'\n",
+		},
+		{
+			name:     "delimiter overrides flag",
+			args:     []string{"-d", "'", textFile + "?d=0x7C"},
+			expected: "|alpha|\n|beta|\n",
+		},
+		{
+			name:     "lines format",
+			args:     []string{textFile + "?format=lines"},
+			expected: "\"alpha\"\n\"beta\"\n",
+		},
+		{
+			name:     "existing file with question mark",
+			args:     []string{oddFile},
+			expected: "\"gamma\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, "")
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestOutputFile tests the -o flag
+func TestOutputFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.txt")
+
+	input := "hello\nworld\n"
+	expected := "\"hello\"\n\"world\"\n"
+
+	_, stderr, err := runWrapline(t, []string{"-o", outputFile, "-"}, input)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	if string(content) != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, string(content))
+	}
+}
+
+// TestRejectedRunKeepsOutput tests that options rejected before any input is
+// read leave an existing -o file as it was
+func TestRejectedRunKeepsOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.txt")
+	gzipFile := filepath.Join(tmpDir, "output.txt.gz")
+	stateFile := filepath.Join(tmpDir, "state.json")
+	sentinelFile := filepath.Join(tmpDir, "sentinel.txt")
+	original := []byte("\"keep\"\n\"me\"\n")
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "two output formats", args: []string{"-json", "-csv", "-o", outputFile, "-"}},
+		{name: "invalid XML name", args: []string{"-xml", "1bad", "-o", outputFile, "-"}},
+		{name: "invalid substitution", args: []string{"-sub", "s/a/b/x", "-o", outputFile, "-"}},
+		{name: "invalid -grep", args: []string{"-grep", "(", "-o", outputFile, "-"}},
+		{name: "missing include file", args: []string{"-include-file", filepath.Join(tmpDir, "missing"), "-o", outputFile, "-"}},
+		{name: "-post with -json", args: []string{"-post", "http://127.0.0.1:1", "-json", "-o", outputFile, "-"}},
+		{name: "-resume-state with -json", args: []string{"-json", "-o", outputFile, "-resume-state", stateFile, "-"}},
+		{name: "compressed output", args: []string{"-json", "-csv", "-o", gzipFile, "-"}},
+		{name: "several outputs", args: []string{"-json", "-csv", "-o", outputFile, "-o", gzipFile, "-"}},
+		{name: "-sentinel-file", args: []string{"-d", "random", "-sentinel-file", sentinelFile, "-ors", "", "-"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{outputFile, gzipFile, sentinelFile} {
+				if err := os.WriteFile(name, original, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, _, err := runWrapline(t, tt.args, "a\nb\n")
+			if err == nil {
+				t.Fatal("Expected an error, got none")
+			}
+			for _, name := range []string{outputFile, gzipFile, sentinelFile} {
+				content, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(content, original) {
+					t.Errorf("Expected %s to be unchanged, got %q", filepath.Base(name), content)
+				}
+			}
+		})
+	}
+}
+
+// TestRejectedRunOpensNoInput tests that options are checked before a URL is
+// fetched or a SQLite or CSV source is opened
+func TestRejectedRunOpensNoInput(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name        string
+		args        []string
+		expectError string
+	}{
+		{
+			name:        "URL",
+			args:        []string{"-url-retries", "0", "-resume-state", "state.json", "http://127.0.0.1:1/x"},
+			expectError: "-resume-state requires a single -o FILE",
+		},
+		{
+			name:        "-from-sqlite",
+			args:        []string{"-from-sqlite", missing + ":select 1", "-json", "-csv"},
+			expectError: "only one output format",
+		},
+		{
+			name:        "-from-csv-column",
+			args:        []string{"-from-csv-column", missing + ":name", "-json", "-csv"},
+			expectError: "only one output format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, err := runWrapline(t, tt.args, "")
+			if err == nil {
+				t.Fatal("Expected an error, got none")
+			}
+			if !strings.Contains(stderr, tt.expectError) {
+				t.Errorf("Expected stderr to contain %q, got: %s", tt.expectError, stderr)
+			}
+		})
+	}
+}
+
+// TestKeepGoing tests that -keep-going reports unreadable inputs and carries on
+func TestKeepGoing(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first.txt")
+	second := filepath.Join(tmpDir, "second.txt")
+	missing := filepath.Join(tmpDir, "missing.txt")
+	if err := os.WriteFile(first, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		stderr string
+	}{
+		{
+			name:   "missing file",
+			args:   []string{"-keep-going", first, missing, second},
+			stderr: "skipping: open " + missing,
+		},
+		{
+			name:   "read error",
+			args:   []string{"-keep-going", first, tmpDir, second},
+			stderr: "skipping: input '" + tmpDir + "'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, "")
+			if err == nil {
+				t.Fatal("Expected a non-zero exit status, got none")
+			}
+			if expected := "\"a\"\n\"b\"\n"; stdout != expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+			}
+			for _, want := range []string{tt.stderr, "1 of the inputs could not be read completely"} {
+				if !strings.Contains(stderr, want) {
+					t.Errorf("Expected stderr to contain %q, got %q", want, stderr)
+				}
+			}
+		})
+	}
+
+	t.Run("stops without -keep-going", func(t *testing.T) {
+		stdout, _, err := runWrapline(t, []string{first, missing, second}, "")
+		if err == nil {
+			t.Fatal("Expected an error for a missing input, got none")
+		}
+		if stdout != "" {
+			t.Errorf("Expected no output, got %q", stdout)
+		}
+	})
+}
+
+// TestMerge tests interleaving several inputs with -merge
+func TestMerge(t *testing.T) {
+	tmpDir := t.TempDir()
+	a := filepath.Join(tmpDir, "a.txt")
+	b := filepath.Join(tmpDir, "b.txt")
+	c := filepath.Join(tmpDir, "c.txt")
+	unsorted := filepath.Join(tmpDir, "unsorted.txt")
+	for name, data := range map[string]string{a: "1\n3\n5\n", b: "2\n4\n", c: "0\n6\n", unsorted: "9\n8\n"} {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "sorted",
+			args:     []string{"-merge", "sorted", "-none", a, b, c},
+			expected: "0\n1\n2\n3\n4\n5\n6\n",
+		},
+		{
+			name:     "round robin",
+			args:     []string{"-merge", "roundrobin", "-none", a, b, c},
+			expected: "1\n2\n0\n3\n4\n6\n5\n",
+		},
+		{
+			name:     "each input numbered separately",
+			args:     []string{"-merge", "roundrobin", "-template", "{{.File}}:{{.Num}} {{.Line}}", a, b},
+			expected: a + ":1 1\n" + b + ":1 2\n" + a + ":2 3\n" + b + ":2 4\n" + a + ":3 5\n",
+		},
+		{
+			name:     "skip applies to each input",
+			args:     []string{"-merge", "sorted", "-skip", "1", "-none", a, b},
+			expected: "3\n4\n5\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, "")
+			if err != nil {
+				t.Fatalf("wrapline failed: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	t.Run("unsorted input", func(t *testing.T) {
+		_, stderr, err := runWrapline(t, []string{"-merge", "sorted", a, unsorted}, "")
+		if err == nil {
+			t.Fatal("Expected an error for an unsorted input, got none")
+		}
+		if !strings.Contains(stderr, "is not sorted") {
+			t.Errorf("Expected an error about sorting, got %q", stderr)
+		}
+	})
+}
+
+// TestMultipleOutputs tests repeated -o flags and /dev/fd/N targets
+func TestMultipleOutputs(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first.txt")
+	second := filepath.Join(tmpDir, "second.txt")
+
+	input := "hello\nworld\n"
+	expected := "\"hello\"\n\"world\"\n"
+
+	t.Run("files and fd", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Failed to create pipe: %v", err)
+		}
+		defer r.Close()
+
+		cmd := exec.Command("./wrapline", "-o", first, "-o", second, "-o", "/dev/fd/3", "-")
+		cmd.Stdin = strings.NewReader(input)
+		cmd.ExtraFiles = []*os.File{w}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start wrapline: %v", err)
+		}
+		w.Close()
+
+		piped, _ := io.ReadAll(r)
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr.String())
+		}
+
+		for _, name := range []string{first, second} {
+			content, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if string(content) != expected {
+				t.Errorf("%s: expected:\n%q\nGot:\n%q", name, expected, string(content))
+			}
+		}
+		if string(piped) != expected {
+			t.Errorf("/dev/fd/3: expected:\n%q\nGot:\n%q", expected, string(piped))
+		}
+	})
+
+	t.Run("tee", func(t *testing.T) {
+		stdout, stderr, err := runWrapline(t, []string{"-tee", "-o", first, "-"}, input)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		if stdout != expected {
+			t.Errorf("STDOUT: expected:\n%q\nGot:\n%q", expected, stdout)
+		}
+		content, err := os.ReadFile(first)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		if string(content) != expected {
+			t.Errorf("%s: expected:\n%q\nGot:\n%q", first, expected, string(content))
+		}
+	})
+
+	t.Run("failed output does not stop others", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Failed to create pipe: %v", err)
+		}
+		r.Close()
+
+		cmd := exec.Command("./wrapline", "-o", "/dev/fd/3", "-o", first, "-")
+		cmd.Stdin = strings.NewReader(input)
+		cmd.ExtraFiles = []*os.File{w}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		w.Close()
+
+		if err == nil {
+			t.Fatalf("Expected error for the broken output, got none")
+		}
+		if !strings.Contains(stderr.String(), "output '/dev/fd/3'") {
+			t.Errorf("Expected the broken output to be reported, got: %s", stderr.String())
+		}
+		content, err := os.ReadFile(first)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		if string(content) != expected {
+			t.Errorf("Expected:\n%q\nGot:\n%q", expected, string(content))
+		}
+	})
+}
+
+// TestCompressedOutput tests gzip output with -compress and -o FILE.gz
+func TestCompressedOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := "hello\nworld\n"
+	expected := "\"hello\"\n\"world\"\n"
+
+	gunzip := func(t *testing.T, data []byte) string {
+		t.Helper()
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Output is not gzip-compressed: %v", err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Failed to decompress output: %v", err)
+		}
+		return string(out)
+	}
+
+	t.Run("file ending in .gz with tee", func(t *testing.T) {
+		outputFile := filepath.Join(tmpDir, "out.txt.gz")
+		stdout, stderr, err := runWrapline(t, []string{"-o", outputFile, "-tee", "-"}, input)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		content, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		if got := gunzip(t, content); got != expected {
+			t.Errorf("Expected:\n%q\nGot:\n%q", expected, got)
+		}
+		if stdout != expected {
+			t.Errorf("Expected uncompressed STDOUT %q, got %q", expected, stdout)
+		}
+	})
+
+	t.Run("STDOUT", func(t *testing.T) {
+		stdout, stderr, err := runWrapline(t, []string{"-compress", "gzip", "-json", "-"}, input)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		want := "[\n  \"hello\",\n  \"world\"\n]\n"
+		if got := gunzip(t, []byte(stdout)); got != want {
+			t.Errorf("Expected:\n%q\nGot:\n%q", want, got)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		outputFile := filepath.Join(tmpDir, "plain.gz")
+		_, stderr, err := runWrapline(t, []string{"-o", outputFile, "-compress", "none", "-"}, input)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		content, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		if string(content) != expected {
+			t.Errorf("Expected:\n%q\nGot:\n%q", expected, string(content))
+		}
+	})
+}
+
+// TestSplitLines tests the -split-lines flag
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "plain output",
+			args:     []string{"-split-lines", "2"},
+			input:    "a\nb\nc\nd\ne\n",
+			expected: []string{"\"a\"\n\"b\"\n", "\"c\"\n\"d\"\n", "\"e\"\n"},
+		},
+		{
+			name:     "SQL batches",
+			args:     []string{"-split-lines", "3", "-sql-insert", "-sql-insert-batch", "2"},
+			input:    "a\nb\nc\nd\n",
+			expected: []string{"INSERT INTO lines (line) VALUES ('a'), ('b');\nINSERT INTO lines (line) VALUES ('c');\n", "INSERT INTO lines (line) VALUES ('d');\n"},
+		},
+		{
+			name:     "complete JSON documents",
+			args:     []string{"-split-lines", "2", "-json"},
+			input:    "a\nb\nc\n",
+			expected: []string{"[\n  \"a\",\n  \"b\"\n]\n", "[\n  \"c\"\n]\n"},
+		},
+		{
+			name:     "empty input",
+			args:     []string{"-split-lines", "2"},
+			input:    "",
+			expected: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFile := filepath.Join(t.TempDir(), "out")
+			args := append(tt.args, "-o", outputFile, "-")
+			_, stderr, err := runWrapline(t, args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			for i, expected := range tt.expected {
+				name := splitName(outputFile, i+1)
+				output, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if string(output) != expected {
+					t.Errorf("File %s: expected %q, got %q", name, expected, output)
+				}
+			}
+			extra := splitName(outputFile, len(tt.expected)+1)
+			if _, err := os.Stat(extra); err == nil {
+				t.Errorf("Expected no file %s", extra)
+			}
+			if _, err := os.Stat(outputFile); err == nil {
+				t.Errorf("Expected no file %s", outputFile)
+			}
+		})
+	}
+}
+
+// TestSplitBytes tests the -split-bytes flag
+func TestSplitBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "records kept whole",
+			args:     []string{"-split-bytes", "10"},
+			input:    "aa\nbb\ncc\nd\n",
+			expected: []string{"\"aa\"\n\"bb\"\n", "\"cc\"\n\"d\"\n"},
+		},
+		{
+			name:     "exact fit",
+			args:     []string{"-split-bytes", "6", "-none"},
+			input:    "ab\ncd\nef\n",
+			expected: []string{"ab\ncd\n", "ef\n"},
+		},
+		{
+			name:     "header counted in each file",
+			args:     []string{"-split-bytes", "30", "-md-table"},
+			input:    "a\nb\nc\n",
+			expected: []string{"| line |\n| --- |\n| a |\n| b |\n", "| line |\n| --- |\n| c |\n"},
+		},
+		{
+			name:     "CSV",
+			args:     []string{"-split-bytes", "7", "-csv"},
+			input:    "a,b\nc\n",
+			expected: []string{"\"a,b\"\n", "c\n"},
+		},
+		{
+			name:     "with record limit",
+			args:     []string{"-split-bytes", "1k", "-split-lines", "2", "-none"},
+			input:    "a\nb\nc\n",
+			expected: []string{"a\nb\n", "c\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFile := filepath.Join(t.TempDir(), "out")
+			args := append(tt.args, "-o", outputFile, "-")
+			_, stderr, err := runWrapline(t, args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			for i, expected := range tt.expected {
+				name := splitName(outputFile, i+1)
+				output, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if string(output) != expected {
+					t.Errorf("File %s: expected %q, got %q", name, expected, output)
+				}
+			}
+			extra := splitName(outputFile, len(tt.expected)+1)
+			if _, err := os.Stat(extra); err == nil {
+				t.Errorf("Expected no file %s", extra)
+			}
+		})
+	}
+
+	// A record that cannot fit in any file is an error
+	outputFile := filepath.Join(t.TempDir(), "out")
+	_, stderr, err := runWrapline(t, []string{"-split-bytes", "4", "-none", "-o", outputFile, "-"}, "ok\ntoolong\n")
+	if err == nil {
+		t.Fatal("Expected an error for a record larger than -split-bytes")
+	}
+	if !strings.Contains(stderr, "record 2") {
+		t.Errorf("Expected the oversized record to be named, got: %s", stderr)
+	}
+}
+
+// TestManifest tests the -manifest flag
+func TestManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "input.txt")
+	outputFile := filepath.Join(tmpDir, "output.txt")
+	manifestFile := filepath.Join(tmpDir, "manifest.json")
+
+	input := "alpha\n\nbeta\n"
+	if err := os.WriteFile(inputFile, []byte(input), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+
+	_, stderr, err := runWrapline(t, []string{"-e", "-o", outputFile, "-manifest", manifestFile, inputFile}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	output, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+
+	var entries []map[string]any
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v\n%s", err, data)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 manifest entry, got %d", len(entries))
+	}
+
+	inputSum := sha256.Sum256([]byte(input))
+	outputSum := sha256.Sum256(output)
+	expected := map[string]any{
+		"input":           inputFile,
+		"output":          outputFile,
+		"records_read":    float64(3),
+		"records_written": float64(2),
+		"input_sha256":    hex.EncodeToString(inputSum[:]),
+		"output_sha256":   hex.EncodeToString(outputSum[:]),
+	}
+	if !reflect.DeepEqual(entries[0], expected) {
+		t.Errorf("Expected manifest entry:\n%v\nGot:\n%v", expected, entries[0])
+	}
+}
+
+// TestResumeState tests reporting a full output device and -resume-state
+func TestResumeState(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "input.txt")
+	outputFile := filepath.Join(tmpDir, "output.txt")
+	stateFile := filepath.Join(tmpDir, "state.json")
+
+	if err := os.WriteFile(inputFile, []byte("a\nb\nc\nd\n"), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+
+	t.Run("full device", func(t *testing.T) {
+		_, stderr, err := runWrapline(t, []string{"-o", "/dev/full", inputFile}, "")
+		if err == nil {
+			t.Fatal("Expected an error writing to /dev/full")
+		}
+		if !strings.Contains(stderr, "output device is full") || !strings.Contains(stderr, "the first 0 records") {
+			t.Errorf("Expected a full device report, got: %s", stderr)
+		}
+	})
+
+	t.Run("state saved on failure", func(t *testing.T) {
+		_, stderr, err := runWrapline(t, []string{"-o", "/dev/full", "-resume-state", stateFile, inputFile}, "")
+		if err == nil {
+			t.Fatal("Expected an error writing to /dev/full")
+		}
+		data, err := os.ReadFile(stateFile)
+		if err != nil {
+			t.Fatalf("Expected resume state to be saved: %v\nStderr: %s", err, stderr)
+		}
+		var state map[string]any
+		if err := json.Unmarshal(data, &state); err != nil {
+			t.Fatalf("Resume state is not valid JSON: %v\n%s", err, data)
+		}
+		expected := map[string]any{"input": inputFile, "records": float64(0), "bytes": float64(0)}
+		if !reflect.DeepEqual(state, expected) {
+			t.Errorf("Expected resume state %v, got %v", expected, state)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		// A partial record after the last complete one is discarded
+		if err := os.WriteFile(outputFile, []byte("\"a\"\n\"b\"\n\"c"), 0644); err != nil {
+			t.Fatalf("Failed to create output file: %v", err)
+		}
+		state, _ := json.Marshal(map[string]any{"input": inputFile, "records": 2, "bytes": 8})
+		if err := os.WriteFile(stateFile, state, 0644); err != nil {
+			t.Fatalf("Failed to create state file: %v", err)
+		}
+
+		_, stderr, err := runWrapline(t, []string{"-o", outputFile, "-resume-state", stateFile, inputFile}, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		output, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		expected := "\"a\"\n\"b\"\n\"c\"\n\"d\"\n"
+		if string(output) != expected {
+			t.Errorf("Expected output %q, got %q", expected, output)
+		}
+		if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+			t.Errorf("Expected resume state to be removed after a complete run")
+		}
+	})
+
+	t.Run("different input", func(t *testing.T) {
+		state := `{"input": "other.txt", "records": 1, "bytes": 4}`
+		if err := os.WriteFile(stateFile, []byte(state), 0644); err != nil {
+			t.Fatalf("Failed to create state file: %v", err)
+		}
+		_, _, err := runWrapline(t, []string{"-o", outputFile, "-resume-state", stateFile, inputFile}, "")
+		if err == nil {
+			t.Error("Expected an error resuming from another input's state")
+		}
+	})
+
+	// Options that cannot be resumed are rejected before the partial output
+	// is cut back
+	for _, args := range [][]string{{"-json"}, {"-header", "H"}, {"-tail", "1"}, {"-sample-n", "1"}, {"-no-final-newline"}} {
+		t.Run("rejects "+args[0], func(t *testing.T) {
+			partial := []byte("\"a\"\n\"b\"\n\"c")
+			if err := os.WriteFile(outputFile, partial, 0644); err != nil {
+				t.Fatalf("Failed to create output file: %v", err)
+			}
+			state, _ := json.Marshal(map[string]any{"input": inputFile, "records": 2, "bytes": 8})
+			if err := os.WriteFile(stateFile, state, 0644); err != nil {
+				t.Fatalf("Failed to create state file: %v", err)
+			}
+			_, stderr, err := runWrapline(t, append(args, "-o", outputFile, "-resume-state", stateFile, inputFile), "")
+			if err == nil {
+				t.Fatal("Expected an error, got none")
+			}
+			if !strings.Contains(stderr, "-resume-state") {
+				t.Errorf("Expected an error about -resume-state, got %q", stderr)
+			}
+			output, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if !bytes.Equal(output, partial) {
+				t.Errorf("Expected the partial output to be unchanged, got %q", output)
+			}
+		})
+	}
+}
+
+// TestSinceCheckpoint tests the -since-checkpoint flag on a growing file
+func TestSinceCheckpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "app.log")
+	checkpointFile := filepath.Join(tmpDir, "app.checkpoint")
+
+	// Each step writes (or appends to) the input and runs once more
+	steps := []struct {
+		name     string
+		write    string
+		append   bool
+		expected string
+		stderr   string
+	}{
+		{name: "first run", write: "a\nb\npart", expected: "\"a\"\n\"b\"\n"},
+		{name: "appended", write: "ial\nc\n", append: true, expected: "\"partial\"\n\"c\"\n"},
+		{name: "nothing new", expected: "", append: true},
+		{name: "truncated", write: "x\n", expected: "\"x\"\n", stderr: "shorter than at the checkpoint"},
+		{name: "rotated", write: "y\nlonger line\n", expected: "\"y\"\n\"longer line\"\n", stderr: "replaced since the checkpoint"},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if step.append {
+				flags = os.O_WRONLY | os.O_APPEND
+			}
+			f, err := os.OpenFile(inputFile, flags, 0644)
+			if err != nil {
+				t.Fatalf("Failed to open input file: %v", err)
+			}
+			if _, err := f.WriteString(step.write); err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+			f.Close()
+
+			stdout, stderr, err := runWrapline(t, []string{"-since-checkpoint", checkpointFile, inputFile}, "")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != step.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", step.expected, stdout)
+			}
+			if step.stderr != "" && !strings.Contains(stderr, step.stderr) {
+				t.Errorf("Expected stderr to contain %q, got: %s", step.stderr, stderr)
+			}
+		})
+	}
+}
+
+// TestFileInput tests reading from a file instead of STDIN
+func TestFileInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "input.txt")
+
+	input := "hello\nworld\n"
+	expected := "\"hello\"\n\"world\"\n"
+
+	if err := os.WriteFile(inputFile, []byte(input), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+
+	stdout, stderr, err := runWrapline(t, []string{inputFile}, "")
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	if stdout != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+	}
+}
+
+// TestCombinations tests common flag combinations
+func TestCombinations(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "strip and skip empty",
+			args:     []string{"-s", "-e", "-"},
+			input:    "  hello  \n\n  world  \n",
+			expected: "\"hello\"\n\"world\"\n",
+		},
+		{
+			name:     "custom delimiter with escape",
+			args:     []string{"-d", "'", "-escape", "-"},
+			input:    "it's working\n",
+			expected: "'it\\'s working'\n",
+		},
+		{
+			name:     "strip, skip empty, and escape",
+			args:     []string{"-s", "-e", "-escape", "-"},
+			input:    "  \"test\"  \n\n  data  \n",
+			expected: "\"\\\"test\\\"\"\n\"data\"\n",
+		},
+		{
+			name:     "null-terminated with custom delimiter",
+			args:     []string{"-0", "-d", "|", "-"},
+			input:    "one\x00two\x00three\x00",
+			expected: "|one|\n|two|\n|three|\n",
+		},
+		{
+			name:     "all options combined",
+			args:     []string{"-s", "-e", "-escape", "-d", "'", "-"},
+			input:    "  it's  \n\n  'quoted'  \n",
+			expected: "'it\\'s'\n'\\'quoted\\''\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestEdgeCases tests various edge cases
+func TestEdgeCases(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "empty input",
+			args:     []string{"-"},
+			input:    "",
+			expected: "",
+		},
+		{
+			name:     "single empty line",
+			args:     []string{"-"},
+			input:    "\n",
+			expected: "",
+		},
+		{
+			name:     "only whitespace with strip",
+			args:     []string{"-s", "-"},
+			input:    "   \n",
+			expected: "",
+		},
+		{
+			name:     "very long line",
+			args:     []string{"-"},
+			input:    strings.Repeat("a", 10000) + "\n",
+			expected: "\"" + strings.Repeat("a", 10000) + "\"\n",
+		},
+		{
+			name:     "no trailing newline",
+			args:     []string{"-"},
+			input:    "hello",
+			expected: "\"hello\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestCheckFlags tests the -check-flags dry run
+func TestCheckFlags(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.txt")
+
+	tests := []struct {
+		name        string
+		args        []string
+		expected    string
+		expectError string
+	}{
+		{
+			name:     "compatible",
+			args:     []string{"-check-flags", "-o", outputFile, "-"},
+			expected: "wrapline: options are compatible\n",
+		},
+		{
+			name: "ineffective and buffering",
+			args: []string{"-check-flags", "-format", "heredoc", "-ellipsis", "..", "-d", "'", "-"},
+			expected: "wrapline: options are compatible\n" +
+				"  ineffective: -d has no effect with the other options given\n" +
+				"  ineffective: -ellipsis has no effect with the other options given\n" +
+				"  buffering:   -format heredoc holds the whole input in memory until it ends\n",
+		},
+		{
+			name:        "incompatible",
+			args:        []string{"-check-flags", "-json", "-csv", "-"},
+			expectError: "only one output format",
+		},
+		{
+			name:        "missing input file",
+			args:        []string{"-check-flags", "/nonexistent/file.txt"},
+			expectError: "failed to open file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, "never read\n")
+
+			if tt.expectError != "" {
+				if err == nil {
+					t.Fatalf("Expected error, got none. Stdout: %q", stdout)
+				}
+				if !strings.Contains(stderr, tt.expectError) {
+					t.Errorf("Expected stderr to contain %q, got: %s", tt.expectError, stderr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Errorf("Expected -check-flags not to create the output file, got: %v", err)
+	}
+}
+
+// TestVersion tests the -v flag
+func TestVersion(t *testing.T) {
+	cmd := exec.Command("./wrapline", "-v")
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	output := stdout.String()
+	if !strings.Contains(output, pgmName) {
+		t.Errorf("Expected version output to contain program name, got: %q", output)
+	}
+	if !strings.Contains(output, pgmVersion) {
+		t.Errorf("Expected version output to contain version, got: %q", output)
+	}
+	if !strings.Contains(output, pgmURL) {
+		t.Errorf("Expected version output to contain URL, got: %q", output)
+	}
+}
+
+// TestStats tests the -stats and -fail-on-drop flags
+func TestStats(t *testing.T) {
+	tmpDir := t.TempDir()
+	excludeFile := filepath.Join(tmpDir, "exclude.txt")
+	if err := os.WriteFile(excludeFile, []byte("b\n"), 0644); err != nil {
+		t.Fatalf("Failed to create exclude file: %v", err)
+	}
+	input := "a\n\nb\nc\n\n"
+
+	stdout, stderr, err := runWrapline(t, []string{"-stats", "-e", "-exclude-file", excludeFile, "-"}, input)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+	if expected := "\"a\"\n\"c\"\n"; stdout != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+	}
+	for _, want := range []string{
+		"read:              5\n",
+		"written:           2\n",
+		"dropped:           3\n",
+		"empty (-e):      1\n",
+		"empty last line: 1\n",
+		"filtered:        1\n",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("Expected stats to contain %q, got:\n%s", want, stderr)
+		}
+	}
+
+	_, stderr, err = runWrapline(t, []string{"-fail-on-drop", "-e", "-"}, input)
+	if err == nil {
+		t.Fatalf("Expected error with -fail-on-drop, got none")
+	}
+	if want := "2 of 5 records were dropped"; !strings.Contains(stderr, want) {
+		t.Errorf("Expected stderr to contain %q, got: %s", want, stderr)
+	}
+
+	if _, stderr, err := runWrapline(t, []string{"-fail-on-drop", "-"}, "a\nb\n"); err != nil {
+		t.Errorf("Expected no error without drops, got: %v\nStderr: %s", err, stderr)
+	}
+
+	_, stderr, err = runWrapline(t, []string{"-skip", "1", "-stats", "-fail-on-drop", "-"}, "h\na\nb\n")
+	if err == nil {
+		t.Fatalf("Expected error with -skip and -fail-on-drop, got none")
+	}
+	for _, want := range []string{"read:              3\n", "skipped (-skip): 1\n", "1 of 3 records were dropped"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("Expected stderr to contain %q, got:\n%s", want, stderr)
+		}
+	}
+}
+
+// TestReportMemory tests the -report memory flag
+func TestReportMemory(t *testing.T) {
+	input := "hello\nworld\n"
+	expected := "\"hello\"\n\"world\"\n"
+
+	stdout, stderr, err := runWrapline(t, []string{"-report", "memory", "-"}, input)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+	}
+
+	if stdout != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, stdout)
+	}
+
+	for _, want := range []string{"memory report", "heap in use", "total alloc", "GC cycles"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("Expected report to contain %q, got: %q", want, stderr)
+		}
+	}
+}
+
+// TestGen tests the gen subcommand
+func TestGen(t *testing.T) {
+	for _, profile := range []string{"ascii", "unicode", "pathological"} {
+		t.Run(profile, func(t *testing.T) {
+			args := []string{"gen", "-lines", "50", "-profile", profile, "-seed", "7"}
+			first, stderr, err := runWrapline(t, args, "")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+
+			if got := strings.Count(first, "\n"); got != 50 {
+				t.Errorf("Expected 50 lines, got %d", got)
+			}
+
+			second, _, _ := runWrapline(t, args, "")
+			if first != second {
+				t.Errorf("Expected identical output for the same seed")
+			}
+		})
+	}
+
+	t.Run("pathological with -0", func(t *testing.T) {
+		stdout, stderr, err := runWrapline(t, []string{"gen", "-lines", "2000", "-profile", "pathological", "-0"}, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		if got := strings.Count(stdout, "\x00"); got != 2000 {
+			t.Errorf("Expected 2000 records, got %d", got)
+		}
+	})
+
+	_, _, err := runWrapline(t, []string{"gen", "-profile", "bogus"}, "")
+	if err == nil {
+		t.Errorf("Expected error for unknown profile, got none")
+	}
+}
+
+// TestVerify tests the verify subcommand
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		input       string
+		expected    string
+		expectError string
+	}{
+		{
+			name:     "generated sample",
+			args:     []string{"verify", "-lines", "500"},
+			expected: "sample: 500 records round-trip\n",
+		},
+		{
+			name:     "generated null-terminated sample",
+			args:     []string{"verify", "-0", "-lines", "500"},
+			expected: "sample: 500 records round-trip\n",
+		},
+		{
+			name:     "input with escaping",
+			args:     []string{"verify", "-d", "'", "-escape", "-"},
+			input:    "it's\n''\\'\n",
+			expected: "-: 2 records round-trip\n",
+		},
+		{
+			name:        "embedded newline",
+			args:        []string{"verify", "-0", "-"},
+			input:       "a\x00b\nc\x00",
+			expectError: "record 2 of - does not round-trip: wrapped record spans 2 lines",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+
+			if tt.expectError != "" {
+				if err == nil {
+					t.Fatalf("Expected error, got none. Stdout: %q", stdout)
+				}
+				if !strings.Contains(stderr, tt.expectError) {
+					t.Errorf("Expected stderr to contain %q, got: %s", tt.expectError, stderr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+// TestInspect tests the inspect subcommand's report on sampled input
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected []string
+	}{
+		{
+			name:  "backslash-escaped quotes",
+			args:  []string{"inspect"},
+			input: "\"a\"\n\"it\\\"s\"\n\"b c\"\n",
+			expected: []string{
+				"-: examined all of the input, 3 records\n",
+				"  separator: LF\n",
+				"  encoding:  ASCII\n",
+				"  lengths:   min 3, median 5, p95 5, max 7 bytes\n",
+				"  quoting:   \" (3 of 3 non-empty records)\n",
+				"  escaping:  consistent, backslash (1 embedded quotes)\n",
+				"  flags:     -d '\"' -escape\n",
+			},
+		},
+		{
+			name:  "CRLF without quoting",
+			args:  []string{"inspect", "-"},
+			input: "x\r\ny\r\n",
+			expected: []string{
+				"  separator: CRLF\n",
+				"  quoting:   none\n",
+				"  flags:     -none\n",
+			},
+		},
+		{
+			name:  "NUL separated",
+			args:  []string{"inspect"},
+			input: "a b\x00c\x00",
+			expected: []string{
+				"  separator: NUL\n",
+				"  flags:     -0 -none\n",
+			},
+		},
+		{
+			name:  "doubled quotes",
+			args:  []string{"inspect"},
+			input: "'a'\n'it''s'\n",
+			expected: []string{
+				"  escaping:  consistent, doubled as in CSV (1 embedded quotes)",
+				"  flags:     -d ''\\'''\n",
+			},
+		},
+		{
+			name:  "invalid UTF-8",
+			args:  []string{"inspect"},
+			input: "caf\xe9\n",
+			expected: []string{
+				"  encoding:  not UTF-8 (1 invalid sequences)",
+			},
+		},
+		{
+			name:  "sample stops early",
+			args:  []string{"inspect", "-sample", "6"},
+			input: "one\ntwo\nthree\n",
+			expected: []string{
+				"-: examined the first 6 B of the input, 1 records\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, tt.args, tt.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, stdout)
+				}
+			}
+		})
+	}
+}
+
+// TestSet tests the set subcommand, in memory and with spilling to disk
+func TestSet(t *testing.T) {
+	tmpDir := t.TempDir()
+	fileA := filepath.Join(tmpDir, "a.txt")
+	fileB := filepath.Join(tmpDir, "b.txt")
+	if err := os.WriteFile(fileA, []byte("apple\nbanana\ncherry\nbanana\n\n"), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+	if err := os.WriteFile(fileB, []byte("cherry\ndate\nbanana\n"), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+
+	tests := []struct {
+		op       string
+		expected string
+	}{
+		{op: "union", expected: "\"apple\"\n\"banana\"\n\"cherry\"\n\"date\"\n"},
+		{op: "intersect", expected: "\"banana\"\n\"cherry\"\n"},
+		{op: "subtract", expected: "\"apple\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			stdout, stderr, err := runWrapline(t, []string{"set", tt.op, fileA, fileB}, "")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, stdout)
+			}
+
+			// Spilling to partitions does not preserve order
+			stdout, stderr, err = runWrapline(t, []string{"set", "-max-memory", "8", tt.op, fileA, fileB}, "")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+			}
+			got := strings.Split(strings.TrimSpace(stdout), "\n")
+			slices.Sort(got)
+			if sorted := strings.Join(got, "\n") + "\n"; sorted != tt.expected {
+				t.Errorf("Expected (sorted):\n%q\nGot:\n%q", tt.expected, sorted)
+			}
+		})
+	}
+
+	t.Run("stdin and custom delimiter", func(t *testing.T) {
+		stdout, stderr, err := runWrapline(t, []string{"set", "-d", "'", "intersect", "-", fileB}, "date\nfig\n")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v\nStderr: %s", err, stderr)
+		}
+		if expected := "'date'\n"; stdout != expected {
+			t.Errorf("Expected: %q, Got: %q", expected, stdout)
+		}
+	})
+
+	t.Run("unknown operation", func(t *testing.T) {
+		if _, _, err := runWrapline(t, []string{"set", "xor", fileA, fileB}, ""); err == nil {
+			t.Errorf("Expected error, got none")
+		}
+	})
+}
+
+// TestErrorCases tests error conditions
+// Note: "no filename argument" is not tested here because in the test environment
+// (where stdin is not a terminal), the program correctly treats this as piped input
+// rather than an error condition. This matches the program's intended behavior.
+func TestErrorCases(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		input       string
+		expectError bool
+	}{
+		{
+			name:        "too many arguments",
+			args:        []string{"file1.txt", "file2.txt"},
+			input:       "",
+			expectError: true,
 		},
 		{
 			name:        "invalid hex delimiter",
@@ -483,6 +5599,642 @@ func TestErrorCases(t *testing.T) {
 			input:       "test\n",
 			expectError: true,
 		},
+		{
+			name:        "unknown report type",
+			args:        []string{"-report", "cpu", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "negative wrap width",
+			args:        []string{"-wrap-width", "-1", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "missing plugin command",
+			args:        []string{"-plugin", "/nonexistent/plugin", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "ellipsis wider than truncate width",
+			args:        []string{"-truncate", "2", "-ellipsis", "...", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "missing delimiter file",
+			args:        []string{"-d", "@/nonexistent/delim", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "none with explicit delimiter",
+			args:        []string{"-none", "-d", "'", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "missing deconfuse mapping file",
+			args:        []string{"-deconfuse", "-deconfuse-map", "/nonexistent/map.txt", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "missing include file",
+			args:        []string{"-include-file", "/nonexistent/list.txt", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "multiple output formats",
+			args:        []string{"-json", "-csv", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown output format",
+			args:        []string{"-format", "yaml", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "heredoc tag found in input",
+			args:        []string{"-format", "heredoc", "-tag", "END", "-"},
+			input:       "END\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid heredoc tag",
+			args:        []string{"-format", "heredoc", "-tag", "E O F", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid JS quote style",
+			args:        []string{"-js", "-js-quote", "backtick", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "record width with JSON output",
+			args:        []string{"-json", "-record-width", "10", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "multi-byte pad character",
+			args:        []string{"-record-width", "10", "-pad-char", "ab", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown CSV column",
+			args:        []string{"-csv-cols", "num,size", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown SQLite column",
+			args:        []string{"-o", "sqlite:out.db", "-sqlite-cols", "size", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid SQL table name",
+			args:        []string{"-sql-insert", "-table", "users; DROP TABLE users", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "SQLite output with another output",
+			args:        []string{"-o", "sqlite:out.db", "-o", "out.txt", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "closed output file descriptor",
+			args:        []string{"-o", "/dev/fd/9", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "manifest with SQLite output",
+			args:        []string{"-o", "sqlite:out.db", "-manifest", "manifest.json", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid XML element name",
+			args:        []string{"-xml", "1item", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown XML attribute",
+			args:        []string{"-xml", "item", "-xml-attrs", "hash", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "control character in XML output",
+			args:        []string{"-xml", "item", "-"},
+			input:       "bell\x07\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid UTF-8 in XML output",
+			args:        []string{"-xml", "item", "-"},
+			input:       "caf\xe9\n",
+			expectError: true,
+		},
+		{
+			name:        "XML with HTML list",
+			args:        []string{"-xml", "item", "-html-list", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "key prefix with equals sign",
+			args:        []string{"-kv", "A=B", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "number format without verb",
+			args:        []string{"-kv", "HOST", "-kv-num", "_", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "number format with string verb",
+			args:        []string{"-kv", "HOST", "-kv-num", "%s", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown source override",
+			args:        []string{"input.txt?color=red"},
+			input:       "",
+			expectError: true,
+		},
+		{
+			name:        "source field without CSV format",
+			args:        []string{"input.csv?field=2"},
+			input:       "",
+			expectError: true,
+		},
+		{
+			name:        "source CSV format without field",
+			args:        []string{"input.csv?format=csv"},
+			input:       "",
+			expectError: true,
+		},
+		{
+			name:        "dotenv template without number",
+			args:        []string{"-dotenv", "HOST", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "dotenv template with invalid characters",
+			args:        []string{"-dotenv", "HOST-{n}", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "dotenv key starting with number",
+			args:        []string{"-dotenv", "{n}_HOST", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "dotenv docker value with line break",
+			args:        []string{"-dotenv", "V{n}", "-dotenv-docker", "-0", "-"},
+			input:       "a\nb\x00",
+			expectError: true,
+		},
+		{
+			name:        "curl header without colon",
+			args:        []string{"-curl-h", "-"},
+			input:       "Accept application/json\n",
+			expectError: true,
+		},
+		{
+			name:        "curl header with invalid name",
+			args:        []string{"-curl-h", "-"},
+			input:       "Bad Name: x\n",
+			expectError: true,
+		},
+		{
+			name:        "curl headers and data",
+			args:        []string{"-curl-h", "-curl-d", "-"},
+			input:       "A: b\n",
+			expectError: true,
+		},
+		{
+			name:        "join with JSON output",
+			args:        []string{"-join", ",", "-json", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "join with post",
+			args:        []string{"-join", ",", "-post", "http://127.0.0.1:9/", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "negative columns",
+			args:        []string{"-columns", "-2", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "columns with join",
+			args:        []string{"-columns", "2", "-join", ",", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "split lines without output file",
+			args:        []string{"-split-lines", "10", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "split lines with heredoc",
+			args:        []string{"-split-lines", "10", "-format", "heredoc", "-o", "out", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "head with invalid count",
+			args:        []string{"head", "-n", "0", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "split bytes with JSON output",
+			args:        []string{"-split-bytes", "1m", "-json", "-o", "out", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid split bytes",
+			args:        []string{"-split-bytes", "lots", "-o", "out", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "inspect with zero sample",
+			args:        []string{"inspect", "-sample", "0"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "inspect with two files",
+			args:        []string{"inspect", "a", "b"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "tee without output file",
+			args:        []string{"-tee", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "tee with STDOUT output",
+			args:        []string{"-tee", "-o", "-", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "since checkpoint on STDIN",
+			args:        []string{"-since-checkpoint", "cp.json", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "empty output record terminator",
+			args:        []string{"-ors", "", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid output record terminator",
+			args:        []string{"-ors", "\\q", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "convert without -from",
+			args:        []string{"convert", "-to", "json", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "convert from unknown format",
+			args:        []string{"convert", "-from", "yaml", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "convert to unknown format",
+			args:        []string{"convert", "-from", "lines", "-to", "yaml", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "convert JSON that is not an array",
+			args:        []string{"convert", "-from", "json", "-"},
+			input:       `{"a": "b"}`,
+			expectError: true,
+		},
+		{
+			name:        "convert JSON with a number",
+			args:        []string{"convert", "-from", "json", "-"},
+			input:       `["a", 1]`,
+			expectError: true,
+		},
+		{
+			name:        "convert CSV with two columns",
+			args:        []string{"convert", "-from", "csv", "-"},
+			input:       "a,b\n",
+			expectError: true,
+		},
+		{
+			name:        "convert unwrapped line",
+			args:        []string{"convert", "-from", "wrapped", "-"},
+			input:       "\"a\"\nb\n",
+			expectError: true,
+		},
+		{
+			name:        "no final newline with resume state",
+			args:        []string{"-no-final-newline", "-o", "out", "-resume-state", "state.json", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown compression",
+			args:        []string{"-compress", "lzma", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "compressed split output",
+			args:        []string{"-split-lines", "10", "-o", "out.gz", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "template that does not parse",
+			args:        []string{"-template", "{{.Line", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "template with unknown field",
+			args:        []string{"-template", "{{.Text}}", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "template with JSON output",
+			args:        []string{"-template", "{{.Line}}", "-json", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "manifest with several inputs",
+			args:        []string{"-manifest", "manifest.json", "-", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "files-from with a filename",
+			args:        []string{"-files-from", "-", "input.txt"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "files-from listing STDIN",
+			args:        []string{"-files-from", "-"},
+			input:       "-\n",
+			expectError: true,
+		},
+		{
+			name:        "files-from with files0-from",
+			args:        []string{"-files-from", "list.txt", "-files0-from", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "recursive with invalid glob",
+			args:        []string{"-r", ".", "-include", "[a"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "recursive with a filename",
+			args:        []string{"-r", ".", "input.txt"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown decompression",
+			args:        []string{"-decompress", "lz4", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "since-checkpoint with a URL",
+			args:        []string{"-since-checkpoint", "state.json", "http://localhost/input.txt"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "irs with null-terminated input",
+			args:        []string{"-irs", ";", "-0", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "empty irs from hex",
+			args:        []string{"-irs", "\\x", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "irs-regex matching an empty string",
+			args:        []string{"-irs-regex", `\n*`, "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "irs-regex with irs",
+			args:        []string{"-irs-regex", `;`, "-irs", ",", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "csv-in without col",
+			args:        []string{"-csv-in", "-"},
+			input:       "a,b\n",
+			expectError: true,
+		},
+		{
+			name:        "csv-in with JSON output",
+			args:        []string{"-csv-in", "-col", "1", "-json", "-"},
+			input:       "a,b\n",
+			expectError: true,
+		},
+		{
+			name:        "csv-in with tsv-in",
+			args:        []string{"-csv-in", "-tsv-in", "-col", "1", "-"},
+			input:       "a,b\n",
+			expectError: true,
+		},
+		{
+			name:        "jsonl-in without path",
+			args:        []string{"-jsonl-in", "-"},
+			input:       "{}\n",
+			expectError: true,
+		},
+		{
+			name:        "jsonl-in with invalid path",
+			args:        []string{"-jsonl-in", "-path", ".a[x]", "-"},
+			input:       "{}\n",
+			expectError: true,
+		},
+		{
+			name:        "unsupported encoding",
+			args:        []string{"-encoding", "euc-jp", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "negative skip",
+			args:        []string{"-skip", "-1", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "negative head",
+			args:        []string{"-head", "-1", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "head flag with head subcommand",
+			args:        []string{"head", "-n", "2", "-head", "3", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "negative tail",
+			args:        []string{"-tail", "-1", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "tail with head",
+			args:        []string{"-tail", "2", "-head", "3", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "sample fraction above 1",
+			args:        []string{"-sample", "1.5", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "sample-n with tail",
+			args:        []string{"-sample-n", "2", "-tail", "3", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "follow-name with STDIN",
+			args:        []string{"-follow-name", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "record-len with -0",
+			args:        []string{"-record-len", "4", "-0", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown encode",
+			args:        []string{"-encode", "base32", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown binary policy",
+			args:        []string{"-binary", "ignore", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "binary pass with JSON output",
+			args:        []string{"-binary", "pass", "-json", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "negative stdin timeout",
+			args:        []string{"-stdin-timeout", "-1s", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown merge mode",
+			args:        []string{"-merge", "zip", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid grep pattern",
+			args:        []string{"-grep", "a(", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid grep-v pattern",
+			args:        []string{"-grep-v", "[a", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "sub without the closing separator",
+			args:        []string{"-sub", "s/a/b", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "sub with unknown flag",
+			args:        []string{"-sub", "s/a/b/x", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "resume state without output file",
+			args:        []string{"-resume-state", "state.json", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
+		{
+			name:        "resume state with JSON output",
+			args:        []string{"-json", "-o", "out.json", "-resume-state", "state.json", "-"},
+			input:       "test\n",
+			expectError: true,
+		},
 		{
 			name:        "nonexistent input file",
 			args:        []string{"/nonexistent/file.txt"},
@@ -537,6 +6289,18 @@ func TestParseDelimiter(t *testing.T) {
 			expected:    "",
 			expectError: true,
 		},
+		{
+			name:        "lone at sign is literal",
+			input:       "@",
+			expected:    "@",
+			expectError: false,
+		},
+		{
+			name:        "at prefix is literal",
+			input:       "@at",
+			expected:    "@at",
+			expectError: false,
+		},
 		{
 			name:        "out of range",
 			input:       "0x110000",
@@ -561,3 +6325,73 @@ func TestParseDelimiter(t *testing.T) {
 		})
 	}
 }
+
+// TestParseTerminator tests the parseTerminator function directly
+func TestParseTerminator(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		expectError bool
+	}{
+		{name: "literal string", input: ";", expected: ";"},
+		{name: "escapes", input: "\\r\\n\\t\\0\\\\", expected: "\r\n\t\x00\\"},
+		{name: "hex byte escape", input: "END\\xff", expected: "END\xff"},
+		{name: "hex notation", input: "0x3b", expected: ";"},
+		{name: "unknown escape", input: "\\q", expectError: true},
+		{name: "unfinished escape", input: "x\\", expectError: true},
+		{name: "short hex escape", input: "\\x4", expectError: true},
+		{name: "invalid hex escape", input: "\\xZZ", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseTerminator(tt.input)
+
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error, got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+			if !tt.expectError && result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestParseSize tests the parseSize function directly
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    int64
+		expectError bool
+	}{
+		{input: "512", expected: 512},
+		{input: "64k", expected: 64 << 10},
+		{input: "64M", expected: 64 << 20},
+		{input: "64mb", expected: 64 << 20},
+		{input: "2g", expected: 2 << 30},
+		{input: "", expectError: true},
+		{input: "m", expectError: true},
+		{input: "-1", expectError: true},
+		{input: "12x", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := parseSize(tt.input)
+
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error, got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+			if !tt.expectError && result != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, result)
+			}
+		})
+	}
+}